@@ -1,69 +1,212 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"observability/billing"
+	sharedconfig "observability/config"
+)
+
+// Failure modes used when EnableFailures is set
+const (
+	FailureModeRandom        = "random"        // FailureRate, seeded by FailureSeed
+	FailureModeDeterministic = "deterministic" // every FailureEvery-th call fails with FailureType
 )
 
 type Config struct {
-	Port            string
-	JaegerEndpoint  string
-	LogstashHost    string
-	ProcessingDelay time.Duration
-	EnableFailures  bool
-	FailureRate     float64
-	MetricsEnabled  bool
-	TracingEnabled  bool
-	LoggingEnabled  bool
+	Port            string        `yaml:"port"`
+	JaegerEndpoint  string        `yaml:"jaeger_endpoint"`
+	TraceExporter   string        `yaml:"trace_exporter"`
+	OTLPEndpoint    string        `yaml:"otlp_endpoint"`
+	SampleRatio     float64       `yaml:"sample_ratio"`
+	LogstashHost    string        `yaml:"logstash_host"`
+	ProcessingDelay time.Duration `yaml:"processing_delay"`
+	EnableFailures  bool          `yaml:"enable_failures"`
+	FailureRate     float64       `yaml:"failure_rate"`
+	FailureMode     string        `yaml:"failure_mode"`
+	FailureSeed     int64         `yaml:"failure_seed"`
+	FailureEvery    int           `yaml:"failure_every"`
+	FailureType     string        `yaml:"failure_type"`
+	MetricsEnabled  bool          `yaml:"metrics_enabled"`
+	TracingEnabled  bool          `yaml:"tracing_enabled"`
+	LoggingEnabled  bool          `yaml:"logging_enabled"`
+	IdempotencyTTL  time.Duration `yaml:"idempotency_ttl"`
+	RefundWindow    time.Duration `yaml:"refund_window"` // how long payments stay refundable; 0 uses 30 days
+	HealthMaxHeapMB int           `yaml:"health_max_heap_mb"`
+	RateLimitRPS    float64       `yaml:"rate_limit_rps"` // per client IP on payment routes; 0 disables
+	RateLimitBurst  int           `yaml:"rate_limit_burst"`
+	// Plans accepted for payment; only settable from CONFIG_FILE, empty uses
+	// billing.DefaultPlans
+	Plans []billing.Plan `yaml:"plans"`
+	// FeeRates overrides the fee rate of configured plans, e.g.
+	// FEE_RATES=premium=0.025,enterprise=0.02
+	FeeRates map[string]float64 `yaml:"fee_rates"`
+
+	// Payment rules; zero disables each one
+	MaxAmount           float64       `yaml:"max_payment_amount"`
+	FraudRoundThreshold float64       `yaml:"fraud_round_threshold"`
+	FraudWindow         time.Duration `yaml:"fraud_window"`
+	FraudMaxCharges     int           `yaml:"fraud_max_charges"`
+
+	// Browser origins allowed by CORS; empty disables CORS handling
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+
+	// Guard /metrics and the /debug endpoints; empty values leave them open
+	MetricsBearerToken  string   `yaml:"metrics_bearer_token"`
+	MetricsAllowedCIDRs []string `yaml:"metrics_allowed_cidrs"`
+
+	// Serve /debug/pprof behind the metrics credentials, which must be set
+	PprofEnabled bool `yaml:"pprof_enabled"`
+
+	// mu guards SampleRatio and FailureRate, which Watch may replace; read
+	// them through CurrentSampleRatio and CurrentFailureRate once it runs
+	mu sync.RWMutex
 }
 
-func NewConfig() *Config {
-	cfg := &Config{
-		Port:            getEnv("PORT", "8081"),
-		JaegerEndpoint:  getEnv("JAEGER_ENDPOINT", "http://jaeger:14268/api/traces"),
-		LogstashHost:    getEnv("LOGSTASH_HOST", "logstash:5000"),
-		ProcessingDelay: getDurationEnv("PROCESSING_DELAY", 100*time.Millisecond),
-		EnableFailures:  getBoolEnv("ENABLE_FAILURES", false),
-		FailureRate:     getFloatEnv("FAILURE_RATE", 0.1),
-		MetricsEnabled:  getBoolEnv("METRICS_ENABLED", true),
-		TracingEnabled:  getBoolEnv("TRACING_ENABLED", true),
-		LoggingEnabled:  getBoolEnv("LOGGING_ENABLED", true),
+// Load reads the config from the environment, then overlays CONFIG_FILE, a
+// YAML or JSON file keyed by the yaml tags above, when it is set.
+func Load() (*Config, error) {
+	cfg := NewConfig()
+
+	if path := sharedconfig.GetEnv("CONFIG_FILE", ""); path != "" {
+		if err := sharedconfig.LoadFromFile(path, cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	return cfg
+	return cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func NewConfig() *Config {
+	return &Config{
+		Port:            sharedconfig.GetEnv("PORT", "8081"),
+		JaegerEndpoint:  sharedconfig.GetEnv("JAEGER_ENDPOINT", "http://jaeger:14268/api/traces"),
+		TraceExporter:   sharedconfig.GetEnv("TRACE_EXPORTER", "jaeger"),
+		OTLPEndpoint:    sharedconfig.GetEnv("OTLP_ENDPOINT", ""),
+		SampleRatio:     sharedconfig.GetFloatEnv("TRACE_SAMPLE_RATIO", 1.0),
+		LogstashHost:    sharedconfig.GetEnv("LOGSTASH_HOST", "logstash:5000"),
+		ProcessingDelay: sharedconfig.GetDurationEnv("PROCESSING_DELAY", 100*time.Millisecond),
+		EnableFailures:  sharedconfig.GetBoolEnv("ENABLE_FAILURES", false),
+		FailureRate:     sharedconfig.GetFloatEnv("FAILURE_RATE", 0.1),
+		FailureMode:     sharedconfig.GetEnv("FAILURE_MODE", FailureModeRandom),
+		FailureSeed:     int64(sharedconfig.GetIntEnv("FAILURE_SEED", 0)),
+		FailureEvery:    sharedconfig.GetIntEnv("FAILURE_EVERY", 10),
+		FailureType:     sharedconfig.GetEnv("FAILURE_TYPE", "processing_error"),
+		MetricsEnabled:  sharedconfig.GetBoolEnv("METRICS_ENABLED", true),
+		TracingEnabled:  sharedconfig.GetBoolEnv("TRACING_ENABLED", true),
+		LoggingEnabled:  sharedconfig.GetBoolEnv("LOGGING_ENABLED", true),
+		IdempotencyTTL:  sharedconfig.GetDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour),
+		RefundWindow:    sharedconfig.GetDurationEnv("REFUND_WINDOW", 30*24*time.Hour),
+		HealthMaxHeapMB: sharedconfig.GetIntEnv("HEALTH_MAX_HEAP_MB", 512),
+		RateLimitRPS:    sharedconfig.GetFloatEnv("RATE_LIMIT_RPS", 0),
+		RateLimitBurst:  sharedconfig.GetIntEnv("RATE_LIMIT_BURST", 0),
+		FeeRates:        getRatesEnv("FEE_RATES"),
+
+		MaxAmount:           sharedconfig.GetFloatEnv("MAX_PAYMENT_AMOUNT", 10000),
+		FraudRoundThreshold: sharedconfig.GetFloatEnv("FRAUD_ROUND_THRESHOLD", 1000),
+		FraudWindow:         sharedconfig.GetDurationEnv("FRAUD_WINDOW", time.Minute),
+		FraudMaxCharges:     sharedconfig.GetIntEnv("FRAUD_MAX_CHARGES", 3),
+
+		CORSAllowedOrigins: sharedconfig.GetListEnv("CORS_ALLOWED_ORIGINS"),
+
+		MetricsBearerToken:  sharedconfig.GetEnv("METRICS_BEARER_TOKEN", ""),
+		MetricsAllowedCIDRs: sharedconfig.GetListEnv("METRICS_ALLOWED_CIDRS"),
+
+		PprofEnabled: sharedconfig.GetBoolEnv("PPROF_ENABLED", false),
 	}
-	return defaultValue
 }
 
-func getBoolEnv(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := strconv.ParseBool(value); err == nil {
-			return parsed
+// PlanRegistry builds the registry of the configured plans with FeeRates
+// applied on top.
+func (c *Config) PlanRegistry() (*billing.PlanRegistry, error) {
+	plans, err := billing.NewPlanRegistry(c.Plans)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for name, rate := range c.FeeRates {
+		plan, ok := plans.Lookup(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("fee rate set for unknown plan %s", name))
+			continue
 		}
+		plan.FeeRate = rate
+		if err := plans.Register(plan); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
 	}
-	return defaultValue
+
+	return plans, nil
+}
+
+func (c *Config) CurrentSampleRatio() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.SampleRatio
+}
+
+func (c *Config) CurrentFailureRate() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.FailureRate
 }
 
-func getFloatEnv(key string, defaultValue float64) float64 {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
-			return parsed
+// Watch reloads SampleRatio and FailureRate from the environment and
+// CONFIG_FILE whenever the process receives SIGHUP, until ctx is done. Other
+// settings still need a restart. onReload, if set, is called after each
+// attempt with its error; a failed reload keeps the current values.
+func (c *Config) Watch(ctx context.Context, onReload func(error)) {
+	sharedconfig.OnReloadSignal(ctx, func() {
+		err := c.reload()
+		if onReload != nil {
+			onReload(err)
 		}
+	})
+}
+
+func (c *Config) reload() error {
+	fresh, err := Load()
+	if err != nil {
+		return err
+	}
+	if err := fresh.Validate(); err != nil {
+		return err
 	}
-	return defaultValue
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SampleRatio = fresh.SampleRatio
+	c.FailureRate = fresh.FailureRate
+	return nil
 }
 
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		if parsed, err := time.ParseDuration(value); err == nil {
-			return parsed
+// getRatesEnv parses comma-separated plan=rate pairs, skipping malformed ones.
+func getRatesEnv(key string) map[string]float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil
+	}
+
+	rates := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		plan, rate, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if parsed, err := strconv.ParseFloat(rate, 64); err == nil {
+			rates[plan] = parsed
 		}
 	}
-	return defaultValue
+	return rates
 }
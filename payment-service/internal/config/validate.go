@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	observe "observability"
+)
+
+// Validate reports every invalid setting at once, so a misconfigured
+// deployment fails at startup instead of misbehaving later.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if err := validatePort(c.Port); err != nil {
+		errs = append(errs, fmt.Errorf("PORT: %w", err))
+	}
+
+	switch c.TraceExporter {
+	case "", observe.ExporterJaeger:
+		if c.TracingEnabled {
+			if err := validateURL(c.JaegerEndpoint); err != nil {
+				errs = append(errs, fmt.Errorf("JAEGER_ENDPOINT: %w", err))
+			}
+		}
+	case observe.ExporterOTLPGRPC, observe.ExporterOTLPHTTP:
+		// OTLP_ENDPOINT may be empty; the exporters then read
+		// OTEL_EXPORTER_OTLP_ENDPOINT
+	default:
+		errs = append(errs, fmt.Errorf("TRACE_EXPORTER: unknown exporter %q", c.TraceExporter))
+	}
+
+	if c.LoggingEnabled && c.LogstashHost != "" {
+		if _, _, err := net.SplitHostPort(c.LogstashHost); err != nil {
+			errs = append(errs, fmt.Errorf("LOGSTASH_HOST: %w", err))
+		}
+	}
+
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("TRACE_SAMPLE_RATIO: %v is outside 0-1", c.SampleRatio))
+	}
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		errs = append(errs, fmt.Errorf("FAILURE_RATE: %v is outside 0-1", c.FailureRate))
+	}
+	switch c.FailureMode {
+	case FailureModeRandom:
+	case FailureModeDeterministic:
+		if c.FailureEvery <= 0 {
+			errs = append(errs, fmt.Errorf("FAILURE_EVERY: must be positive in %s mode", FailureModeDeterministic))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("FAILURE_MODE: unknown mode %q", c.FailureMode))
+	}
+
+	if _, err := c.PlanRegistry(); err != nil {
+		errs = append(errs, fmt.Errorf("plans, FEE_RATES: %w", err))
+	}
+
+	if c.ProcessingDelay < 0 {
+		errs = append(errs, errors.New("PROCESSING_DELAY: must not be negative"))
+	}
+	if c.RateLimitRPS < 0 || c.RateLimitBurst < 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_RPS, RATE_LIMIT_BURST: must not be negative"))
+	}
+	if c.MaxAmount < 0 {
+		errs = append(errs, errors.New("MAX_PAYMENT_AMOUNT: must not be negative"))
+	}
+
+	metricsAuth := observe.MetricsAuthConfig{BearerToken: c.MetricsBearerToken, AllowedCIDRs: c.MetricsAllowedCIDRs}
+	if c.PprofEnabled && !metricsAuth.Enabled() {
+		errs = append(errs, errors.New("PPROF_ENABLED: requires METRICS_BEARER_TOKEN or METRICS_ALLOWED_CIDRS"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(strings.TrimPrefix(port, ":"))
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q is not a port number", port)
+	}
+	return nil
+}
+
+// validateURL accepts absolute http and https URLs.
+func validateURL(raw string) error {
+	if raw == "" {
+		return errors.New("must not be empty")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", raw)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"failure rate above 1", func(c *Config) { c.FailureRate = 5.0 }, "FAILURE_RATE: 5 is outside 0-1"},
+		{"negative failure rate", func(c *Config) { c.FailureRate = -0.1 }, "FAILURE_RATE:"},
+		{"bad jaeger endpoint", func(c *Config) { c.JaegerEndpoint = "jaeger:14268" }, "JAEGER_ENDPOINT:"},
+		{"empty jaeger endpoint", func(c *Config) { c.JaegerEndpoint = "" }, "JAEGER_ENDPOINT: must not be empty"},
+		{"non-numeric port", func(c *Config) { c.Port = "http" }, "PORT:"},
+		{"bad logstash host", func(c *Config) { c.LogstashHost = "logstash" }, "LOGSTASH_HOST:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Port = "abc"
+	cfg.FailureRate = 5.0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for _, want := range []string{"PORT:", "FAILURE_RATE:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to include %s", err, want)
+		}
+	}
+}
@@ -14,6 +14,13 @@ type Dependencies struct {
 	Logger    zerolog.Logger
 	Processor *services.PaymentProcessor
 	Metrics   *observe.Metrics
+
+	// Recover is the outermost middleware on the payment routes
+	Recover observe.Middleware
+	// RateLimit wraps the payment routes; nil leaves them unlimited
+	RateLimit observe.Middleware
+	// AccessLog logs one line per payment request; nil disables it
+	AccessLog observe.Middleware
 }
 
 func NewDependencies(
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"payment-service/internal/models"
+
+	observe "observability"
+	"observability/openapi"
+)
+
+// OpenAPIDocument describes the payment API. Plan names come from plans, so
+// the enum matches what the processor accepts.
+func OpenAPIDocument(plans []string) *openapi.Document {
+	doc := openapi.NewDocument(openapi.Info{
+		Title:       "Payment service",
+		Version:     "1",
+		Description: "Charges and refunds for subscriptions. Errors use the Error body.",
+	})
+
+	request := openapi.SchemaOf(models.PaymentRequest{})
+	request.Properties["plan"] = openapi.String("", plans...)
+	request.Properties["method"] = openapi.String("",
+		models.MethodCard, models.MethodBankTransfer, models.MethodPayPal, models.MethodWallet)
+	request.Properties["currency"] = openapi.String("ISO 4217 code; defaults to USD")
+	requestRef := doc.Define("PaymentRequest", request)
+
+	response := openapi.SchemaOf(models.PaymentResponse{})
+	response.Properties["status"] = openapi.String("", models.StatusCompleted, models.StatusFailed)
+	responseRef := doc.Define("PaymentResponse", response)
+
+	refund := openapi.SchemaOf(models.RefundRequest{})
+	refund.Properties["reason"] = openapi.String("Defaults to "+models.RefundReasonRequested,
+		models.RefundReasonRequested, models.RefundReasonCancellation, models.RefundReasonDuplicate, models.RefundReasonFraudulent)
+	refundRef := doc.Define("RefundRequest", refund)
+
+	refundResponse := openapi.SchemaOf(models.RefundResponse{})
+	refundResponse.Properties["status"] = openapi.String("", models.StatusRefunded, models.StatusPartiallyRefunded)
+	refundResponseRef := doc.Define("RefundResponse", refundResponse)
+
+	errorRef := doc.Define("Error", openapi.SchemaOf(observe.ErrorResponse{}))
+
+	// Responses every payment route can return from handlePaymentError and
+	// its middleware
+	failures := func(responses map[string]openapi.Response) map[string]openapi.Response {
+		responses["400"] = openapi.Content("Validation failed or the payment was declined", errorRef)
+		responses["402"] = openapi.Content("Suspected fraud", errorRef)
+		responses["413"] = openapi.Content("Body too large", errorRef)
+		responses["422"] = openapi.Content("Idempotency-Key already used for a different subscription or amount", errorRef)
+		responses["429"] = openapi.Content("Rate limited; see Retry-After", errorRef)
+		responses["500"] = openapi.Content("Transient processing, network or timeout failure; safe to retry with the same Idempotency-Key", errorRef)
+		return responses
+	}
+	idempotencyKey := openapi.HeaderParam("Idempotency-Key", "Charges at most once per key; the body field takes precedence")
+
+	doc.Path(processEndpoint).Post = &openapi.Operation{
+		Summary:     "Charge a payment",
+		Tags:        []string{"payments"},
+		Parameters:  []openapi.Parameter{idempotencyKey},
+		RequestBody: openapi.JSONBody(requestRef),
+		Responses: failures(map[string]openapi.Response{
+			"200": openapi.Content("Completed", responseRef),
+		}),
+	}
+	doc.Path(asyncEndpoint).Post = &openapi.Operation{
+		Summary:     "Charge a payment in the background and POST the PaymentResponse to callback_url",
+		Tags:        []string{"payments"},
+		Parameters:  []openapi.Parameter{idempotencyKey},
+		RequestBody: openapi.JSONBody(requestRef),
+		Responses: failures(map[string]openapi.Response{
+			"202": openapi.Content("Accepted", &openapi.Schema{
+				Type: "object",
+				Properties: map[string]*openapi.Schema{
+					"payment_id": openapi.String(""),
+					"status":     openapi.String("", models.StatusPending),
+				},
+				Required: []string{"payment_id", "status"},
+			}),
+		}),
+	}
+	doc.Path(refundEndpoint).Post = &openapi.Operation{
+		Summary:     "Refund some or all of a completed payment",
+		Tags:        []string{"payments"},
+		RequestBody: openapi.JSONBody(refundRef),
+		Responses: failures(map[string]openapi.Response{
+			"200": openapi.Content("Refunded", refundResponseRef),
+			"404": openapi.Content("Unknown payment", errorRef),
+		}),
+	}
+
+	health := openapi.SchemaOf(map[string]interface{}{})
+	for path, summary := range map[string]string{
+		"/health": "Dependency health check; ?verbose=true adds per-check results",
+		"/readyz": "Readiness probe; same as /health",
+	} {
+		doc.Path(path).Get = &openapi.Operation{
+			Summary: summary,
+			Tags:    []string{"health"},
+			Responses: map[string]openapi.Response{
+				"200": openapi.Content("Healthy", health),
+				"503": openapi.Content("A dependency is unhealthy", health),
+			},
+		}
+	}
+	doc.Path("/healthz").Get = &openapi.Operation{
+		Summary:   "Liveness probe",
+		Tags:      []string{"health"},
+		Responses: map[string]openapi.Response{"200": openapi.Content("Serving", openapi.SchemaOf(map[string]string{}))},
+	}
+	doc.Path("/metrics").Get = &openapi.Operation{
+		Summary:   "Prometheus metrics",
+		Tags:      []string{"observability"},
+		Responses: map[string]openapi.Response{"200": openapi.Text("Prometheus text exposition format")},
+	}
+
+	logLevel := openapi.SchemaOf(observe.LogLevelBody{})
+	logLevel.Properties["level"] = openapi.String("", "trace", "debug", "info", "warn", "error", "fatal", "panic", "disabled")
+	logLevelRef := doc.Define("LogLevel", logLevel)
+	logLevelPath := doc.Path("/debug/loglevel")
+	logLevelPath.Get = &openapi.Operation{
+		Summary:   "Current global log level; served only when /metrics credentials are configured",
+		Tags:      []string{"observability"},
+		Responses: map[string]openapi.Response{"200": openapi.Content("Current level", logLevelRef)},
+	}
+	logLevelPath.Put = &openapi.Operation{
+		Summary:     "Change the global log level without a restart; served only when /metrics credentials are configured",
+		Tags:        []string{"observability"},
+		RequestBody: openapi.JSONBody(logLevelRef),
+		Responses: map[string]openapi.Response{
+			"200": openapi.Content("New level", logLevelRef),
+			"400": openapi.Content("Unknown level", errorRef),
+		},
+	}
+
+	return doc
+}
@@ -5,12 +5,26 @@ import (
 	"encoding/json"
 	"net/http"
 	"payment-service/internal/models"
+	"strconv"
 	"time"
 
+	observe "observability"
+	"observability/openapi"
+	"observability/paymentapi"
+
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
 )
 
+const (
+	processEndpoint = paymentapi.ProcessPath
+	asyncEndpoint   = paymentapi.ProcessAsyncPath
+	refundEndpoint  = paymentapi.RefundPath
+)
+
+// maxBodyBytes bounds payment and refund request bodies
+const maxBodyBytes = 64 << 10
+
 type PaymentHandler struct {
 	deps *Dependencies
 }
@@ -25,32 +39,31 @@ func (h *PaymentHandler) ProcessPayment(w http.ResponseWriter, r *http.Request)
 	propagator := otel.GetTextMapPropagator()
 	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
 
-	h.deps.Logger.Debug().
-		Str("method", r.Method).
-		Str("path", r.URL.Path).
-		Str("remote_addr", r.RemoteAddr).
-		Msg("Processing payment request")
-
 	if r.Method != http.MethodPost {
 		h.deps.Logger.Warn().
 			Str("method", r.Method).
 			Msg("Invalid HTTP method for payment processing")
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 		return
 	}
 
 	var req models.PaymentRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := observe.DecodeJSON(w, r, &req, maxBodyBytes); err != nil {
 		h.deps.Logger.Error().
 			Err(err).
 			Msg("Failed to decode payment request")
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	}
+
 	response, err := h.deps.Processor.ProcessPayment(ctx, req)
 	if err != nil {
-		h.handlePaymentError(w, err, req, startTime)
+		h.handlePaymentError(w, r, err, processEndpoint, startTime, map[string]interface{}{
+			"subscription_id": req.SubscriptionID,
+		})
 		return
 	}
 
@@ -75,14 +88,116 @@ func (h *PaymentHandler) ProcessPayment(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-func (h *PaymentHandler) handlePaymentError(w http.ResponseWriter, err error, req models.PaymentRequest, startTime time.Time) {
+// ProcessPaymentAsync accepts a payment with a callback_url and answers 202
+// with the payment ID; the outcome is POSTed to the callback later.
+func (h *PaymentHandler) ProcessPaymentAsync(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	propagator := otel.GetTextMapPropagator()
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	if r.Method != http.MethodPost {
+		h.deps.Logger.Warn().
+			Str("method", r.Method).
+			Msg("Invalid HTTP method for async payment processing")
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req models.PaymentRequest
+	if err := observe.DecodeJSON(w, r, &req, maxBodyBytes); err != nil {
+		h.deps.Logger.Error().
+			Err(err).
+			Msg("Failed to decode async payment request")
+		return
+	}
+
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	}
+
+	paymentID, err := h.deps.Processor.ProcessAsync(ctx, req)
+	if err != nil {
+		h.handlePaymentError(w, r, err, asyncEndpoint, startTime, map[string]interface{}{
+			"subscription_id": req.SubscriptionID,
+		})
+		return
+	}
+
+	h.deps.Logger.Info().
+		Str("payment_id", paymentID).
+		Str("subscription_id", req.SubscriptionID).
+		Str("callback_url", req.CallbackURL).
+		Dur("duration", time.Since(startTime)).
+		Msg("Payment accepted for async processing")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"payment_id": paymentID,
+		"status":     models.StatusPending,
+	})
+}
+
+func (h *PaymentHandler) Refund(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+
+	propagator := otel.GetTextMapPropagator()
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	if r.Method != http.MethodPost {
+		h.deps.Logger.Warn().
+			Str("method", r.Method).
+			Msg("Invalid HTTP method for refund")
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req models.RefundRequest
+	if err := observe.DecodeJSON(w, r, &req, maxBodyBytes); err != nil {
+		h.deps.Logger.Error().
+			Err(err).
+			Msg("Failed to decode refund request")
+		return
+	}
+
+	response, err := h.deps.Processor.Refund(ctx, req)
+	if err != nil {
+		h.handlePaymentError(w, r, err, refundEndpoint, startTime, map[string]interface{}{
+			"payment_id": req.PaymentID,
+		})
+		return
+	}
+
+	h.deps.Logger.Info().
+		Str("refund_id", response.ID).
+		Str("payment_id", response.PaymentID).
+		Str("status", response.Status).
+		Dur("duration", time.Since(startTime)).
+		Msg("Refund processed successfully")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.deps.Logger.Error().
+			Err(err).
+			Str("refund_id", response.ID).
+			Msg("Failed to encode refund response")
+	}
+}
+
+// handlePaymentError writes err with observe.WriteErrorDetail, keeping the
+// PaymentError code and type. fields are added to the error log.
+func (h *PaymentHandler) handlePaymentError(w http.ResponseWriter, r *http.Request, err error, endpoint string, startTime time.Time, fields map[string]interface{}) {
 	if h.deps.Metrics != nil {
-		h.deps.Metrics.ErrorsTotal.WithLabelValues("POST", "payment_processing").Inc()
+		h.deps.Metrics.RecordError("POST", endpoint, "payment_processing")
 	}
 
 	h.deps.Logger.Error().
 		Err(err).
-		Str("subscription_id", req.SubscriptionID).
+		Fields(fields).
+		Str("endpoint", endpoint).
 		Dur("duration", time.Since(startTime)).
 		Msg("Payment processing failed")
 
@@ -93,63 +208,111 @@ func (h *PaymentHandler) handlePaymentError(w http.ResponseWriter, err error, re
 			paymentErr.Type == models.ErrorTypeTimeout {
 			status = http.StatusInternalServerError
 		}
+		switch paymentErr.Type {
+		case models.ErrorTypeNotFound:
+			status = http.StatusNotFound
+		case models.ErrorTypeFraudSuspected:
+			status = http.StatusPaymentRequired
+		case models.ErrorTypeIdempotencyMismatch:
+			status = http.StatusUnprocessableEntity
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(status)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"error": map[string]string{
-				"code":    paymentErr.Code,
-				"message": paymentErr.Message,
-				"type":    paymentErr.Type,
-			},
+		observe.WriteErrorDetail(w, r, status, observe.ErrorDetail{
+			Code:    paymentErr.Code,
+			Message: paymentErr.Message,
+			Type:    paymentErr.Type,
 		})
 		return
 	}
 
-	http.Error(w, "Payment processing failed", http.StatusInternalServerError)
+	observe.WriteError(w, r, http.StatusInternalServerError, "PAYMENT_FAILED", "Payment processing failed")
+}
+
+// Liveness reports only that the process is serving requests; it never
+// probes dependencies, so a slow dependency cannot get the pod restarted.
+func (h *PaymentHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "ok",
+		"service": "payment-service",
+	})
 }
 
+// HealthCheck probes dependencies and answers 503 if any is unhealthy. The
+// per-check breakdown is included with ?verbose=true.
 func (h *PaymentHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	if err := h.deps.Processor.HealthCheck(ctx); err != nil {
+	result := h.deps.Processor.HealthCheck(ctx)
+
+	status := http.StatusOK
+	if !result.Healthy() {
 		h.deps.Logger.Error().
-			Err(err).
+			Interface("checks", result.Checks).
 			Msg("Health check failed")
-		http.Error(w, "Service unhealthy", http.StatusServiceUnavailable)
-		return
+		status = http.StatusServiceUnavailable
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":    "healthy",
+	body := map[string]interface{}{
+		"status":    result.Status,
 		"service":   "payment-service",
 		"timestamp": time.Now().UTC().Format(time.RFC3339),
-	})
+	}
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+		body["checks"] = result.Checks
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
 }
 
-func RegisterRoutes(deps *Dependencies) {
+func RegisterRoutes(mux *http.ServeMux, deps *Dependencies) {
 	handler := NewPaymentHandler(deps)
 
-	if deps.Metrics != nil {
-		http.HandleFunc("/process", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(processEndpoint, instrument(deps, processEndpoint, handler.ProcessPayment))
+	mux.HandleFunc(asyncEndpoint, instrument(deps, asyncEndpoint, handler.ProcessPaymentAsync))
+	mux.HandleFunc(refundEndpoint, instrument(deps, refundEndpoint, handler.Refund))
+
+	mux.HandleFunc("/health", handler.HealthCheck)
+	mux.HandleFunc("/healthz", handler.Liveness)
+	mux.HandleFunc("/readyz", handler.HealthCheck)
+
+	mux.HandleFunc("/openapi.json", openapi.Handler(OpenAPIDocument(deps.Processor.Plans().Names())))
+
+	deps.Logger.Info().Msg("Payment service routes registered")
+}
+
+func instrument(deps *Dependencies, endpoint string, next http.HandlerFunc) http.HandlerFunc {
+	return observe.Chain(
+		deps.Recover,
+		requestMetrics(deps.Metrics, endpoint),
+		observe.RequestIDMiddleware(),
+		deps.AccessLog,
+		deps.RateLimit,
+	)(next)
+}
+
+// requestMetrics records request count, latency and in-flight requests for
+// endpoint; nil metrics disables it.
+func requestMetrics(metrics *observe.Metrics, endpoint string) observe.Middleware {
+	if metrics == nil {
+		return nil
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
-			deps.Metrics.RequestsTotal.WithLabelValues(r.Method, "/process").Inc()
-			deps.Metrics.ActiveRequests.Inc()
+			metrics.RequestsTotal.WithLabelValues(r.Method, endpoint).Inc()
+			metrics.ActiveRequests.Inc()
 			defer func() {
-				deps.Metrics.ActiveRequests.Dec()
+				metrics.ActiveRequests.Dec()
 				duration := time.Since(start).Seconds()
-				deps.Metrics.RequestDuration.WithLabelValues(r.Method, "/process").Observe(duration)
+				metrics.RequestDuration.WithLabelValues(r.Method, endpoint).Observe(duration)
 			}()
-			handler.ProcessPayment(w, r)
-		})
-	} else {
-		http.HandleFunc("/process", handler.ProcessPayment)
+			next(w, r)
+		}
 	}
-
-	http.HandleFunc("/health", handler.HealthCheck)
-
-	deps.Logger.Info().Msg("Payment service routes registered")
 }
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"payment-service/internal/config"
+	"payment-service/internal/services"
+
+	"observability/paymentapi"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRoutesServePaymentAPI(t *testing.T) {
+	processor := services.NewPaymentProcessor(&config.Config{}, zerolog.Nop(), nil)
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewDependencies(&config.Config{}, zerolog.Nop(), processor, nil))
+
+	body := `{"subscription_id":"sub_1","amount":10,"plan":"basic"}`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, paymentapi.ProcessPath, strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, want %d; body %s", paymentapi.ProcessPath, rec.Code, http.StatusOK, rec.Body)
+	}
+
+	for _, path := range []string{paymentapi.ProcessAsyncPath, paymentapi.RefundPath} {
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s: status = %d, want %d from its handler", path, rec.Code, http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"math"
+	"strings"
+)
+
+const DefaultCurrency = "USD"
+
+// currencyMinorUnits maps the supported ISO 4217 codes to the number of
+// decimal places their amounts carry.
+var currencyMinorUnits = map[string]int{
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CAD": 2,
+	"AUD": 2,
+	"CHF": 2,
+	"SEK": 2,
+	"UAH": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"JOD": 3,
+}
+
+const (
+	MethodCard         = "card"
+	MethodBankTransfer = "bank_transfer"
+	MethodPayPal       = "paypal"
+	MethodWallet       = "wallet"
+)
+
+var allowedMethods = map[string]bool{
+	MethodCard:         true,
+	MethodBankTransfer: true,
+	MethodPayPal:       true,
+	MethodWallet:       true,
+}
+
+// NormalizeCurrency upper-cases code and substitutes DefaultCurrency when it
+// is empty.
+func NormalizeCurrency(code string) string {
+	if code == "" {
+		return DefaultCurrency
+	}
+	return strings.ToUpper(code)
+}
+
+// IsValidCurrency reports whether code, in any case, is a supported ISO 4217
+// currency.
+func IsValidCurrency(code string) bool {
+	_, ok := currencyMinorUnits[strings.ToUpper(code)]
+	return ok
+}
+
+// MinorUnits returns the decimal places used by currency, defaulting to 2 for
+// unknown codes.
+func MinorUnits(currency string) int {
+	if units, ok := currencyMinorUnits[NormalizeCurrency(currency)]; ok {
+		return units
+	}
+	return 2
+}
+
+// NormalizeAmount rounds amount to currency's minor unit, e.g. cents for USD
+// and whole yen for JPY.
+func NormalizeAmount(amount float64, currency string) float64 {
+	scale := math.Pow10(MinorUnits(currency))
+	return math.Round(amount*scale) / scale
+}
@@ -0,0 +1,34 @@
+package models
+
+import "testing"
+
+func TestNormalizeAmount(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		want     float64
+	}{
+		{9.999, "USD", 10.00},
+		{9.994, "usd", 9.99},
+		{1234.5, "JPY", 1235},
+		{1234.4, "jpy", 1234},
+		{1.23456, "BHD", 1.235},
+		{1.23449, "BHD", 1.234},
+		// Unknown codes keep two decimals
+		{9.994, "XYZ", 9.99},
+	}
+	for _, tt := range tests {
+		if got := NormalizeAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("NormalizeAmount(%v, %s) = %v, want %v", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := map[string]int{"USD": 2, "JPY": 0, "BHD": 3, "": 2, "XYZ": 2}
+	for currency, want := range tests {
+		if got := MinorUnits(currency); got != want {
+			t.Errorf("MinorUnits(%q) = %d, want %d", currency, got, want)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math/rand"
 	"time"
+
+	"observability/billing"
 )
 
 type PaymentRequest struct {
@@ -12,8 +14,14 @@ type PaymentRequest struct {
 	Plan           string  `json:"plan"`
 	Currency       string  `json:"currency,omitempty"`
 	Method         string  `json:"method,omitempty"`
+	// IdempotencyKey may also be sent as the Idempotency-Key header
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// CallbackURL receives the PaymentResponse from /process-async
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
+// PaymentResponse is mirrored by the subscription service's PaymentResponse;
+// change both together.
 type PaymentResponse struct {
 	ID          string    `json:"id"`
 	Status      string    `json:"status"`
@@ -23,6 +31,22 @@ type PaymentResponse struct {
 	Fees        float64   `json:"fees,omitempty"`
 }
 
+type RefundRequest struct {
+	PaymentID string  `json:"payment_id"`
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+type RefundResponse struct {
+	ID            string    `json:"id"`
+	PaymentID     string    `json:"payment_id"`
+	Status        string    `json:"status"`
+	Amount        float64   `json:"amount"`
+	TotalRefunded float64   `json:"total_refunded"`
+	Reason        string    `json:"reason"`
+	ProcessedAt   time.Time `json:"processed_at"`
+}
+
 type PaymentError struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
@@ -38,6 +62,17 @@ const (
 	StatusFailed    = "failed"
 	StatusPending   = "pending"
 	StatusCancelled = "cancelled"
+
+	StatusRefunded          = "refunded"
+	StatusPartiallyRefunded = "partially_refunded"
+)
+
+// Refund reasons double as the refunds_total label, so only these are accepted
+const (
+	RefundReasonRequested    = "requested_by_customer"
+	RefundReasonCancellation = "cancellation"
+	RefundReasonDuplicate    = "duplicate"
+	RefundReasonFraudulent   = "fraudulent"
 )
 
 const (
@@ -46,22 +81,58 @@ const (
 	ErrorTypeNetworkError      = "network_error"
 	ErrorTypeProcessingError   = "processing_error"
 	ErrorTypeTimeout           = "timeout"
+	ErrorTypeNotFound          = "not_found"
+	ErrorTypeFraudSuspected    = "fraud_suspected"
+	ErrorTypeValidation        = "validation_error"
+	// ErrorTypeIdempotencyMismatch marks an idempotency key reused for a
+	// different request
+	ErrorTypeIdempotencyMismatch = "idempotency_mismatch"
 )
 
+// ValidatePaymentLimits rejects amounts above maxAmount; zero means no limit.
+func ValidatePaymentLimits(req PaymentRequest, maxAmount float64) error {
+	if maxAmount > 0 && req.Amount > maxAmount {
+		return PaymentError{
+			Code:    "AMOUNT_TOO_LARGE",
+			Message: fmt.Sprintf("amount exceeds the maximum of %.2f", maxAmount),
+			Type:    ErrorTypeValidation,
+		}
+	}
+	return nil
+}
+
+// ValidatePaymentPlan rejects plans missing from plans. It is separate from
+// ValidatePaymentRequest because the registry comes from config.
+func ValidatePaymentPlan(req PaymentRequest, plans *billing.PlanRegistry) error {
+	if !plans.IsValid(req.Plan) {
+		return unknownPlanError(req.Plan)
+	}
+	return nil
+}
+
+func unknownPlanError(plan string) PaymentError {
+	return PaymentError{
+		Code:    "UNKNOWN_PLAN",
+		Message: fmt.Sprintf("unknown plan %q", plan),
+		Type:    ErrorTypeValidation,
+	}
+}
+
 func ValidatePaymentRequest(req PaymentRequest) error {
 	if req.SubscriptionID == "" {
 		return PaymentError{
 			Code:    "MISSING_SUBSCRIPTION_ID",
 			Message: "subscription ID is required",
-			Type:    "validation_error",
+			Type:    ErrorTypeValidation,
 		}
 	}
 
-	if req.Amount <= 0 {
+	// Checked after rounding, so 0.4 JPY is rejected rather than charged as 0
+	if NormalizeAmount(req.Amount, req.Currency) <= 0 {
 		return PaymentError{
 			Code:    "INVALID_AMOUNT",
 			Message: "amount must be greater than 0",
-			Type:    "validation_error",
+			Type:    ErrorTypeValidation,
 		}
 	}
 
@@ -69,7 +140,53 @@ func ValidatePaymentRequest(req PaymentRequest) error {
 		return PaymentError{
 			Code:    "MISSING_PLAN",
 			Message: "plan is required",
-			Type:    "validation_error",
+			Type:    ErrorTypeValidation,
+		}
+	}
+
+	if req.Currency != "" && !IsValidCurrency(req.Currency) {
+		return PaymentError{
+			Code:    "INVALID_CURRENCY",
+			Message: fmt.Sprintf("unsupported currency %q", req.Currency),
+			Type:    ErrorTypeValidation,
+		}
+	}
+
+	if req.Method != "" && !allowedMethods[req.Method] {
+		return PaymentError{
+			Code:    "INVALID_METHOD",
+			Message: fmt.Sprintf("unsupported payment method %q", req.Method),
+			Type:    ErrorTypeValidation,
+		}
+	}
+
+	return nil
+}
+
+func ValidateRefundRequest(req RefundRequest) error {
+	if req.PaymentID == "" {
+		return PaymentError{
+			Code:    "MISSING_PAYMENT_ID",
+			Message: "payment ID is required",
+			Type:    ErrorTypeValidation,
+		}
+	}
+
+	if req.Amount <= 0 {
+		return PaymentError{
+			Code:    "INVALID_AMOUNT",
+			Message: "amount must be greater than 0",
+			Type:    ErrorTypeValidation,
+		}
+	}
+
+	switch req.Reason {
+	case RefundReasonRequested, RefundReasonCancellation, RefundReasonDuplicate, RefundReasonFraudulent:
+	default:
+		return PaymentError{
+			Code:    "INVALID_REASON",
+			Message: fmt.Sprintf("unknown refund reason %q", req.Reason),
+			Type:    ErrorTypeValidation,
 		}
 	}
 
@@ -80,57 +197,78 @@ func GeneratePaymentID() string {
 	return fmt.Sprintf("pmt_%d_%d", time.Now().UnixNano(), rand.Int31())
 }
 
-func CalculateFees(amount float64, plan string) float64 {
-	baseRate := 0.029 // 2.9%
+func GenerateRefundID() string {
+	return fmt.Sprintf("rfd_%d_%d", time.Now().UnixNano(), rand.Int31())
+}
 
-	switch plan {
-	case "premium":
-		baseRate = 0.025
-	case "enterprise":
-		baseRate = 0.02
-	}
+// MinimumFee floors the processing fee of every payment
+const MinimumFee = 0.30
 
-	fee := amount * baseRate
+// CalculateFees applies the plan's fee rate with a MinimumFee floor and rounds
+// the result to currency's minor unit. Unknown plans get the same error as
+// from ValidatePaymentPlan.
+func CalculateFees(amount float64, plan, currency string, plans *billing.PlanRegistry) (float64, error) {
+	p, ok := plans.Lookup(plan)
+	if !ok {
+		return 0, unknownPlanError(plan)
+	}
+	fee := amount * p.FeeRate
 
-	if fee < 0.30 {
-		fee = 0.30
+	if fee < MinimumFee {
+		fee = MinimumFee
 	}
 
-	return fee
+	return NormalizeAmount(fee, currency), nil
 }
 
 func ShouldSimulateFailure(failureRate float64) bool {
 	return rand.Float64() < failureRate
 }
 
+// simulatedFailures are the errors failure injection can produce
+var simulatedFailures = []PaymentError{
+	{
+		Code:    "INSUFFICIENT_FUNDS",
+		Message: "insufficient funds in account",
+		Type:    ErrorTypeInsufficientFunds,
+	},
+	{
+		Code:    "INVALID_CARD",
+		Message: "invalid or expired card",
+		Type:    ErrorTypeInvalidCard,
+	},
+	{
+		Code:    "NETWORK_ERROR",
+		Message: "network connection failed",
+		Type:    ErrorTypeNetworkError,
+	},
+	{
+		Code:    "PROCESSING_ERROR",
+		Message: "payment processor temporarily unavailable",
+		Type:    ErrorTypeProcessingError,
+	},
+	{
+		Code:    "TIMEOUT",
+		Message: "payment processing timeout",
+		Type:    ErrorTypeTimeout,
+	},
+}
+
 func GetRandomFailureType() PaymentError {
-	failures := []PaymentError{
-		{
-			Code:    "INSUFFICIENT_FUNDS",
-			Message: "insufficient funds in account",
-			Type:    ErrorTypeInsufficientFunds,
-		},
-		{
-			Code:    "INVALID_CARD",
-			Message: "invalid or expired card",
-			Type:    ErrorTypeInvalidCard,
-		},
-		{
-			Code:    "NETWORK_ERROR",
-			Message: "network connection failed",
-			Type:    ErrorTypeNetworkError,
-		},
-		{
-			Code:    "PROCESSING_ERROR",
-			Message: "payment processor temporarily unavailable",
-			Type:    ErrorTypeProcessingError,
-		},
-		{
-			Code:    "TIMEOUT",
-			Message: "payment processing timeout",
-			Type:    ErrorTypeTimeout,
-		},
-	}
+	return simulatedFailures[rand.Intn(len(simulatedFailures))]
+}
 
-	return failures[rand.Intn(len(failures))]
+// SimulatedFailures returns the errors failure injection can produce.
+func SimulatedFailures() []PaymentError {
+	return append([]PaymentError(nil), simulatedFailures...)
+}
+
+// FailureOfType returns the simulated failure with the given Type.
+func FailureOfType(errorType string) (PaymentError, bool) {
+	for _, failure := range simulatedFailures {
+		if failure.Type == errorType {
+			return failure, true
+		}
+	}
+	return PaymentError{}, false
 }
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+
+	"observability/billing"
+)
+
+func TestCalculateFees(t *testing.T) {
+	plans, err := billing.NewPlanRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		amount   float64
+		plan     string
+		currency string
+		want     float64
+	}{
+		{"enterprise rate", 50, "enterprise", "USD", 1.00},
+		{"enterprise rate rounded to cents", 123.45, "enterprise", "USD", 2.47},
+		{"floor", 10, "basic", "USD", MinimumFee},
+		{"floor just above rate", 14.5, "enterprise", "USD", MinimumFee},
+		{"rate in a 3-decimal currency", 12.3456, "enterprise", "BHD", 0.30},
+		{"rate above floor in a 3-decimal currency", 16.789, "enterprise", "BHD", 0.336},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CalculateFees(tt.amount, tt.plan, tt.currency, plans)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("CalculateFees(%v, %s, %s) = %v, want %v", tt.amount, tt.plan, tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownPlanRejected(t *testing.T) {
+	plans, err := billing.NewPlanRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := PaymentRequest{SubscriptionID: "sub_1", Amount: 10, Plan: "platinum"}
+	if err := ValidatePaymentPlan(req, plans); err == nil || err.(PaymentError).Code != "UNKNOWN_PLAN" {
+		t.Errorf("ValidatePaymentPlan() = %v, want UNKNOWN_PLAN", err)
+	}
+	if _, err := CalculateFees(req.Amount, req.Plan, DefaultCurrency, plans); err == nil || err.(PaymentError).Code != "UNKNOWN_PLAN" {
+		t.Errorf("CalculateFees() error = %v, want UNKNOWN_PLAN", err)
+	}
+
+	req.Plan = "enterprise"
+	if err := ValidatePaymentPlan(req, plans); err != nil {
+		t.Errorf("ValidatePaymentPlan(enterprise) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"payment-service/internal/models"
+
+	observe "observability"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const asyncPaymentTimeout = 30 * time.Second
+
+type paymentIDKey struct{}
+
+// paymentID returns the ID reserved for this payment by ProcessAsync, or a
+// fresh one.
+func paymentID(ctx context.Context) string {
+	if id, ok := ctx.Value(paymentIDKey{}).(string); ok {
+		return id
+	}
+	return models.GeneratePaymentID()
+}
+
+// ProcessAsync validates req and returns its payment ID straight away, then
+// processes it in the background and POSTs the resulting PaymentResponse to
+// req.CallbackURL. The background work runs in a new trace linked to the one
+// in ctx, since the originating request has finished by then.
+func (p *PaymentProcessor) ProcessAsync(ctx context.Context, req models.PaymentRequest) (string, error) {
+	if err := models.ValidatePaymentRequest(req); err != nil {
+		return "", err
+	}
+	if u, err := url.Parse(req.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", models.PaymentError{
+			Code:    "INVALID_CALLBACK_URL",
+			Message: "callback_url must be an absolute http(s) URL",
+			Type:    models.ErrorTypeValidation,
+		}
+	}
+	// Reject a reused key now; the background charge could only report it
+	// to the callback
+	if req.IdempotencyKey != "" {
+		if err := p.idempotency.check(req.IdempotencyKey, requestFingerprint(req)); err != nil {
+			return "", err
+		}
+	}
+
+	id := models.GeneratePaymentID()
+	link := trace.LinkFromContext(ctx, attribute.String("link.type", "async_origin"))
+
+	go func() {
+		bgCtx, cancel := context.WithTimeout(context.Background(), asyncPaymentTimeout)
+		defer cancel()
+
+		bgCtx, span := p.tracer.Start(bgCtx, "process_payment_async",
+			trace.WithNewRoot(),
+			trace.WithLinks(link),
+			trace.WithAttributes(
+				attribute.String("payment.id", id),
+				attribute.String("subscription_id", req.SubscriptionID),
+			))
+		defer span.End()
+
+		bgCtx = context.WithValue(bgCtx, paymentIDKey{}, id)
+		response, err := p.ProcessPayment(bgCtx, req)
+		if response == nil {
+			response = &models.PaymentResponse{
+				ID:          id,
+				Status:      models.StatusFailed,
+				Amount:      req.Amount,
+				Currency:    p.getCurrency(req),
+				ProcessedAt: time.Now(),
+			}
+		}
+		if err != nil {
+			span.RecordError(err)
+		}
+
+		if err := p.sendCallback(bgCtx, req.CallbackURL, response); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "callback failed")
+
+			p.logger.Error().
+				Err(err).
+				Str("payment_id", id).
+				Str("callback_url", req.CallbackURL).
+				Msg("Failed to deliver payment callback")
+			return
+		}
+
+		p.logger.Info().
+			Str("payment_id", id).
+			Str("status", response.Status).
+			Str("callback_url", req.CallbackURL).
+			Msg("Payment callback delivered")
+	}()
+
+	return id, nil
+}
+
+func (p *PaymentProcessor) sendCallback(ctx context.Context, callbackURL string, response *models.PaymentResponse) error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal callback: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create callback request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.callbackClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send callback: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("callback rejected with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func newCallbackClient() *http.Client {
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: observe.NewTracedTransport(nil),
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"payment-service/internal/config"
+	"payment-service/internal/models"
+)
+
+// FailureInjector decides whether a payment should fail on purpose, and how.
+type FailureInjector interface {
+	Inject() (models.PaymentError, bool)
+}
+
+// RandomInjector fails a Rate fraction of calls with a random simulated
+// failure. A fixed seed makes the sequence reproducible across runs.
+type RandomInjector struct {
+	rate func() float64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewRandomInjector seeds from the clock when seed is 0.
+func NewRandomInjector(rate float64, seed int64) *RandomInjector {
+	return newRandomInjector(func() float64 { return rate }, seed)
+}
+
+// newRandomInjector reads the rate on every call, so a config reload takes
+// effect without rebuilding the injector.
+func newRandomInjector(rate func() float64, seed int64) *RandomInjector {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &RandomInjector{
+		rate: rate,
+		rng:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (i *RandomInjector) Inject() (models.PaymentError, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.rng.Float64() >= i.rate() {
+		return models.PaymentError{}, false
+	}
+	failures := models.SimulatedFailures()
+	return failures[i.rng.Intn(len(failures))], true
+}
+
+// DeterministicInjector fails every Nth call with the same error, so tests
+// can force a failure at a known point.
+type DeterministicInjector struct {
+	every   uint64
+	failure models.PaymentError
+	calls   atomic.Uint64
+}
+
+// NewDeterministicInjector fails every nth call (every call when n <= 1)
+// with the simulated failure of errorType, or a processing error when
+// errorType is unknown.
+func NewDeterministicInjector(n int, errorType string) *DeterministicInjector {
+	failure, ok := models.FailureOfType(errorType)
+	if !ok {
+		failure, _ = models.FailureOfType(models.ErrorTypeProcessingError)
+	}
+	if n < 1 {
+		n = 1
+	}
+	return &DeterministicInjector{every: uint64(n), failure: failure}
+}
+
+func (i *DeterministicInjector) Inject() (models.PaymentError, bool) {
+	if i.calls.Add(1)%i.every != 0 {
+		return models.PaymentError{}, false
+	}
+	return i.failure, true
+}
+
+// newFailureInjector builds the injector described by cfg, or nil when
+// failures are disabled.
+func newFailureInjector(cfg *config.Config) FailureInjector {
+	if !cfg.EnableFailures {
+		return nil
+	}
+	if cfg.FailureMode == config.FailureModeDeterministic {
+		return NewDeterministicInjector(cfg.FailureEvery, cfg.FailureType)
+	}
+	return newRandomInjector(cfg.CurrentFailureRate, cfg.FailureSeed)
+}
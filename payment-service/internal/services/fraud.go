@@ -0,0 +1,110 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"payment-service/internal/config"
+	"payment-service/internal/models"
+)
+
+const (
+	FraudRuleRoundAmount = "round_amount"
+	FraudRuleRapidRepeat = "rapid_repeat"
+)
+
+// fraudSweepInterval is how often record drops subscriptions whose recent
+// charges have all left the window.
+const fraudSweepInterval = time.Minute
+
+// fraudDetector applies the heuristic fraud rules. It remembers recent charge
+// times per subscription to spot rapid repeats.
+type fraudDetector struct {
+	roundThreshold float64
+	window         time.Duration
+	maxCharges     int
+
+	mu        sync.Mutex
+	recent    map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newFraudDetector(cfg *config.Config) *fraudDetector {
+	return &fraudDetector{
+		roundThreshold: cfg.FraudRoundThreshold,
+		window:         cfg.FraudWindow,
+		maxCharges:     cfg.FraudMaxCharges,
+		recent:         make(map[string][]time.Time),
+		lastSweep:      time.Now(),
+	}
+}
+
+// check returns the rule req trips, if any. Only charges passed to record
+// count towards the rapid-repeat limit, so retries of failed or flagged
+// attempts are not held against the subscription.
+func (d *fraudDetector) check(req models.PaymentRequest) (string, error) {
+	if d.roundThreshold > 0 && req.Amount >= d.roundThreshold && math.Mod(req.Amount, 100) == 0 {
+		return FraudRuleRoundAmount, models.PaymentError{
+			Code:    "FRAUD_ROUND_AMOUNT",
+			Message: "large round-number charge flagged for review",
+			Type:    models.ErrorTypeFraudSuspected,
+		}
+	}
+
+	if d.window <= 0 || d.maxCharges <= 0 {
+		return "", nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.prune(req.SubscriptionID, time.Now())) >= d.maxCharges {
+		return FraudRuleRapidRepeat, models.PaymentError{
+			Code:    "FRAUD_RAPID_REPEAT",
+			Message: "too many charges for this subscription in a short period",
+			Type:    models.ErrorTypeFraudSuspected,
+		}
+	}
+
+	return "", nil
+}
+
+// record counts a completed charge for subscriptionID.
+func (d *fraudDetector) record(subscriptionID string) {
+	if d.window <= 0 || d.maxCharges <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	d.recent[subscriptionID] = append(d.prune(subscriptionID, now), now)
+
+	if now.Sub(d.lastSweep) >= fraudSweepInterval {
+		d.lastSweep = now
+		for id := range d.recent {
+			d.prune(id, now)
+		}
+	}
+}
+
+// prune drops the charges for subscriptionID that are older than the window
+// and returns the rest, deleting the entry once none are left. Callers hold
+// d.mu.
+func (d *fraudDetector) prune(subscriptionID string, now time.Time) []time.Time {
+	cutoff := now.Add(-d.window)
+	charges := d.recent[subscriptionID][:0]
+	for _, at := range d.recent[subscriptionID] {
+		if at.After(cutoff) {
+			charges = append(charges, at)
+		}
+	}
+	if len(charges) == 0 {
+		delete(d.recent, subscriptionID)
+		return nil
+	}
+	d.recent[subscriptionID] = charges
+	return charges
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payment-service/internal/config"
+	"payment-service/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+func TestFraudRapidRepeatCountsCompletedCharges(t *testing.T) {
+	cfg := &config.Config{FraudWindow: time.Minute, FraudMaxCharges: 2}
+	processor := NewPaymentProcessor(cfg, zerolog.Nop(), nil,
+		WithFailureInjector(NewDeterministicInjector(1, models.ErrorTypeTimeout)))
+	req := models.PaymentRequest{SubscriptionID: "sub_1", Amount: 10, Plan: "basic"}
+
+	// Failed attempts are retried and must not use up the limit
+	for i := 0; i < 3; i++ {
+		if _, err := processor.ProcessPayment(context.Background(), req); err == nil {
+			t.Fatal("injected failure did not fail the payment")
+		}
+	}
+
+	processor.failures = nil
+	for i := 0; i < cfg.FraudMaxCharges; i++ {
+		if _, err := processor.ProcessPayment(context.Background(), req); err != nil {
+			t.Fatalf("charge %d: %v", i+1, err)
+		}
+	}
+	_, err := processor.ProcessPayment(context.Background(), req)
+	var failure models.PaymentError
+	if !errors.As(err, &failure) || failure.Code != "FRAUD_RAPID_REPEAT" {
+		t.Fatalf("charge over the limit: error = %v, want FRAUD_RAPID_REPEAT", err)
+	}
+}
+
+func TestFraudDetectorForgetsIdleSubscriptions(t *testing.T) {
+	detector := newFraudDetector(&config.Config{FraudWindow: 10 * time.Millisecond, FraudMaxCharges: 3})
+	detector.record("sub_old")
+
+	time.Sleep(20 * time.Millisecond)
+	if rule, err := detector.check(models.PaymentRequest{SubscriptionID: "sub_old"}); err != nil {
+		t.Fatalf("check after the window = %s, %v", rule, err)
+	}
+	if _, ok := detector.recent["sub_old"]; ok {
+		t.Error("check kept a subscription with no charges in the window")
+	}
+
+	// A subscription that never charges again is dropped by the next sweep
+	detector.record("sub_idle")
+	time.Sleep(20 * time.Millisecond)
+	detector.lastSweep = time.Now().Add(-fraudSweepInterval)
+	detector.record("sub_new")
+	if _, ok := detector.recent["sub_idle"]; ok {
+		t.Error("idle subscription was not swept")
+	}
+	if len(detector.recent["sub_new"]) != 1 {
+		t.Error("new charge was not recorded")
+	}
+}
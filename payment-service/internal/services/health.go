@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// DependencyCheck is the outcome of probing one dependency.
+type DependencyCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+}
+
+// CheckResult is healthy only when every check is.
+type CheckResult struct {
+	Status string            `json:"status"`
+	Checks []DependencyCheck `json:"checks"`
+}
+
+func (r CheckResult) Healthy() bool {
+	return r.Status == HealthStatusHealthy
+}
+
+// HealthCheck probes the processor's dependencies: the (simulated) card
+// gateway and heap usage against HealthMaxHeapMB.
+func (p *PaymentProcessor) HealthCheck(ctx context.Context) CheckResult {
+	ctx, span := p.tracer.Start(ctx, "health_check")
+	defer span.End()
+
+	p.logger.Debug().Msg("Payment processor health check")
+
+	result := CheckResult{
+		Status: HealthStatusHealthy,
+		Checks: []DependencyCheck{
+			runCheck("gateway", func() error { return p.checkGateway(ctx) }),
+			runCheck("memory", p.checkMemory),
+		},
+	}
+
+	for _, check := range result.Checks {
+		span.SetAttributes(attribute.String("health."+check.Name, check.Status))
+		if check.Status != HealthStatusHealthy {
+			result.Status = HealthStatusUnhealthy
+		}
+	}
+
+	return result
+}
+
+func runCheck(name string, check func() error) DependencyCheck {
+	start := time.Now()
+	err := check()
+
+	result := DependencyCheck{
+		Name:      name,
+		Status:    HealthStatusHealthy,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = HealthStatusUnhealthy
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+// checkGateway stands in for a round trip to the card network.
+func (p *PaymentProcessor) checkGateway(ctx context.Context) error {
+	select {
+	case <-time.After(10 * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("gateway probe timed out: %w", ctx.Err())
+	}
+}
+
+func (p *PaymentProcessor) checkMemory() error {
+	if p.config.HealthMaxHeapMB <= 0 {
+		return nil
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	heapMB := stats.HeapAlloc / (1 << 20)
+	if heapMB > uint64(p.config.HealthMaxHeapMB) {
+		return fmt.Errorf("heap %dMB exceeds limit %dMB", heapMB, p.config.HealthMaxHeapMB)
+	}
+	return nil
+}
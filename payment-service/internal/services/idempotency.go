@@ -0,0 +1,122 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"payment-service/internal/models"
+)
+
+const idempotencySweepInterval = time.Minute
+
+// idempotencyEntry holds the outcome of the first request seen for a key.
+// done is closed once the outcome is known; until then expiresAt is zero and
+// duplicates wait on done instead of charging again. fingerprint identifies
+// the first request so a reused key with a different request is rejected.
+type idempotencyEntry struct {
+	fingerprint string
+	done        chan struct{}
+	response    *models.PaymentResponse
+	err         error
+	expiresAt   time.Time
+}
+
+// idempotencyCache remembers successful payments by idempotency key for ttl.
+// Failed attempts are forgotten as soon as they finish so a client retry gets
+// processed again.
+type idempotencyCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	lastSweep time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:       ttl,
+		entries:   make(map[string]*idempotencyEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// requestFingerprint hashes the fields a replay must repeat unchanged.
+func requestFingerprint(req models.PaymentRequest) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%.2f\x00%s", req.SubscriptionID, req.Amount, req.Currency)))
+	return hex.EncodeToString(sum[:])
+}
+
+// errIdempotencyMismatch rejects a key reused for a different request.
+var errIdempotencyMismatch = models.PaymentError{
+	Code:    "IDEMPOTENCY_KEY_REUSED",
+	Message: "idempotency key was already used for a different subscription or amount",
+	Type:    models.ErrorTypeIdempotencyMismatch,
+}
+
+// live returns the unexpired entry for key. Callers hold c.mu.
+func (c *idempotencyCache) live(key string, now time.Time) (*idempotencyEntry, bool) {
+	e, ok := c.entries[key]
+	if !ok || (!e.expiresAt.IsZero() && !now.Before(e.expiresAt)) {
+		return nil, false
+	}
+	return e, true
+}
+
+// acquire returns the entry for key. first is true when the caller is the
+// one that must process the payment and then call complete. A live entry
+// for a request with a different fingerprint returns errIdempotencyMismatch.
+func (c *idempotencyCache) acquire(key, fingerprint string) (entry *idempotencyEntry, first bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.live(key, time.Now()); ok {
+		if e.fingerprint != fingerprint {
+			return nil, false, errIdempotencyMismatch
+		}
+		return e, false, nil
+	}
+
+	e := &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{})}
+	c.entries[key] = e
+	return e, true, nil
+}
+
+// check returns errIdempotencyMismatch if key is live for a request with a
+// different fingerprint, without claiming the key.
+func (c *idempotencyCache) check(key, fingerprint string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.live(key, time.Now()); ok && e.fingerprint != fingerprint {
+		return errIdempotencyMismatch
+	}
+	return nil
+}
+
+func (c *idempotencyCache) complete(key string, e *idempotencyEntry, response *models.PaymentResponse, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	e.response, e.err = response, err
+	if err != nil {
+		if c.entries[key] == e {
+			delete(c.entries, key)
+		}
+	} else {
+		e.expiresAt = now.Add(c.ttl)
+	}
+	close(e.done)
+
+	if now.Sub(c.lastSweep) >= idempotencySweepInterval {
+		for k, entry := range c.entries {
+			if !entry.expiresAt.IsZero() && now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+}
@@ -3,10 +3,15 @@ package services
 import (
 	"context"
 	"math/rand"
+	"net/http"
 	"payment-service/internal/config"
 	"payment-service/internal/models"
+	"sync"
 	"time"
 
+	observe "observability"
+	"observability/billing"
+
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -14,19 +19,74 @@ import (
 )
 
 type PaymentProcessor struct {
-	config *config.Config
-	logger zerolog.Logger
-	tracer trace.Tracer
+	config      *config.Config
+	logger      zerolog.Logger
+	tracer      trace.Tracer
+	metrics     *observe.Metrics
+	idempotency *idempotencyCache
+	plans       *billing.PlanRegistry
+	failures    FailureInjector
+	fraud       *fraudDetector
+
+	callbackClient *http.Client
+
+	refundWindow time.Duration
+	paymentsMu   sync.Mutex
+	payments     map[string]*paymentRecord
+	lastSweep    time.Time // of payments, guarded by paymentsMu
 }
 
-func NewPaymentProcessor(cfg *config.Config, logger zerolog.Logger) *PaymentProcessor {
-	return &PaymentProcessor{
-		config: cfg,
-		logger: logger,
-		tracer: otel.Tracer("payment-processor"),
+// ProcessorOption customizes a PaymentProcessor beyond what config covers.
+type ProcessorOption func(*PaymentProcessor)
+
+// WithFailureInjector replaces the injector built from config; nil disables
+// simulated failures.
+func WithFailureInjector(injector FailureInjector) ProcessorOption {
+	return func(p *PaymentProcessor) {
+		p.failures = injector
 	}
 }
 
+// NewPaymentProcessor creates a processor. metrics may be nil, in which case
+// processing durations are not recorded.
+func NewPaymentProcessor(cfg *config.Config, logger zerolog.Logger, metrics *observe.Metrics, opts ...ProcessorOption) *PaymentProcessor {
+	p := &PaymentProcessor{
+		config:      cfg,
+		logger:      logger,
+		tracer:      otel.Tracer("payment-processor"),
+		metrics:     metrics,
+		idempotency: newIdempotencyCache(cfg.IdempotencyTTL),
+		plans:       planRegistry(cfg, logger),
+		failures:    newFailureInjector(cfg),
+		fraud:       newFraudDetector(cfg),
+		payments:    make(map[string]*paymentRecord),
+		lastSweep:   time.Now(),
+
+		callbackClient: newCallbackClient(),
+		refundWindow:   cfg.RefundWindow,
+	}
+	// Zero uses the default rather than keeping payments for ever
+	if p.refundWindow <= 0 {
+		p.refundWindow = defaultRefundWindow
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Plans returns the plans the processor accepts.
+func (p *PaymentProcessor) Plans() *billing.PlanRegistry {
+	return p.plans
+}
+
+// ProcessPayment charges req. Requests carrying an IdempotencyKey are charged
+// at most once: a replay of a successful payment returns the cached response,
+// and a duplicate arriving while the first is still in flight waits for its
+// outcome. Reusing a key for a different subscription, amount or currency
+// fails with ErrorTypeIdempotencyMismatch.
 func (p *PaymentProcessor) ProcessPayment(ctx context.Context, req models.PaymentRequest) (*models.PaymentResponse, error) {
 	ctx, span := p.tracer.Start(ctx, "process_payment",
 		trace.WithAttributes(
@@ -36,13 +96,64 @@ func (p *PaymentProcessor) ProcessPayment(ctx context.Context, req models.Paymen
 		))
 	defer span.End()
 
+	if req.IdempotencyKey == "" {
+		return p.process(ctx, span, req)
+	}
+
+	entry, first, err := p.idempotency.acquire(req.IdempotencyKey, requestFingerprint(req))
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", models.ErrorTypeIdempotencyMismatch))
+		return nil, err
+	}
+	if first {
+		response, err := p.process(ctx, span, req)
+		p.idempotency.complete(req.IdempotencyKey, entry, response, err)
+		return response, err
+	}
+
+	select {
+	case <-entry.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	span.SetAttributes(attribute.Bool("payment.idempotent_replay", true))
+
+	p.logger.Info().
+		Str("subscription_id", req.SubscriptionID).
+		Str("idempotency_key", req.IdempotencyKey).
+		Bool("failed", entry.err != nil).
+		Msg("Replaying payment result for idempotency key")
+
+	return entry.response, entry.err
+}
+
+func (p *PaymentProcessor) process(ctx context.Context, span trace.Span, req models.PaymentRequest) (*models.PaymentResponse, error) {
+	// Split by outcome: failures skip the extra delay, so their latency
+	// distribution differs from successful payments
+	start := time.Now()
+	status := models.StatusFailed
+	defer func() {
+		if p.metrics != nil {
+			p.metrics.PaymentDuration.WithLabelValues(req.Plan, status).Observe(time.Since(start).Seconds())
+		}
+	}()
+
 	p.logger.Info().
 		Str("subscription_id", req.SubscriptionID).
 		Str("plan", req.Plan).
 		Float64("amount", req.Amount).
 		Msg("Processing payment request")
 
-	if err := models.ValidatePaymentRequest(req); err != nil {
+	err := models.ValidatePaymentRequest(req)
+	if err == nil {
+		err = models.ValidatePaymentPlan(req, p.plans)
+	}
+	if err == nil {
+		err = models.ValidatePaymentLimits(req, p.config.MaxAmount)
+	}
+	if err != nil {
 		p.logger.Error().
 			Err(err).
 			Str("subscription_id", req.SubscriptionID).
@@ -50,20 +161,43 @@ func (p *PaymentProcessor) ProcessPayment(ctx context.Context, req models.Paymen
 
 		span.RecordError(err)
 		span.SetAttributes(attribute.String("error.type", "validation"))
+		status = "invalid"
+		return nil, err
+	}
+
+	req.Currency = p.getCurrency(req)
+	req.Amount = models.NormalizeAmount(req.Amount, req.Currency)
+
+	if rule, err := p.fraud.check(req); err != nil {
+		p.logger.Warn().
+			Err(err).
+			Str("subscription_id", req.SubscriptionID).
+			Str("fraud_rule", rule).
+			Float64("amount", req.Amount).
+			Msg("Payment flagged as suspected fraud")
+
+		span.RecordError(err)
+		span.SetAttributes(
+			attribute.Bool("payment.fraud_suspected", true),
+			attribute.String("payment.fraud_rule", rule),
+		)
+		if p.metrics != nil {
+			p.metrics.FraudFlagsTotal.WithLabelValues(rule).Inc()
+		}
+		status = "fraud"
 		return nil, err
 	}
 
 	if p.config.ProcessingDelay > 0 {
-		p.logger.Debug().
+		logger := observe.SampledLevel(ctx, p.logger)
+		logger.Debug().
 			Dur("delay", p.config.ProcessingDelay).
 			Msg("Simulating processing delay")
 
 		time.Sleep(p.config.ProcessingDelay)
 	}
 
-	if p.config.EnableFailures && models.ShouldSimulateFailure(p.config.FailureRate) {
-		failure := models.GetRandomFailureType()
-
+	if failure, ok := p.injectFailure(); ok {
 		p.logger.Warn().
 			Str("failure_type", failure.Type).
 			Str("failure_code", failure.Code).
@@ -77,7 +211,7 @@ func (p *PaymentProcessor) ProcessPayment(ctx context.Context, req models.Paymen
 		)
 
 		return &models.PaymentResponse{
-			ID:          models.GeneratePaymentID(),
+			ID:          paymentID(ctx),
 			Status:      models.StatusFailed,
 			Amount:      req.Amount,
 			Currency:    p.getCurrency(req),
@@ -85,13 +219,20 @@ func (p *PaymentProcessor) ProcessPayment(ctx context.Context, req models.Paymen
 		}, failure
 	}
 
+	fees, err := models.CalculateFees(req.Amount, req.Plan, req.Currency, p.plans)
+	if err != nil {
+		span.RecordError(err)
+		status = "invalid"
+		return nil, err
+	}
+
 	response := &models.PaymentResponse{
-		ID:          models.GeneratePaymentID(),
+		ID:          paymentID(ctx),
 		Status:      models.StatusCompleted,
 		Amount:      req.Amount,
 		Currency:    p.getCurrency(req),
 		ProcessedAt: time.Now(),
-		Fees:        models.CalculateFees(req.Amount, req.Plan),
+		Fees:        fees,
 	}
 
 	if rand.Float64() < 0.1 {
@@ -101,6 +242,8 @@ func (p *PaymentProcessor) ProcessPayment(ctx context.Context, req models.Paymen
 		span.SetAttributes(attribute.Int64("processing.extra_delay_ms", extraDelay.Milliseconds()))
 	}
 
+	status = response.Status
+
 	p.logger.Info().
 		Str("payment_id", response.ID).
 		Str("subscription_id", req.SubscriptionID).
@@ -115,23 +258,30 @@ func (p *PaymentProcessor) ProcessPayment(ctx context.Context, req models.Paymen
 		attribute.Float64("payment.fees", response.Fees),
 	)
 
+	p.recordPayment(response)
+	p.fraud.record(req.SubscriptionID)
+
 	return response, nil
 }
 
-func (p *PaymentProcessor) getCurrency(req models.PaymentRequest) string {
-	if req.Currency != "" {
-		return req.Currency
+func (p *PaymentProcessor) injectFailure() (models.PaymentError, bool) {
+	if p.failures == nil {
+		return models.PaymentError{}, false
 	}
-	return "USD"
+	return p.failures.Inject()
 }
 
-func (p *PaymentProcessor) HealthCheck(ctx context.Context) error {
-	_, span := p.tracer.Start(ctx, "health_check")
-	defer span.End()
-
-	p.logger.Debug().Msg("Payment processor health check")
-
-	time.Sleep(10 * time.Millisecond)
+// planRegistry uses the configured plans, or the default plans when they are
+// invalid, which Validate reports at startup.
+func planRegistry(cfg *config.Config, logger zerolog.Logger) *billing.PlanRegistry {
+	plans, err := cfg.PlanRegistry()
+	if err != nil {
+		logger.Error().Err(err).Msg("Invalid plan configuration, using default plans")
+		plans, _ = billing.NewPlanRegistry(nil)
+	}
+	return plans
+}
 
-	return nil
+func (p *PaymentProcessor) getCurrency(req models.PaymentRequest) string {
+	return models.NormalizeCurrency(req.Currency)
 }
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"payment-service/internal/config"
+	"payment-service/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+func TestProcessPaymentDeterministicFailure(t *testing.T) {
+	cfg := &config.Config{IdempotencyTTL: time.Hour}
+	processor := NewPaymentProcessor(cfg, zerolog.Nop(), nil,
+		WithFailureInjector(NewDeterministicInjector(3, models.ErrorTypeTimeout)))
+
+	for call := 1; call <= 6; call++ {
+		response, err := processor.ProcessPayment(context.Background(), models.PaymentRequest{
+			SubscriptionID: fmt.Sprintf("sub_%d", call),
+			Amount:         10,
+			Plan:           "basic",
+		})
+
+		if call%3 != 0 {
+			if err != nil {
+				t.Fatalf("call %d: unexpected error %v", call, err)
+			}
+			if response.Status != models.StatusCompleted {
+				t.Errorf("call %d: status = %s, want %s", call, response.Status, models.StatusCompleted)
+			}
+			continue
+		}
+
+		var failure models.PaymentError
+		if !errors.As(err, &failure) {
+			t.Fatalf("call %d: error = %v, want a PaymentError", call, err)
+		}
+		if failure.Type != models.ErrorTypeTimeout {
+			t.Errorf("call %d: failure type = %s, want %s", call, failure.Type, models.ErrorTypeTimeout)
+		}
+		if response == nil || response.Status != models.StatusFailed {
+			t.Errorf("call %d: response = %+v, want a failed payment", call, response)
+		}
+	}
+}
+
+func TestProcessPaymentIdempotencyMismatch(t *testing.T) {
+	processor := NewPaymentProcessor(&config.Config{IdempotencyTTL: time.Hour}, zerolog.Nop(), nil)
+	req := models.PaymentRequest{SubscriptionID: "sub_1", Amount: 10, Plan: "basic", IdempotencyKey: "key_1"}
+
+	first, err := processor.ProcessPayment(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := processor.ProcessPayment(context.Background(), req)
+	if err != nil || replay.ID != first.ID {
+		t.Fatalf("replay = %v, %v; want the first payment %s", replay, err, first.ID)
+	}
+
+	for name, changed := range map[string]models.PaymentRequest{
+		"subscription": {SubscriptionID: "sub_2", Amount: 10, Plan: "basic", IdempotencyKey: "key_1"},
+		"amount":       {SubscriptionID: "sub_1", Amount: 20, Plan: "basic", IdempotencyKey: "key_1"},
+	} {
+		_, err := processor.ProcessPayment(context.Background(), changed)
+		var failure models.PaymentError
+		if !errors.As(err, &failure) || failure.Type != models.ErrorTypeIdempotencyMismatch {
+			t.Errorf("different %s: error = %v, want %s", name, err, models.ErrorTypeIdempotencyMismatch)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"payment-service/internal/models"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultRefundWindow  = 30 * 24 * time.Hour
+	paymentSweepInterval = time.Minute
+)
+
+// paymentRecord tracks how much of a completed payment has been refunded.
+type paymentRecord struct {
+	amount    float64
+	refunded  float64
+	expiresAt time.Time
+}
+
+// recordPayment makes a completed payment refundable for the refund window.
+// Expired records are swept at most once per paymentSweepInterval, which
+// bounds the map by the payments taken within one window.
+func (p *PaymentProcessor) recordPayment(response *models.PaymentResponse) {
+	p.paymentsMu.Lock()
+	defer p.paymentsMu.Unlock()
+
+	now := time.Now()
+	p.payments[response.ID] = &paymentRecord{amount: response.Amount, expiresAt: now.Add(p.refundWindow)}
+
+	if now.Sub(p.lastSweep) >= paymentSweepInterval {
+		for id, record := range p.payments {
+			if now.After(record.expiresAt) {
+				delete(p.payments, id)
+			}
+		}
+		p.lastSweep = now
+	}
+}
+
+// Refund returns up to the unrefunded remainder of a completed payment.
+// Payments are only known to the processor that took them, are lost on
+// restart and can no longer be refunded once the refund window has passed.
+func (p *PaymentProcessor) Refund(ctx context.Context, req models.RefundRequest) (*models.RefundResponse, error) {
+	if req.Reason == "" {
+		req.Reason = models.RefundReasonRequested
+	}
+
+	_, span := p.tracer.Start(ctx, "refund_payment",
+		trace.WithAttributes(
+			attribute.String("payment.id", req.PaymentID),
+			attribute.Float64("refund.amount", req.Amount),
+			attribute.String("refund.reason", req.Reason),
+		))
+	defer span.End()
+
+	p.logger.Info().
+		Str("payment_id", req.PaymentID).
+		Float64("amount", req.Amount).
+		Str("reason", req.Reason).
+		Msg("Processing refund request")
+
+	if err := models.ValidateRefundRequest(req); err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "validation"))
+		return nil, err
+	}
+
+	p.paymentsMu.Lock()
+	record, ok := p.payments[req.PaymentID]
+	if !ok || time.Now().After(record.expiresAt) {
+		p.paymentsMu.Unlock()
+		err := models.PaymentError{
+			Code:    "PAYMENT_NOT_FOUND",
+			Message: fmt.Sprintf("payment %s not found", req.PaymentID),
+			Type:    models.ErrorTypeNotFound,
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", err.Type))
+		return nil, err
+	}
+	remaining := record.amount - record.refunded
+	// Allow for float rounding when refunding the exact remainder
+	if req.Amount > remaining+0.005 {
+		p.paymentsMu.Unlock()
+		err := models.PaymentError{
+			Code:    "REFUND_EXCEEDS_PAYMENT",
+			Message: fmt.Sprintf("refund of %.2f exceeds refundable amount %.2f", req.Amount, remaining),
+			Type:    models.ErrorTypeValidation,
+		}
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("error.type", "validation"))
+		return nil, err
+	}
+	record.refunded += req.Amount
+	totalRefunded := record.refunded
+	fullyRefunded := record.refunded >= record.amount-0.005
+	p.paymentsMu.Unlock()
+
+	response := &models.RefundResponse{
+		ID:            models.GenerateRefundID(),
+		PaymentID:     req.PaymentID,
+		Status:        models.StatusPartiallyRefunded,
+		Amount:        req.Amount,
+		TotalRefunded: totalRefunded,
+		Reason:        req.Reason,
+		ProcessedAt:   time.Now(),
+	}
+	if fullyRefunded {
+		response.Status = models.StatusRefunded
+	}
+
+	if p.metrics != nil {
+		p.metrics.RefundsTotal.WithLabelValues(req.Reason).Inc()
+	}
+
+	p.logger.Info().
+		Str("refund_id", response.ID).
+		Str("payment_id", req.PaymentID).
+		Str("status", response.Status).
+		Float64("amount", response.Amount).
+		Float64("total_refunded", totalRefunded).
+		Msg("Refund processed successfully")
+
+	span.SetAttributes(
+		attribute.String("refund.id", response.ID),
+		attribute.String("refund.status", response.Status),
+		attribute.Float64("refund.total_refunded", totalRefunded),
+	)
+
+	return response, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"payment-service/internal/config"
+	"payment-service/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRefundWindowExpiry(t *testing.T) {
+	processor := NewPaymentProcessor(&config.Config{RefundWindow: 20 * time.Millisecond}, zerolog.Nop(), nil)
+	processor.recordPayment(&models.PaymentResponse{ID: "pay_old", Amount: 10})
+
+	if _, err := processor.Refund(context.Background(), models.RefundRequest{PaymentID: "pay_old", Amount: 4}); err != nil {
+		t.Fatalf("refund within the window: %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	_, err := processor.Refund(context.Background(), models.RefundRequest{PaymentID: "pay_old", Amount: 1})
+	var paymentErr models.PaymentError
+	if !errors.As(err, &paymentErr) || paymentErr.Type != models.ErrorTypeNotFound {
+		t.Fatalf("refund after the window: error = %v, want %s", err, models.ErrorTypeNotFound)
+	}
+
+	// The next payment after a sweep interval drops the expired record
+	processor.lastSweep = time.Now().Add(-paymentSweepInterval)
+	processor.recordPayment(&models.PaymentResponse{ID: "pay_new", Amount: 10})
+	if _, ok := processor.payments["pay_old"]; ok {
+		t.Error("expired payment was not swept")
+	}
+	if _, ok := processor.payments["pay_new"]; !ok {
+		t.Error("new payment was not recorded")
+	}
+}
+
+func TestRefundExceedsPayment(t *testing.T) {
+	processor := NewPaymentProcessor(&config.Config{}, zerolog.Nop(), nil)
+	processor.recordPayment(&models.PaymentResponse{ID: "pay_1", Amount: 10})
+
+	_, err := processor.Refund(context.Background(), models.RefundRequest{PaymentID: "pay_1", Amount: 10.5})
+	var paymentErr models.PaymentError
+	if !errors.As(err, &paymentErr) || paymentErr.Type != models.ErrorTypeValidation {
+		t.Fatalf("error = %v, want %s", err, models.ErrorTypeValidation)
+	}
+	if paymentErr.Code != "REFUND_EXCEEDS_PAYMENT" {
+		t.Errorf("code = %s, want REFUND_EXCEEDS_PAYMENT", paymentErr.Code)
+	}
+}
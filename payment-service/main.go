@@ -14,35 +14,86 @@ import (
 
 	observe "observability"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
-	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func main() {
-	cfg := config.NewConfig()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
 
-	logger := initLogger(cfg)
+	logger, closeLogs := initLogger(cfg)
 
-	tp := initTracing(cfg, logger)
-	defer shutdownTracing(tp, logger)
+	shutdownTracing := initTracing(cfg, logger)
 
 	metrics := initMetrics(logger)
 
-	processor := services.NewPaymentProcessor(cfg, logger)
+	processor := services.NewPaymentProcessor(cfg, logger, metrics)
 
 	deps := handlers.NewDependencies(cfg, logger, processor, metrics)
 
-	registerRoutes(deps)
+	observe.NewErrorResponseCounter("payment_service", nil)
+	deps.Recover = observe.RecoverMiddleware(logger, observe.NewPanicCounter("payment_service", nil))
+	deps.AccessLog = observe.AccessLogMiddleware(logger, nil)
+	deps.RateLimit = observe.RateLimitMiddleware(observe.RateLimitConfig{
+		ServiceName:       "payment_service",
+		RequestsPerSecond: cfg.RateLimitRPS,
+		Burst:             cfg.RateLimitBurst,
+	})
+
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	cfg.Watch(reloadCtx, configReloadHandler(logger, observe.NewConfigReloadCounter("payment_service", nil), cfg))
+
+	mux := http.NewServeMux()
+	handler := registerRoutes(mux, deps)
 
 	logger.Info().
 		Str("port", cfg.Port).
 		Msg("Starting payment service server")
 
-	log.Fatal(http.ListenAndServe(":"+cfg.Port, nil))
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: handler}
+	err = observe.RunServer(server,
+		func(context.Context) error {
+			stopReload()
+			return nil
+		},
+		shutdownTracing,
+		closeLogs,
+	)
+	if err != nil {
+		logger.Error().Err(err).Msg("Payment service stopped with errors")
+		return
+	}
+
+	logger.Info().Msg("Payment service stopped")
+}
+
+// configReloadHandler logs and counts each SIGHUP config reload.
+func configReloadHandler(logger zerolog.Logger, reloads *prometheus.CounterVec, cfg *config.Config) func(error) {
+	return func(err error) {
+		if err != nil {
+			reloads.WithLabelValues("failure").Inc()
+			logger.Error().Err(err).Msg("Config reload failed, keeping current values")
+			return
+		}
+
+		reloads.WithLabelValues("success").Inc()
+		logger.Info().
+			Float64("sample_ratio", cfg.CurrentSampleRatio()).
+			Float64("failure_rate", cfg.CurrentFailureRate()).
+			Msg("Config reloaded")
+	}
 }
 
-func initLogger(cfg *config.Config) zerolog.Logger {
+// initLogger returns the logger and a function that flushes and closes the
+// Logstash writer, if one was created.
+func initLogger(cfg *config.Config) (zerolog.Logger, func(context.Context) error) {
 	consoleWriter := zerolog.ConsoleWriter{
 		Out:        os.Stdout,
 		TimeFormat: time.RFC3339,
@@ -52,24 +103,34 @@ func initLogger(cfg *config.Config) zerolog.Logger {
 	var writers []io.Writer
 	writers = append(writers, consoleWriter)
 
+	closeLogs := func(context.Context) error { return nil }
+
 	if cfg.LoggingEnabled {
 		logstashWriter, err := observe.NewLogWriter(observe.LogConfig{
-			Host: cfg.LogstashHost,
+			Host:        cfg.LogstashHost,
+			ServiceName: "payment_service",
 		}, func(err error) {
 			log.Printf("Logstash error: %v", err)
 		})
 		if err == nil {
+			logstashWriter.RegisterMetrics(nil)
 			writers = append(writers, logstashWriter)
+			closeLogs = func(context.Context) error { return logstashWriter.Close() }
 		}
 	}
 
+	// TraceHook adds trace_id and span_id to events from loggers derived
+	// with observe.Ctx(logger, r.Context()), so request code can log without
+	// LogWithTrace. Loggers without a context are unaffected.
 	logger := zerolog.New(zerolog.MultiLevelWriter(writers...)).
 		With().
 		Timestamp().
 		Caller().
 		Str("service", "payment-service").
 		Logger().
-		Level(zerolog.DebugLevel)
+		Hook(observe.TraceHook{})
+	// The level is global so /debug/loglevel can change it at runtime
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 
 	logger.Info().
 		Bool("metrics_enabled", cfg.MetricsEnabled).
@@ -77,52 +138,79 @@ func initLogger(cfg *config.Config) zerolog.Logger {
 		Bool("logging_enabled", cfg.LoggingEnabled).
 		Msg("Logger initialized")
 
-	return logger
+	return logger, closeLogs
 }
 
-func initTracing(cfg *config.Config, logger zerolog.Logger) *tracesdk.TracerProvider {
+func initTracing(cfg *config.Config, logger zerolog.Logger) func(context.Context) error {
 	if !cfg.TracingEnabled {
 		logger.Info().Msg("Tracing disabled")
 		return nil
 	}
 
-	tp, err := observe.InitTracer(observe.TracerConfig{
+	_, shutdown, err := observe.InitTracer(observe.TracerConfig{
 		ServiceName:    "payment-service",
 		JaegerEndpoint: cfg.JaegerEndpoint,
-		SampleRatio:    1.0,
+		Exporter:       cfg.TraceExporter,
+		OTLPEndpoint:   cfg.OTLPEndpoint,
+		SampleRatio:    cfg.SampleRatio,
+		// Read on every decision so a SIGHUP reload applies immediately
+		SampleRatioFunc: cfg.CurrentSampleRatio,
 	})
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to initialize tracer")
 	}
 
 	logger.Info().Msg("Tracer initialized")
-	return tp
-}
-
-func shutdownTracing(tp *tracesdk.TracerProvider, logger zerolog.Logger) {
-	if tp == nil {
-		return
-	}
-	
-	if err := tp.Shutdown(context.Background()); err != nil {
-		logger.Error().Err(err).Msg("Error shutting down tracer provider")
-	}
+	return shutdown
 }
 
 func initMetrics(logger zerolog.Logger) *observe.Metrics {
 	metrics := observe.NewMetrics(observe.MetricsConfig{
-		ServiceName: "payment_service",
-		Registry:    nil, // Use default registry
+		ServiceName:      "payment_service",
+		Registry:         nil, // Use default registry
+		ErrorsByEndpoint: true,
 	})
+	observe.RegisterRuntimeMetrics(nil)
 
 	logger.Info().Msg("Metrics initialized")
 	return metrics
 }
 
-func registerRoutes(deps *handlers.Dependencies) {
-	http.Handle("/metrics", promhttp.Handler())
-	
-	handlers.RegisterRoutes(deps)
+// registerRoutes registers every route on mux and returns the handler to
+// serve: mux itself, or mux behind CORS when origins are configured.
+func registerRoutes(mux *http.ServeMux, deps *handlers.Dependencies) http.Handler {
+	metricsAuth := observe.MetricsAuthConfig{
+		BearerToken:  deps.Config.MetricsBearerToken,
+		AllowedCIDRs: deps.Config.MetricsAllowedCIDRs,
+	}
+	metricsHandler, err := observe.SecureMetricsHandler(promhttp.Handler(), metricsAuth)
+	if err != nil {
+		deps.Logger.Fatal().Err(err).Msg("Invalid metrics auth configuration")
+	}
+	mux.Handle("/metrics", metricsHandler)
+
+	// Operator endpoints share the /metrics credentials and are only served
+	// when some are configured, since anyone could use them otherwise
+	if metricsAuth.Enabled() {
+		logLevelHandler, err := observe.SecureMetricsHandler(observe.LogLevelHandler(deps.Logger), metricsAuth)
+		if err != nil {
+			deps.Logger.Fatal().Err(err).Msg("Invalid metrics auth configuration")
+		}
+		mux.Handle("/debug/loglevel", logLevelHandler)
+	}
+	if err := observe.RegisterPprof(mux, deps.Config.PprofEnabled, metricsAuth); err != nil {
+		deps.Logger.Fatal().Err(err).Msg("Invalid pprof configuration")
+	}
+
+	handlers.RegisterRoutes(mux, deps)
 
 	deps.Logger.Info().Msg("All routes registered")
+
+	if len(deps.Config.CORSAllowedOrigins) == 0 {
+		return mux
+	}
+	return observe.CORSMiddleware(observe.CORSConfig{
+		AllowedOrigins: deps.Config.CORSAllowedOrigins,
+		MaxAge:         600,
+	})(mux.ServeHTTP)
 }
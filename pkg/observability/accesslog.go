@@ -0,0 +1,51 @@
+package observability
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// AccessLogLevel logs server errors at Error, client errors at Warn and
+// everything else at Info.
+func AccessLogLevel(status int) zerolog.Level {
+	switch {
+	case status >= 500:
+		return zerolog.ErrorLevel
+	case status >= 400:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.InfoLevel
+	}
+}
+
+// AccessLogMiddleware writes one line per request with the method, path,
+// status, response bytes and duration, plus the trace and request IDs that
+// LogWithTrace adds. level picks the level from the status and defaults to
+// AccessLogLevel when nil. Place it inside the tracing and request ID
+// middleware so both IDs are in the context.
+func AccessLogMiddleware(logger zerolog.Logger, level func(status int) zerolog.Level) Middleware {
+	if level == nil {
+		level = AccessLogLevel
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrapped := &responseWrapperV3{ResponseWriter: w, statusCode: http.StatusOK}
+
+			next(wrapped, r)
+
+			requestLogger := LogWithTrace(r.Context(), logger)
+			requestLogger.WithLevel(level(wrapped.statusCode)).
+				Str("method", r.Method).
+				Str("path", r.URL.Path).
+				Int("status", wrapped.statusCode).
+				Int("bytes", wrapped.bytesWritten).
+				Dur("duration_ms", time.Since(start)).
+				Str("client_ip", r.RemoteAddr).
+				Msg("Request handled")
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package observability
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Identity is the caller as established by a Verifier.
+type Identity struct {
+	UserID   string
+	TenantID string
+	Roles    []string
+}
+
+// RoleAdmin lets a caller use operator endpoints such as bulk imports.
+const RoleAdmin = "admin"
+
+// HasRole reports whether the identity was granted role.
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier checks a bearer token and returns who it belongs to.
+type Verifier interface {
+	Verify(token string) (Identity, error)
+}
+
+// HMACVerifier accepts HS256-signed JWTs. The user comes from the user_id
+// claim, or sub when that is absent, the tenant from tenant_id and the roles
+// from roles. exp and nbf are enforced when present. It is meant for the
+// workshop; use a JWKS-backed Verifier against a real identity provider.
+type HMACVerifier struct {
+	secret []byte
+}
+
+func NewHMACVerifier(secret []byte) *HMACVerifier {
+	return &HMACVerifier{secret: secret}
+}
+
+func (v *HMACVerifier) Verify(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return Identity{}, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return Identity{}, ErrInvalidToken
+	}
+
+	var claims struct {
+		Subject   string   `json:"sub"`
+		UserID    string   `json:"user_id"`
+		TenantID  string   `json:"tenant_id"`
+		Roles     []string `json:"roles"`
+		ExpiresAt int64    `json:"exp"`
+		NotBefore int64    `json:"nbf"`
+	}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt != 0 && now >= claims.ExpiresAt {
+		return Identity{}, ErrInvalidToken
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return Identity{}, ErrInvalidToken
+	}
+
+	identity := Identity{UserID: claims.UserID, TenantID: claims.TenantID, Roles: claims.Roles}
+	if identity.UserID == "" {
+		identity.UserID = claims.Subject
+	}
+	if identity.UserID == "" {
+		return Identity{}, ErrInvalidToken
+	}
+	return identity, nil
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity AuthMiddleware verified for the
+// request.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+type AuthConfig struct {
+	Verifier Verifier
+	// Tracing, when set, receives the identity through AddBusinessContext so
+	// it travels to downstream services as baggage.
+	Tracing *TracingV3
+}
+
+// AuthMiddleware requires an "Authorization: Bearer <token>" header that
+// Verifier accepts, answering 401 otherwise. The verified identity is stored
+// in the context, added to the current span and baggage, and replaces any
+// client-sent X-User-ID and X-Tenant-ID headers so code that reads those
+// sees the trusted values.
+func AuthMiddleware(cfg AuthConfig) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				span.SetAttributes(attribute.Bool("auth.verified", false))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				WriteError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid bearer token")
+				return
+			}
+
+			identity, err := cfg.Verifier.Verify(token)
+			if err != nil {
+				span.SetAttributes(attribute.Bool("auth.verified", false))
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+				WriteError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid bearer token")
+				return
+			}
+
+			span.SetAttributes(
+				attribute.Bool("auth.verified", true),
+				attribute.String("user.id", identity.UserID),
+			)
+			if identity.TenantID != "" {
+				span.SetAttributes(attribute.String("tenant.id", identity.TenantID))
+			}
+
+			ctx := context.WithValue(r.Context(), identityKey{}, identity)
+			if cfg.Tracing != nil {
+				ctx = cfg.Tracing.AddBusinessContext(ctx, identity.UserID, identity.TenantID, "")
+			}
+
+			r = r.WithContext(ctx)
+			r.Header = r.Header.Clone()
+			r.Header.Set("X-User-ID", identity.UserID)
+			if identity.TenantID != "" {
+				r.Header.Set("X-Tenant-ID", identity.TenantID)
+			} else {
+				r.Header.Del("X-Tenant-ID")
+			}
+
+			next(w, r)
+		}
+	}
+}
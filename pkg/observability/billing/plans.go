@@ -0,0 +1,122 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Plan is a subscription plan as both services see it: the subscription
+// service charges PriceCents, and the payment service takes FeeRate of each
+// charge as its processing fee.
+type Plan struct {
+	Name       string   `yaml:"name" json:"name"`
+	PriceCents int64    `yaml:"price_cents" json:"price_cents"`
+	FeeRate    float64  `yaml:"fee_rate" json:"fee_rate"`
+	Features   []string `yaml:"features" json:"features,omitempty"`
+}
+
+// Price returns PriceCents in major currency units.
+func (p Plan) Price() float64 {
+	return float64(p.PriceCents) / 100
+}
+
+func (p Plan) validate() error {
+	if p.Name == "" {
+		return errors.New("plan name must not be empty")
+	}
+	if p.PriceCents <= 0 {
+		return fmt.Errorf("plan %s: price must be positive", p.Name)
+	}
+	if p.FeeRate < 0 || p.FeeRate > 1 {
+		return fmt.Errorf("plan %s: fee rate %v is outside 0-1", p.Name, p.FeeRate)
+	}
+	return nil
+}
+
+// DefaultPlans are used when no plans are configured.
+func DefaultPlans() []Plan {
+	return []Plan{
+		{Name: "basic", PriceCents: 1000, FeeRate: 0.029, Features: []string{"email_support"}},
+		{Name: "premium", PriceCents: 2000, FeeRate: 0.025, Features: []string{"email_support", "priority_support", "analytics"}},
+		{Name: "enterprise", PriceCents: 5000, FeeRate: 0.02, Features: []string{"email_support", "priority_support", "analytics", "sso", "sla"}},
+	}
+}
+
+// PlanRegistry holds the plans a deployment sells. It is safe for concurrent
+// use.
+type PlanRegistry struct {
+	mu    sync.RWMutex
+	plans map[string]Plan
+}
+
+// NewPlanRegistry registers plans, or DefaultPlans when plans is empty, and
+// reports every invalid or duplicated plan at once.
+func NewPlanRegistry(plans []Plan) (*PlanRegistry, error) {
+	if len(plans) == 0 {
+		plans = DefaultPlans()
+	}
+
+	r := &PlanRegistry{plans: make(map[string]Plan, len(plans))}
+
+	var errs []error
+	for _, plan := range plans {
+		if _, exists := r.plans[plan.Name]; exists {
+			errs = append(errs, fmt.Errorf("plan %s: defined more than once", plan.Name))
+			continue
+		}
+		if err := r.Register(plan); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Register adds plan, replacing any plan with the same name.
+func (r *PlanRegistry) Register(plan Plan) error {
+	if err := plan.validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.plans[plan.Name] = plan
+	return nil
+}
+
+func (r *PlanRegistry) Lookup(name string) (Plan, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	plan, ok := r.plans[name]
+	return plan, ok
+}
+
+func (r *PlanRegistry) IsValid(name string) bool {
+	_, ok := r.Lookup(name)
+	return ok
+}
+
+// Price returns the plan's price in major currency units, or 0 for an
+// unknown plan; check IsValid first.
+func (r *PlanRegistry) Price(name string) float64 {
+	plan, _ := r.Lookup(name)
+	return plan.Price()
+}
+
+// Names returns the registered plan names in sorted order.
+func (r *PlanRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.plans))
+	for name := range r.plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
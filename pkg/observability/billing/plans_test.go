@@ -0,0 +1,76 @@
+package billing
+
+import "testing"
+
+func TestDefaultPlansPriced(t *testing.T) {
+	plans, err := NewPlanRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]float64{"basic": 10, "premium": 20, "enterprise": 50}
+	for name, price := range want {
+		if !plans.IsValid(name) {
+			t.Errorf("%s is not registered", name)
+		}
+		if got := plans.Price(name); got != price {
+			t.Errorf("Price(%s) = %v, want %v", name, got, price)
+		}
+	}
+
+	enterprise, _ := plans.Lookup("enterprise")
+	if enterprise.FeeRate != 0.02 {
+		t.Errorf("enterprise fee rate = %v, want 0.02", enterprise.FeeRate)
+	}
+}
+
+func TestUnknownPlanRejected(t *testing.T) {
+	plans, err := NewPlanRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plans.IsValid("platinum") {
+		t.Error("IsValid(platinum) = true, want false")
+	}
+	if _, ok := plans.Lookup("platinum"); ok {
+		t.Error("Lookup(platinum) found a plan")
+	}
+	if got := plans.Price("platinum"); got != 0 {
+		t.Errorf("Price(platinum) = %v, want 0", got)
+	}
+}
+
+func TestNewPlanRegistryRejectsInvalidPlans(t *testing.T) {
+	tests := map[string][]Plan{
+		"empty name":  {{Name: "", PriceCents: 1000}},
+		"zero price":  {{Name: "free", PriceCents: 0}},
+		"fee above 1": {{Name: "basic", PriceCents: 1000, FeeRate: 1.5}},
+		"duplicate":   {{Name: "basic", PriceCents: 1000}, {Name: "basic", PriceCents: 2000}},
+	}
+	for name, plans := range tests {
+		if _, err := NewPlanRegistry(plans); err == nil {
+			t.Errorf("%s: NewPlanRegistry() = nil error, want one", name)
+		}
+	}
+}
+
+func TestRegisterReplacesPlan(t *testing.T) {
+	plans, err := NewPlanRegistry([]Plan{{Name: "basic", PriceCents: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plans.Register(Plan{Name: "basic", PriceCents: 1500}); err != nil {
+		t.Fatal(err)
+	}
+	if err := plans.Register(Plan{Name: "team", PriceCents: 3000}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := plans.Price("basic"); got != 15 {
+		t.Errorf("Price(basic) = %v, want 15", got)
+	}
+	if got := plans.Names(); len(got) != 2 || got[0] != "basic" || got[1] != "team" {
+		t.Errorf("Names() = %v, want [basic team]", got)
+	}
+}
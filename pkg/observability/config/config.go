@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// GetEnv returns the value of key, or defaultValue when it is unset or empty.
+func GetEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// GetBoolEnv returns key parsed as a bool, or defaultValue when it is unset
+// or does not parse.
+func GetBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// GetIntEnv returns key parsed as an int, or defaultValue when it is unset
+// or does not parse.
+func GetIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// GetFloatEnv returns key parsed as a float64, or defaultValue when it is
+// unset or does not parse.
+func GetFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// GetDurationEnv returns key parsed by time.ParseDuration, or defaultValue
+// when it is unset or does not parse.
+func GetDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// GetListEnv splits key on commas, returning nil when it is unset.
+func GetListEnv(key string) []string {
+	if value := os.Getenv(key); value != "" {
+		return strings.Split(value, ",")
+	}
+	return nil
+}
+
+// LoadFromFile decodes the YAML or JSON file at path into into, which
+// should already hold the environment-derived values: keys present in the
+// file replace them and the rest are left alone. Fields are matched by their
+// yaml tags in both formats, and durations are written as "5s". The format
+// is picked by the .yaml, .yml or .json extension.
+func LoadFromFile(path string, into interface{}) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+	default:
+		return fmt.Errorf("config file %s: unsupported extension %q", path, ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	// JSON is valid YAML, so one decoder serves both formats
+	if err := yaml.Unmarshal(data, into); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// OnReloadSignal calls reload in a background goroutine each time the
+// process receives SIGHUP, until ctx is done.
+func OnReloadSignal(ctx context.Context, reload func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-signals:
+				reload()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
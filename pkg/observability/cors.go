@@ -0,0 +1,121 @@
+package observability
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "X-User-ID", "traceparent", "tracestate", "baggage"}
+)
+
+type CORSConfig struct {
+	// AllowedOrigins lists exact origins such as "https://app.example.com",
+	// subdomain wildcards such as "https://*.example.com", or "*" for any.
+	// Origins matched only by "*" never get credentials.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, POST, PUT and DELETE.
+	AllowedMethods []string
+	// AllowedHeaders defaults to Content-Type, Authorization, X-User-ID and
+	// the W3C trace context headers, so browser spans join the trace.
+	AllowedHeaders []string
+	// ExposedHeaders are response headers scripts may read, e.g. ETag.
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long, in seconds, browsers may cache a preflight.
+	MaxAge int
+}
+
+// CORSMiddleware answers preflight OPTIONS requests itself, with 204 for an
+// allowed origin and 403 otherwise, and adds the Access-Control-Allow-*
+// headers to actual requests from allowed origins. Requests from other
+// origins pass through unchanged and are blocked by the browser. Origins
+// matched by an exact or subdomain entry are echoed back, with credentials
+// when AllowCredentials is set; origins matched only by "*" get a literal
+// "*" and no credentials, so an arbitrary site cannot read responses made
+// with the user's credentials.
+func CORSMiddleware(cfg CORSConfig) func(http.HandlerFunc) http.HandlerFunc {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(headers, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" {
+				next(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			allowOrigin, ok := matchOrigin(cfg.AllowedOrigins, origin)
+			if !ok {
+				if preflight {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			if cfg.AllowCredentials && allowOrigin != "*" {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposeHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+				next(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// matchOrigin returns the Access-Control-Allow-Origin value for origin:
+// origin itself when an exact or subdomain entry matches, "*" when only the
+// "*" entry does, and false when nothing does.
+func matchOrigin(allowed []string, origin string) (string, bool) {
+	anyOrigin := false
+	for _, pattern := range allowed {
+		if pattern == "*" {
+			anyOrigin = true
+			continue
+		}
+		if pattern == origin {
+			return origin, true
+		}
+
+		// "https://*.example.com" matches any subdomain, not the apex
+		scheme, host, ok := strings.Cut(pattern, "://*.")
+		if ok && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) {
+			return origin, true
+		}
+	}
+	if anyOrigin {
+		return "*", true
+	}
+	return "", false
+}
@@ -0,0 +1,105 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serveCORS(cfg CORSConfig, method, origin string, preflight bool) (*httptest.ResponseRecorder, bool) {
+	called := false
+	handler := CORSMiddleware(cfg)(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(method, "/v3/subscriptions", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec, called
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}
+
+	rec, called := serveCORS(cfg, http.MethodGet, "https://evil.example.org", false)
+	if !called {
+		t.Fatal("actual request from a disallowed origin was not passed through")
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+
+	rec, called = serveCORS(cfg, http.MethodOptions, "https://evil.example.org", true)
+	if called {
+		t.Error("preflight from a disallowed origin reached the handler")
+	}
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("preflight status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	cfg := CORSConfig{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}
+
+	rec, called := serveCORS(cfg, http.MethodOptions, "https://app.example.com", true)
+	if called {
+		t.Error("preflight reached the handler")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+		"Access-Control-Max-Age":           "600",
+		"Vary":                             "Origin",
+	}
+	for header, value := range want {
+		if got := rec.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+
+	// The apex is not a subdomain
+	if rec, _ := serveCORS(cfg, http.MethodOptions, "https://example.com", true); rec.Code != http.StatusForbidden {
+		t.Errorf("apex preflight status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestCORSWildcardWithoutCredentials(t *testing.T) {
+	cfg := CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	rec, _ := serveCORS(cfg, http.MethodGet, "https://any.example.org", false)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none for a wildcard origin", got)
+	}
+
+	// An explicit entry still gets credentials alongside "*"
+	cfg.AllowedOrigins = []string{"*", "https://app.example.com"}
+	rec, _ = serveCORS(cfg, http.MethodGet, "https://app.example.com", false)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the origin", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want true", got)
+	}
+}
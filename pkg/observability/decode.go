@@ -0,0 +1,90 @@
+package observability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// DefaultMaxBodyBytes is the body limit DecodeJSON applies when maxBytes is
+// not positive
+const DefaultMaxBodyBytes = 1 << 20
+
+// DecodeJSON decodes the request body into dst, rejecting unknown fields,
+// trailing data and bodies over maxBytes. On failure it has already written
+// the response with WriteError: 413 for an oversized body and 400 otherwise,
+// with a message naming what was wrong and where. The returned error is for logging.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}, maxBytes int64) error {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodyBytes
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err == nil {
+		// A second value, even a valid one, means the body was not a
+		// single JSON document
+		if dec.Decode(&struct{}{}) != io.EOF {
+			err = errors.New("request body must contain a single JSON value")
+			WriteError(w, r, http.StatusBadRequest, "INVALID_JSON", err.Error())
+			return err
+		}
+		return nil
+	}
+
+	status, code, message := decodeErrorResponse(err, maxBytes)
+	WriteError(w, r, status, code, message)
+	return err
+}
+
+func decodeErrorResponse(err error, maxBytes int64) (status int, code, message string) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, "BODY_TOO_LARGE", fmt.Sprintf("request body must not exceed %d bytes", maxBytes)
+	case errors.As(err, &syntaxErr):
+		return http.StatusBadRequest, "INVALID_JSON", fmt.Sprintf("request body contains malformed JSON at offset %d", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "INVALID_JSON", "request body contains malformed JSON"
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return http.StatusBadRequest, "INVALID_FIELD_TYPE", fmt.Sprintf("request body must be a JSON %s", jsonKind(typeErr.Type))
+		}
+		return http.StatusBadRequest, "INVALID_FIELD_TYPE", fmt.Sprintf("field %q must be a JSON %s, not %s", typeErr.Field, jsonKind(typeErr.Type), typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		return http.StatusBadRequest, "UNKNOWN_FIELD", "request body contains unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")
+	case errors.Is(err, io.EOF):
+		return http.StatusBadRequest, "EMPTY_BODY", "request body must not be empty"
+	default:
+		return http.StatusBadRequest, "INVALID_JSON", "request body could not be decoded"
+	}
+}
+
+// jsonKind names the JSON type that decodes into t.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Ptr:
+		return jsonKind(t.Elem())
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,126 @@
+package observability
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrorResponse is the body of every error response in both services:
+// {"error":{"code":...,"message":...,"type":...}}.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes one error. Code is a stable UPPER_SNAKE identifier
+// for clients to switch on, Message is for humans, and Type groups codes
+// into broad classes such as "validation_error" or "not_found".
+type ErrorDetail struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Type    string      `json:"type"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// errorResponses is the counter WriteError increments, installed by
+// NewErrorResponseCounter
+var errorResponses atomic.Pointer[prometheus.CounterVec]
+
+// NewErrorResponseCounter creates <service>_error_responses_total, labelled
+// by status and code, and makes WriteError increment it. Until it is called,
+// WriteError writes responses without counting them.
+func NewErrorResponseCounter(serviceName string, reg *prometheus.Registry) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: serviceName + "_error_responses_total",
+			Help: "Total number of error responses by status and error code",
+		},
+		[]string{"status", "code"},
+	)
+
+	if reg != nil {
+		reg.MustRegister(counter)
+	} else {
+		// Use default registry when nil is passed
+		prometheus.MustRegister(counter)
+	}
+
+	errorResponses.Store(counter)
+	return counter
+}
+
+// WriteError writes status with an ErrorResponse body whose type is derived
+// from status, records the error on the request's span and counts it.
+func WriteError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	WriteErrorDetail(w, r, status, ErrorDetail{Code: code, Message: message})
+}
+
+// WriteErrorDetail is WriteError for callers that need their own Type or
+// Details. An empty Type is derived from status.
+func WriteErrorDetail(w http.ResponseWriter, r *http.Request, status int, detail ErrorDetail) {
+	if detail.Type == "" {
+		detail.Type = ErrorType(status)
+	}
+
+	span := trace.SpanFromContext(r.Context())
+	span.RecordError(errors.New(detail.Message), trace.WithAttributes(
+		attribute.String("error.code", detail.Code),
+		attribute.String("error.type", detail.Type),
+		attribute.Int("http.status_code", status),
+	))
+	// Client errors are the caller's fault, not the span's
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, detail.Message)
+	}
+
+	if counter := errorResponses.Load(); counter != nil {
+		counter.WithLabelValues(strconv.Itoa(status), detail.Code).Inc()
+	}
+
+	body, err := json.Marshal(ErrorResponse{Error: detail})
+	if err != nil {
+		// Only Details can fail to encode; the rest of the error still can
+		detail.Details = nil
+		body, _ = json.Marshal(ErrorResponse{Error: detail})
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// ErrorType is the default ErrorDetail.Type for status.
+func ErrorType(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return "validation_error"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusPaymentRequired:
+		return "payment_required"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return "conflict"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return "unavailable"
+	}
+	if status >= http.StatusInternalServerError {
+		return "internal_error"
+	}
+	return "client_error"
+}
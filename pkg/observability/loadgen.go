@@ -0,0 +1,358 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	loadgenTracerName = "observability/loadgen"
+	// maxLoadRPS keeps the ticker interval well above the timer resolution
+	maxLoadRPS = 1000
+)
+
+// LoadConfig describes synthetic traffic against the subscription API.
+type LoadConfig struct {
+	// TargetURL is the subscription service base URL, e.g.
+	// http://localhost:8080. Its /v3 routes must not require a token.
+	TargetURL string
+	// RPS is the number of requests started per second
+	RPS float64
+	// Duration is how long to generate load for
+	Duration time.Duration
+	// PlanMix weights the plans of created subscriptions; empty uses
+	// DefaultPlanMix
+	PlanMix map[string]float64
+	// Concurrency caps requests in flight; ticks that find every slot busy
+	// are dropped. Zero uses 64.
+	Concurrency int
+	// Client sends the requests; nil uses a client with NewTracedTransport
+	Client *http.Client
+	// Tracing supplies the tracer provider and propagator for the run's
+	// spans; nil uses the global ones
+	Tracing *TracingV3
+}
+
+// DefaultPlanMix sells mostly basic plans, as real traffic would.
+var DefaultPlanMix = map[string]float64{"basic": 0.6, "premium": 0.3, "enterprise": 0.1}
+
+// LoadResult summarises a Loadgen run. A request is an error when it could
+// not be sent or its status was 400 or above.
+type LoadResult struct {
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	Dropped   int64   `json:"dropped"`
+	ElapsedMs float64 `json:"elapsed_ms"`
+	RPS       float64 `json:"rps"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// loadRun is the state shared by the requests of one Loadgen run.
+type loadRun struct {
+	cfg    LoadConfig
+	client *http.Client
+	tracer trace.Tracer
+
+	mu  sync.Mutex
+	ids []string
+
+	requests atomic.Int64
+	errors   atomic.Int64
+}
+
+// Loadgen sends a mix of create (40%), get (40%) and delete (20%) requests to
+// /v3/subscriptions at cfg.RPS until cfg.Duration passes or ctx is done.
+// Creates use random user IDs and plans drawn from cfg.PlanMix; gets and
+// deletes pick a subscription created earlier in the run. Each request is
+// the root of its own trace, and its context is propagated to the target.
+func Loadgen(ctx context.Context, cfg LoadConfig) (LoadResult, error) {
+	if err := cfg.validate(); err != nil {
+		return LoadResult{}, err
+	}
+	if len(cfg.PlanMix) == 0 {
+		cfg.PlanMix = DefaultPlanMix
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 64
+	}
+	cfg.TargetURL = strings.TrimSuffix(cfg.TargetURL, "/")
+
+	run := &loadRun{
+		cfg:    cfg,
+		client: cfg.Client,
+		tracer: otel.Tracer(loadgenTracerName),
+	}
+	var transportOpts []TransportOption
+	if cfg.Tracing != nil {
+		run.tracer = cfg.Tracing.namedTracer(loadgenTracerName)
+		transportOpts = append(transportOpts, WithTracingV3(cfg.Tracing))
+	}
+	if run.client == nil {
+		run.client = &http.Client{
+			Transport: NewTracedTransport(nil, transportOpts...),
+			Timeout:   10 * time.Second,
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	slots := make(chan struct{}, cfg.Concurrency)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.RPS))
+	defer ticker.Stop()
+
+	var result LoadResult
+	var wg sync.WaitGroup
+	start := time.Now()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			result.Dropped++
+			continue
+		}
+
+		// Draw on this goroutine; rng is not safe for concurrent use
+		op := run.nextOperation(rng)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			// Requests in flight finish even though ctx has expired
+			op(context.WithoutCancel(ctx))
+		}()
+	}
+
+	wg.Wait()
+	elapsed := time.Since(start)
+	result.ElapsedMs = float64(elapsed.Microseconds()) / 1000
+	result.Requests = run.requests.Load()
+	result.Errors = run.errors.Load()
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		result.RPS = float64(result.Requests) / seconds
+	}
+	if result.Requests > 0 {
+		result.ErrorRate = float64(result.Errors) / float64(result.Requests)
+	}
+
+	return result, nil
+}
+
+func (c LoadConfig) validate() error {
+	var errs []error
+	if c.TargetURL == "" {
+		errs = append(errs, errors.New("target URL is required"))
+	}
+	if c.RPS <= 0 || c.RPS > maxLoadRPS {
+		errs = append(errs, fmt.Errorf("RPS must be above 0 and at most %d", maxLoadRPS))
+	}
+	if c.Duration <= 0 {
+		errs = append(errs, errors.New("duration must be positive"))
+	}
+	total := 0.0
+	for plan, weight := range c.PlanMix {
+		if weight < 0 {
+			errs = append(errs, fmt.Errorf("plan %s: weight must not be negative", plan))
+		}
+		total += weight
+	}
+	if len(c.PlanMix) > 0 && total <= 0 {
+		errs = append(errs, errors.New("plan mix weights must not all be zero"))
+	}
+	return errors.Join(errs...)
+}
+
+// nextOperation picks the next request to send. It creates while there is
+// nothing to get or delete.
+func (run *loadRun) nextOperation(rng *rand.Rand) func(context.Context) {
+	roll := rng.Float64()
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if roll < 0.4 || len(run.ids) == 0 {
+		userID := fmt.Sprintf("loadgen_user_%d", rng.Intn(1000))
+		plan := run.pickPlan(rng)
+		return func(ctx context.Context) { run.create(ctx, userID, plan) }
+	}
+
+	i := rng.Intn(len(run.ids))
+	id := run.ids[i]
+	if roll < 0.8 {
+		return func(ctx context.Context) { run.send(ctx, "get", http.MethodGet, "/v3/subscriptions/"+id, nil) }
+	}
+
+	// Forget the subscription now so later gets do not race its delete
+	run.ids[i] = run.ids[len(run.ids)-1]
+	run.ids = run.ids[:len(run.ids)-1]
+	return func(ctx context.Context) { run.send(ctx, "delete", http.MethodDelete, "/v3/subscriptions/"+id, nil) }
+}
+
+func (run *loadRun) pickPlan(rng *rand.Rand) string {
+	total := 0.0
+	for _, weight := range run.cfg.PlanMix {
+		total += weight
+	}
+
+	roll := rng.Float64() * total
+	var last string
+	for plan, weight := range run.cfg.PlanMix {
+		if roll < weight {
+			return plan
+		}
+		roll -= weight
+		last = plan
+	}
+	// Rounding can leave roll just above the last weight
+	return last
+}
+
+func (run *loadRun) create(ctx context.Context, userID, plan string) {
+	body, _ := json.Marshal(map[string]string{"user_id": userID, "plan": plan})
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	respBody := run.send(ctx, "create", http.MethodPost, "/v3/subscriptions", body)
+	if respBody == nil || json.Unmarshal(respBody, &created) != nil || created.ID == "" {
+		return
+	}
+
+	run.mu.Lock()
+	run.ids = append(run.ids, created.ID)
+	run.mu.Unlock()
+}
+
+// send makes one request in its own trace and returns the body of a
+// successful response, or nil after counting an error.
+func (run *loadRun) send(ctx context.Context, operation, method, path string, body []byte) []byte {
+	ctx, span := run.tracer.Start(ctx, "loadgen "+operation,
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("loadgen.operation", operation)),
+	)
+	defer span.End()
+
+	run.requests.Add(1)
+
+	req, err := http.NewRequestWithContext(ctx, method, run.cfg.TargetURL+path, bytes.NewReader(body))
+	if err != nil {
+		run.errors.Add(1)
+		span.RecordError(err)
+		return nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := run.client.Do(req)
+	if err != nil {
+		run.errors.Add(1)
+		span.RecordError(err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= http.StatusBadRequest {
+		run.errors.Add(1)
+		return nil
+	}
+	return respBody
+}
+
+// maxLoadgenDuration bounds a run started over HTTP, which holds the request
+// open until it finishes
+const maxLoadgenDuration = 10 * time.Minute
+
+// LoadgenRequest is the body of POST /debug/loadgen. Duration is a Go
+// duration string such as "30s". The target is fixed by the server so the
+// endpoint cannot be pointed at other hosts.
+type LoadgenRequest struct {
+	RPS      float64            `json:"rps"`
+	Duration string             `json:"duration"`
+	PlanMix  map[string]float64 `json:"plan_mix,omitempty"`
+}
+
+// LoadgenHandler runs Loadgen against target for POST requests and responds
+// with the LoadResult once the run ends; the run stops early if the client
+// goes away. tracing is passed on as LoadConfig.Tracing. Serve it behind
+// SecureMetricsHandler, and only when MetricsAuthConfig.Enabled.
+func LoadgenHandler(logger zerolog.Logger, target string, tracing *TracingV3) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+
+		var body LoadgenRequest
+		if err := DecodeJSON(w, r, &body, 4<<10); err != nil {
+			return
+		}
+		duration, err := time.ParseDuration(body.Duration)
+		if err != nil || duration > maxLoadgenDuration {
+			WriteError(w, r, http.StatusBadRequest, "INVALID_DURATION",
+				fmt.Sprintf("duration must be a Go duration up to %s, such as \"30s\"", maxLoadgenDuration))
+			return
+		}
+
+		cfg := LoadConfig{
+			TargetURL: target,
+			RPS:       body.RPS,
+			Duration:  duration,
+			PlanMix:   body.PlanMix,
+			Tracing:   tracing,
+		}
+		if err := cfg.validate(); err != nil {
+			WriteError(w, r, http.StatusBadRequest, "INVALID_LOAD_CONFIG", err.Error())
+			return
+		}
+
+		logger.Info().
+			Str("target_url", cfg.TargetURL).
+			Float64("rps", cfg.RPS).
+			Dur("duration", cfg.Duration).
+			Str("client_ip", r.RemoteAddr).
+			Msg("Load generation started")
+
+		result, err := Loadgen(r.Context(), cfg)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, "LOADGEN_FAILED", err.Error())
+			return
+		}
+
+		logger.Info().
+			Int64("requests", result.Requests).
+			Int64("errors", result.Errors).
+			Int64("dropped", result.Dropped).
+			Float64("rps", result.RPS).
+			Float64("error_rate", result.ErrorRate).
+			Float64("elapsed_ms", result.ElapsedMs).
+			Msg("Load generation finished")
+
+		Respond(w, r, http.StatusOK, result)
+	}
+}
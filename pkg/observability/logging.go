@@ -1,15 +1,91 @@
 package observability
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultReconnectBaseBackoff = 100 * time.Millisecond
+	defaultReconnectMaxBackoff  = 30 * time.Second
+	defaultLogBufferSize        = 1024
+	defaultLogBatchSize         = 100
+	defaultLogFlushInterval     = time.Second
+
+	// logWriteTimeout caps every dial and write to Logstash.
+	logWriteTimeout = 3 * time.Second
+	// closeGracePeriod is how long Close waits for queued and buffered lines
+	// to be delivered before aborting in-flight writes.
+	closeGracePeriod = 3 * time.Second
+
+	// bufferFlushBudget bounds how long a single Write may spend replaying
+	// buffered lines, so a large backlog can't hold the mutex indefinitely.
+	bufferFlushBudget = 500 * time.Millisecond
 )
 
+var errReconnectBackoff = errors.New("logstash: reconnect backoff in effect")
+
 type LogConfig struct {
 	Host string
+	// ServiceName prefixes the writer's metric names, e.g.
+	// payment_service_logstash_connected, so services sharing a registry do
+	// not collide. Writers within one service are told apart by their host
+	// label.
+	ServiceName string
+	// ReconnectMaxBackoff caps the delay between dial attempts after the
+	// connection to Logstash fails. Defaults to 30s.
+	ReconnectMaxBackoff time.Duration
+	// BufferSize is the number of serialized log lines held in memory while
+	// Logstash is unreachable. Defaults to 1024; the oldest line is dropped
+	// when the buffer is full.
+	BufferSize int
+	// Async makes Write enqueue lines for a background goroutine that ships
+	// them in batches of up to BatchSize (default 100), or whatever has
+	// accumulated every FlushInterval (default 1s). The queue holds up to
+	// BufferSize lines; further writes are dropped rather than blocking.
+	Async         bool
+	BatchSize     int
+	FlushInterval time.Duration
+	// StaticFields are merged into every log entry before it is shipped,
+	// e.g. env, region or version. Keys already present in the entry win.
+	StaticFields map[string]interface{}
+	// FallbackPath, when set, is a file that encoded lines are appended to
+	// while Logstash is unreachable, in place of the in-memory buffer. With
+	// ReplayFallback the file is replayed to Logstash and truncated once the
+	// connection recovers; otherwise it is kept as an audit trail of what
+	// Logstash missed.
+	FallbackPath   string
+	ReplayFallback bool
+	// Encoder serializes each entry for the wire. Defaults to JSONEncoder;
+	// GELFEncoder and ECSEncoder are provided for Graylog and Elastic
+	// Common Schema pipelines.
+	Encoder LogEncoder
+	// RedactKeys lists field names (case-insensitive) whose values are
+	// replaced before shipping, at any depth of nested objects. Values become
+	// "[REDACTED]", or RedactFunc's return value when it is set, e.g. to
+	// hash an ID so entries can still be correlated.
+	RedactKeys []string
+	RedactFunc func(key string, val interface{}) interface{}
+}
+
+// LogStats reports delivery counters for a LogstashWriter.
+type LogStats struct {
+	// Dropped is the number of log lines that never reached Logstash.
+	Dropped uint64
+	// Buffered is the number of lines waiting for the connection to recover.
+	Buffered int
 }
 
 type LogstashWriter struct {
@@ -17,88 +93,618 @@ type LogstashWriter struct {
 	conn    net.Conn
 	mu      sync.Mutex
 	onError func(error)
+
+	// ctx is cancelled by Close so dials and writes in flight are aborted
+	// promptly instead of running out their timeout.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Reconnect state, guarded by mu. After a failed dial or write the
+	// writer refuses to dial again until nextDial, doubling backoff on every
+	// consecutive failure up to maxBackoff.
+	maxBackoff time.Duration
+	backoff    time.Duration
+	nextDial   time.Time
+	dropped    atomic.Uint64
+
+	// buffer holds lines written while disconnected, replayed in order once
+	// the connection is re-established.
+	buffer *logRing
+
+	// Async delivery. closing is closed by Close to tell run to drain queue
+	// and exit; done is closed once it has. enqueue holds enqueueMu for
+	// reading across its closing check and send, and Close takes it for
+	// writing to close closing, so no line lands in queue after the drain.
+	async         bool
+	queue         chan []byte
+	batchSize     int
+	flushInterval time.Duration
+	enqueueMu     sync.RWMutex
+	closing       chan struct{}
+	done          chan struct{}
+	closeOnce     sync.Once
+
+	staticFields map[string]interface{}
+	encoder      LogEncoder
+	redactKeys   map[string]struct{}
+	redactFunc   func(key string, val interface{}) interface{}
+
+	fallback       *os.File
+	replayFallback bool
+
+	connected    prometheus.Gauge
+	writeErrors  prometheus.Counter
+	bytesWritten prometheus.Counter
 }
 
-func NewLogWriter(cfg LogConfig, onError func(error)) (io.Writer, error) {
-	return &LogstashWriter{
-		host:    cfg.Host,
-		onError: onError,
-	}, nil
+func NewLogWriter(cfg LogConfig, onError func(error)) (*LogstashWriter, error) {
+	if cfg.ReconnectMaxBackoff <= 0 {
+		cfg.ReconnectMaxBackoff = defaultReconnectMaxBackoff
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultLogBufferSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultLogBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultLogFlushInterval
+	}
+	if cfg.Encoder == nil {
+		cfg.Encoder = JSONEncoder
+	}
+
+	var fallback *os.File
+	if cfg.FallbackPath != "" {
+		f, err := os.OpenFile(cfg.FallbackPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open log fallback file: %w", err)
+		}
+		fallback = f
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	w := &LogstashWriter{
+		ctx:           ctx,
+		cancel:        cancel,
+		host:          cfg.Host,
+		onError:       onError,
+		maxBackoff:    cfg.ReconnectMaxBackoff,
+		buffer:        newLogRing(cfg.BufferSize),
+		encoder:       cfg.Encoder,
+		redactFunc:    cfg.RedactFunc,
+		async:         cfg.Async,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+
+		fallback:       fallback,
+		replayFallback: cfg.ReplayFallback,
+
+		connected: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   cfg.ServiceName,
+			Name:        "logstash_connected",
+			Help:        "Whether the log writer currently holds a connection to Logstash (1) or not (0)",
+			ConstLabels: prometheus.Labels{"host": cfg.Host},
+		}),
+		writeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.ServiceName,
+			Name:        "logstash_write_errors_total",
+			Help:        "Total number of failed dials and writes to Logstash",
+			ConstLabels: prometheus.Labels{"host": cfg.Host},
+		}),
+		bytesWritten: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.ServiceName,
+			Name:        "logstash_bytes_written_total",
+			Help:        "Total number of bytes delivered to Logstash",
+			ConstLabels: prometheus.Labels{"host": cfg.Host},
+		}),
+	}
+
+	if len(cfg.RedactKeys) > 0 {
+		w.redactKeys = make(map[string]struct{}, len(cfg.RedactKeys))
+		for _, key := range cfg.RedactKeys {
+			w.redactKeys[strings.ToLower(strings.TrimSpace(key))] = struct{}{}
+		}
+	}
+
+	if len(cfg.StaticFields) > 0 {
+		w.staticFields = make(map[string]interface{}, len(cfg.StaticFields))
+		for key, value := range cfg.StaticFields {
+			w.staticFields[key] = value
+		}
+	}
+
+	if w.async {
+		w.queue = make(chan []byte, cfg.BufferSize)
+		go w.run()
+	} else {
+		close(w.done)
+	}
+
+	return w, nil
 }
 
 func (w *LogstashWriter) connect() error {
 	if w.conn != nil {
 		return nil
 	}
-	conn, err := net.DialTimeout("tcp", w.host, time.Second*3)
+	if time.Now().Before(w.nextDial) {
+		return errReconnectBackoff
+	}
+	dialer := net.Dialer{Timeout: logWriteTimeout}
+	conn, err := dialer.DialContext(w.ctx, "tcp", w.host)
 	if err != nil {
+		w.writeErrors.Inc()
+		w.scheduleReconnect()
 		return err
 	}
 	w.conn = conn
+	w.connected.Set(1)
 	return nil
 }
 
-func (w *LogstashWriter) Write(p []byte) (n int, err error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
+// scheduleReconnect advances the backoff window after a connection failure.
+func (w *LogstashWriter) scheduleReconnect() {
+	if w.backoff == 0 {
+		w.backoff = defaultReconnectBaseBackoff
+	} else {
+		w.backoff *= 2
+	}
+	if w.backoff > w.maxBackoff {
+		w.backoff = w.maxBackoff
+	}
+	w.nextDial = time.Now().Add(w.backoff)
+}
+
+func (w *LogstashWriter) resetBackoff() {
+	w.backoff = 0
+	w.nextDial = time.Time{}
+}
+
+func (w *LogstashWriter) dropConn(err error) {
+	w.conn.Close()
+	w.conn = nil
+	w.connected.Set(0)
+	w.writeErrors.Inc()
+	w.scheduleReconnect()
+	w.reportError(err)
+}
+
+func (w *LogstashWriter) reportError(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// bufferLine stores a line for later delivery: in the fallback file when one
+// is configured, otherwise in the ring buffer, evicting the oldest buffered
+// line when it is full.
+func (w *LogstashWriter) bufferLine(line []byte) {
+	if w.fallback != nil {
+		if _, err := w.fallback.Write(line); err != nil {
+			w.dropped.Add(1)
+			w.reportError(err)
+		}
+		return
+	}
+	if w.buffer.push(line) {
+		w.dropped.Add(1)
+	}
+}
+
+func (w *LogstashWriter) writeLine(line []byte) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(logWriteTimeout)
+	if ctxDeadline, ok := w.ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := w.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+
+	// Pull the deadline in as soon as the writer is closed so a write stuck
+	// on a slow Logstash returns immediately.
+	conn := w.conn
+	stop := context.AfterFunc(w.ctx, func() {
+		conn.SetWriteDeadline(time.Now())
+	})
+	defer stop()
+
+	written := 0
+	for written < len(line) {
+		nw, err := w.conn.Write(line[written:])
+		written += nw
+		if err != nil {
+			w.bytesWritten.Add(float64(written))
+			return err
+		}
+	}
+	w.bytesWritten.Add(float64(written))
+	return nil
+}
+
+// flushBuffer replays buffered lines in order. It reports whether the buffer
+// was fully drained; on failure or when the flush budget runs out the
+// remaining lines stay buffered for the next Write.
+func (w *LogstashWriter) flushBuffer() bool {
+	deadline := time.Now().Add(bufferFlushBudget)
+	if w.fallback != nil {
+		return w.replayFallbackFile(deadline)
+	}
+	for w.buffer.len() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		if err := w.writeLine(w.buffer.peek()); err != nil {
+			w.dropConn(err)
+			return false
+		}
+		w.buffer.pop()
+	}
+	return true
+}
+
+// replayFallbackFile sends the fallback file's contents and truncates it.
+// Lines that could not be sent before the deadline are written back so they
+// are retried on the next delivery. Without ReplayFallback the file is left
+// alone and new lines are sent directly.
+func (w *LogstashWriter) replayFallbackFile(deadline time.Time) bool {
+	if !w.replayFallback {
+		return true
+	}
+
+	if _, err := w.fallback.Seek(0, io.SeekStart); err != nil {
+		w.reportError(err)
+		return false
+	}
+	data, err := io.ReadAll(w.fallback)
+	if err != nil {
+		w.reportError(err)
+		return false
+	}
+	if len(data) == 0 {
+		return true
+	}
+
+	sent := 0
+	for sent < len(data) && time.Now().Before(deadline) {
+		end := bytes.IndexByte(data[sent:], '\n')
+		if end < 0 {
+			end = len(data) - sent - 1
+		}
+		line := data[sent : sent+end+1]
+		if err := w.writeLine(line); err != nil {
+			w.dropConn(err)
+			break
+		}
+		sent += len(line)
+	}
+
+	if err := w.fallback.Truncate(0); err != nil {
+		w.reportError(err)
+		return false
+	}
+	if sent < len(data) {
+		if _, err := w.fallback.Write(data[sent:]); err != nil {
+			w.reportError(err)
+		}
+		return false
+	}
+	return true
+}
 
+// deliver ships lines to Logstash, buffering whatever can't be sent. The
+// lines are sent as a single write. Must be called with mu held.
+func (w *LogstashWriter) deliver(lines [][]byte) {
+	if err := w.connect(); err != nil {
+		w.bufferLines(lines)
+		// Skipped dials are expected while backing off; only surface real
+		// dial failures so a down Logstash doesn't flood onError.
+		if !errors.Is(err, errReconnectBackoff) {
+			w.reportError(err)
+		}
+		return
+	}
+
+	// Older buffered lines go out first to keep ordering intact.
+	if !w.flushBuffer() {
+		w.bufferLines(lines)
+		return
+	}
+
+	payload := lines[0]
+	if len(lines) > 1 {
+		payload = bytes.Join(lines, nil)
+	}
+
+	if err := w.writeLine(payload); err != nil {
+		w.dropConn(err)
+		w.bufferLines(lines)
+		return
+	}
+
+	w.resetBackoff()
+}
+
+func (w *LogstashWriter) bufferLines(lines [][]byte) {
+	for _, line := range lines {
+		w.bufferLine(line)
+	}
+}
+
+func (w *LogstashWriter) Write(p []byte) (n int, err error) {
 	n = len(p)
 
 	var logEntry map[string]interface{}
 	if err := json.Unmarshal(p, &logEntry); err != nil {
-		if w.onError != nil {
-			w.onError(err)
-		}
+		w.dropped.Add(1)
+		w.reportError(err)
 		return n, nil
 	}
 
-	if err := w.connect(); err != nil {
-		if w.onError != nil {
-			w.onError(err)
+	for key, value := range w.staticFields {
+		if _, exists := logEntry[key]; !exists {
+			// Copied so concurrent writes never share a nested value
+			logEntry[key] = cloneValue(value)
 		}
-		return n, nil
 	}
 
-	logJSON, err := json.Marshal(logEntry)
+	if w.redactKeys != nil {
+		logEntry = w.redact(logEntry)
+	}
+
+	line, err := w.encoder(logEntry)
 	if err != nil {
-		if w.onError != nil {
-			w.onError(err)
-		}
+		w.dropped.Add(1)
+		w.reportError(err)
 		return n, nil
 	}
-	logJSON = append(logJSON, '\n')
 
-	deadline := time.Now().Add(time.Second * 3)
-	if err := w.conn.SetWriteDeadline(deadline); err != nil {
-		w.conn.Close()
-		w.conn = nil
-		if w.onError != nil {
-			w.onError(err)
-		}
+	if w.async {
+		w.enqueue(line)
 		return n, nil
 	}
 
-	written := 0
-	for written < len(logJSON) {
-		var nw int
-		nw, err = w.conn.Write(logJSON[written:])
-		if err != nil {
-			w.conn.Close()
-			w.conn = nil
-			if w.onError != nil {
-				w.onError(err)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.deliver([][]byte{line})
+	return n, nil
+}
+
+// cloneValue deep-copies the JSON container types, the only values later
+// stages modify; anything else is returned as is.
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			clone[key] = cloneValue(item)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, item := range v {
+			clone[i] = cloneValue(item)
+		}
+		return clone
+	default:
+		return value
+	}
+}
+
+const redactedValue = "[REDACTED]"
+
+// redact returns a copy of entry with the values of sensitive keys replaced,
+// descending into nested objects and arrays. entry itself is not modified,
+// since nested values may be shared with other entries.
+func (w *LogstashWriter) redact(entry map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(entry))
+	for key, value := range entry {
+		if _, sensitive := w.redactKeys[strings.ToLower(key)]; sensitive {
+			if w.redactFunc != nil {
+				redacted[key] = w.redactFunc(key, value)
+			} else {
+				redacted[key] = redactedValue
 			}
-			return n, nil
+			continue
 		}
-		written += nw
+		redacted[key] = w.redactValue(value)
 	}
+	return redacted
+}
 
-	return n, nil
+func (w *LogstashWriter) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return w.redact(v)
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = w.redactValue(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// enqueue hands a line to the background sender without blocking. Lines
+// written after Close, or while the queue is full, are dropped.
+func (w *LogstashWriter) enqueue(line []byte) {
+	w.enqueueMu.RLock()
+	defer w.enqueueMu.RUnlock()
+
+	select {
+	case <-w.closing:
+		w.dropped.Add(1)
+		return
+	default:
+	}
+
+	select {
+	case w.queue <- line:
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// run batches queued lines and delivers them until Close is called, then
+// drains whatever is left in the queue.
+func (w *LogstashWriter) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, w.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		w.mu.Lock()
+		w.deliver(batch)
+		w.mu.Unlock()
+		batch = batch[:0]
+	}
+	add := func(line []byte) {
+		batch = append(batch, line)
+		if len(batch) >= w.batchSize {
+			flush()
+		}
+	}
+
+	for {
+		select {
+		case line := <-w.queue:
+			add(line)
+		case <-ticker.C:
+			flush()
+		case <-w.closing:
+			for {
+				select {
+				case line := <-w.queue:
+					add(line)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// Stats returns a snapshot of the writer's delivery counters.
+func (w *LogstashWriter) Stats() LogStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return LogStats{
+		Dropped:  w.dropped.Load(),
+		Buffered: w.buffer.len(),
+	}
 }
 
+// Close drains any queued lines and makes a last attempt to flush the
+// reconnect buffer, giving up after closeGracePeriod. It then aborts any
+// write still in flight and closes the connection.
 func (w *LogstashWriter) Close() error {
+	w.closeOnce.Do(func() {
+		// Wait out enqueues that already passed their closing check
+		w.enqueueMu.Lock()
+		close(w.closing)
+		w.enqueueMu.Unlock()
+	})
+
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		<-w.done
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.buffer.len() > 0 && w.connect() == nil {
+			w.flushBuffer()
+		}
+	}()
+
+	grace := time.NewTimer(closeGracePeriod)
+	select {
+	case <-flushed:
+	case <-grace.C:
+	}
+	grace.Stop()
+	w.cancel()
+	<-flushed
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	if w.fallback != nil {
+		err = w.fallback.Close()
+		w.fallback = nil
+	}
 	if w.conn != nil {
-		return w.conn.Close()
+		err = errors.Join(err, w.conn.Close())
+		w.conn = nil
+		w.connected.Set(0)
 	}
-	return nil
+	return err
+}
+
+// RegisterMetrics registers the writer's transport health metrics with reg,
+// or with the default registry when reg is nil, so a broken log pipeline can
+// be alerted on like any other dependency. Writers with the same ServiceName
+// and Host cannot share a registry.
+func (w *LogstashWriter) RegisterMetrics(reg *prometheus.Registry) {
+	if reg != nil {
+		reg.MustRegister(w.connected, w.writeErrors, w.bytesWritten)
+	} else {
+		prometheus.MustRegister(w.connected, w.writeErrors, w.bytesWritten)
+	}
+}
+
+// logRing is a fixed-capacity FIFO of serialized log lines.
+type logRing struct {
+	entries [][]byte
+	head    int
+	size    int
+}
+
+func newLogRing(capacity int) *logRing {
+	return &logRing{entries: make([][]byte, capacity)}
+}
+
+// push appends an entry and reports whether the oldest entry was evicted to
+// make room for it.
+func (r *logRing) push(entry []byte) bool {
+	evicted := false
+	if r.size == len(r.entries) {
+		r.pop()
+		evicted = true
+	}
+	r.entries[(r.head+r.size)%len(r.entries)] = entry
+	r.size++
+	return evicted
+}
+
+func (r *logRing) peek() []byte {
+	return r.entries[r.head]
+}
+
+func (r *logRing) pop() {
+	r.entries[r.head] = nil
+	r.head = (r.head + 1) % len(r.entries)
+	r.size--
+}
+
+func (r *logRing) len() int {
+	return r.size
 }
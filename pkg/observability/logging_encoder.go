@@ -0,0 +1,134 @@
+package observability
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// LogEncoder turns a decoded log entry into the bytes shipped to Logstash,
+// including whatever framing the receiving input expects.
+type LogEncoder func(entry map[string]interface{}) ([]byte, error)
+
+// JSONEncoder ships the entry unchanged as newline-delimited JSON. This is
+// the default and matches the json_lines codec in logstash.conf.
+func JSONEncoder(entry map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// gelfLevels maps zerolog level names to syslog severities used by GELF.
+var gelfLevels = map[string]int{
+	"panic": 1,
+	"fatal": 2,
+	"error": 3,
+	"warn":  4,
+	"info":  6,
+	"debug": 7,
+	"trace": 7,
+}
+
+// GELFEncoder remaps the entry to GELF 1.1 for Graylog's TCP input: message
+// becomes short_message, the zerolog level becomes a syslog severity, time
+// becomes a unix timestamp and every other field is prefixed with an
+// underscore. Messages are null-byte delimited as GELF TCP requires.
+func GELFEncoder(entry map[string]interface{}) ([]byte, error) {
+	gelf := map[string]interface{}{
+		"version": "1.1",
+		"host":    gelfHost(entry),
+	}
+
+	for key, value := range entry {
+		switch key {
+		case "message":
+			gelf["short_message"] = value
+		case "level":
+			if level, ok := gelfLevels[toString(value)]; ok {
+				gelf["level"] = level
+			}
+		case "time":
+			if ts, ok := parseLogTime(value); ok {
+				gelf["timestamp"] = float64(ts.UnixNano()) / float64(time.Second)
+			}
+		case "id":
+			// GELF reserves _id.
+			gelf["_log_id"] = value
+		default:
+			gelf["_"+key] = value
+		}
+	}
+
+	if _, ok := gelf["short_message"]; !ok {
+		gelf["short_message"] = ""
+	}
+
+	data, err := json.Marshal(gelf)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, 0), nil
+}
+
+func gelfHost(entry map[string]interface{}) string {
+	if service, ok := entry["service"].(string); ok && service != "" {
+		return service
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// ECSEncoder remaps the entry to Elastic Common Schema field names: time →
+// @timestamp, level → log.level, caller → log.origin.file.name, service →
+// service.name and error → error.message. Remaining fields are kept at the
+// top level. Output is newline-delimited JSON.
+func ECSEncoder(entry map[string]interface{}) ([]byte, error) {
+	ecs := map[string]interface{}{
+		"ecs": map[string]interface{}{"version": "8.11.0"},
+	}
+	logField := map[string]interface{}{}
+
+	for key, value := range entry {
+		switch key {
+		case "time":
+			ecs["@timestamp"] = value
+		case "level":
+			logField["level"] = value
+		case "caller":
+			logField["origin"] = map[string]interface{}{
+				"file": map[string]interface{}{"name": value},
+			}
+		case "service":
+			ecs["service"] = map[string]interface{}{"name": value}
+		case "error":
+			ecs["error"] = map[string]interface{}{"message": value}
+		default:
+			ecs[key] = value
+		}
+	}
+
+	if len(logField) > 0 {
+		ecs["log"] = logField
+	}
+
+	return JSONEncoder(ecs)
+}
+
+func parseLogTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		ts, err := time.Parse(time.RFC3339Nano, v)
+		return ts, err == nil
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func toString(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
@@ -0,0 +1,151 @@
+package observability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type OTLPLogConfig struct {
+	ServiceName string
+	// Endpoint is the collector's OTLP/HTTP address, either host:port or a
+	// URL. Falls back to OTEL_EXPORTER_OTLP_ENDPOINT.
+	Endpoint string
+}
+
+// otlpSeverities maps zerolog level names to OTLP severity numbers.
+var otlpSeverities = map[string]otellog.Severity{
+	"trace": otellog.SeverityTrace,
+	"debug": otellog.SeverityDebug,
+	"info":  otellog.SeverityInfo,
+	"warn":  otellog.SeverityWarn,
+	"error": otellog.SeverityError,
+	"fatal": otellog.SeverityFatal,
+	"panic": otellog.SeverityFatal2,
+}
+
+// OTLPLogWriter converts zerolog JSON lines into OTLP log records and exports
+// them in batches over OTLP/HTTP, so logs can go through the same collector
+// as traces and metrics. Add it to the zerolog.MultiLevelWriter alongside the
+// console and Logstash writers.
+type OTLPLogWriter struct {
+	provider *sdklog.LoggerProvider
+	logger   otellog.Logger
+}
+
+func NewOTLPLogWriter(cfg OTLPLogConfig) (*OTLPLogWriter, error) {
+	var opts []otlploghttp.Option
+	if host, insecure, ok := resolveOTLPEndpoint(cfg.Endpoint); ok {
+		opts = append(opts, otlploghttp.WithEndpoint(host))
+		if insecure {
+			opts = append(opts, otlploghttp.WithInsecure())
+		}
+	}
+
+	exporter, err := otlploghttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP log exporter: %w", err)
+	}
+
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+		)),
+	)
+
+	return &OTLPLogWriter{
+		provider: provider,
+		logger:   provider.Logger(cfg.ServiceName),
+	}, nil
+}
+
+// Write parses one zerolog JSON line and emits it as a log record: message
+// becomes the body, level the severity, time the timestamp, trace_id and
+// span_id the record's trace context, and every other field an attribute.
+func (w *OTLPLogWriter) Write(p []byte) (int, error) {
+	var entry map[string]interface{}
+	if err := json.Unmarshal(p, &entry); err != nil {
+		return 0, err
+	}
+
+	var record otellog.Record
+	record.SetObservedTimestamp(time.Now())
+
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	for key, value := range entry {
+		switch key {
+		case "message":
+			record.SetBody(otellog.StringValue(toString(value)))
+		case "level":
+			level := toString(value)
+			record.SetSeverityText(level)
+			record.SetSeverity(otlpSeverities[level])
+		case "time":
+			if ts, ok := parseLogTime(value); ok {
+				record.SetTimestamp(ts)
+			}
+		case "trace_id":
+			traceID, _ = trace.TraceIDFromHex(toString(value))
+		case "span_id":
+			spanID, _ = trace.SpanIDFromHex(toString(value))
+		default:
+			record.AddAttributes(otellog.KeyValue{Key: key, Value: otlpLogValue(value)})
+		}
+	}
+
+	ctx := context.Background()
+	if traceID.IsValid() && spanID.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+	}
+	w.logger.Emit(ctx, record)
+
+	return len(p), nil
+}
+
+// Shutdown flushes buffered records and stops the exporter.
+func (w *OTLPLogWriter) Shutdown(ctx context.Context) error {
+	return w.provider.Shutdown(ctx)
+}
+
+// otlpLogValue converts a decoded JSON value to a log attribute value.
+func otlpLogValue(value interface{}) otellog.Value {
+	switch v := value.(type) {
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case float64:
+		if v == float64(int64(v)) {
+			return otellog.Int64Value(int64(v))
+		}
+		return otellog.Float64Value(v)
+	case []interface{}:
+		values := make([]otellog.Value, 0, len(v))
+		for _, item := range v {
+			values = append(values, otlpLogValue(item))
+		}
+		return otellog.SliceValue(values...)
+	case map[string]interface{}:
+		kvs := make([]otellog.KeyValue, 0, len(v))
+		for key, item := range v {
+			kvs = append(kvs, otellog.KeyValue{Key: key, Value: otlpLogValue(item)})
+		}
+		return otellog.MapValue(kvs...)
+	default:
+		return otellog.Value{}
+	}
+}
@@ -0,0 +1,134 @@
+package observability
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestLogWriterRedactsCopies writes concurrently with a nested static field
+// that holds a redacted key. Redaction must work on copies: the caller's map
+// keeps its value and concurrent writes do not race on the shared map.
+func TestLogWriterRedactsCopies(t *testing.T) {
+	static := map[string]interface{}{
+		"deploy": map[string]interface{}{"region": "eu", "token": "s3cret"},
+	}
+
+	var mu sync.Mutex
+	var encoded []map[string]interface{}
+	w, err := NewLogWriter(LogConfig{
+		// Nothing listens here, so lines are buffered
+		Host:         "127.0.0.1:1",
+		StaticFields: static,
+		RedactKeys:   []string{"Token"},
+		Encoder: func(entry map[string]interface{}) ([]byte, error) {
+			mu.Lock()
+			encoded = append(encoded, entry)
+			mu.Unlock()
+			return JSONEncoder(entry)
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Write([]byte(`{"message":"hello","items":[{"token":"abc"}]}`))
+		}()
+	}
+	wg.Wait()
+
+	if got := static["deploy"].(map[string]interface{})["token"]; got != "s3cret" {
+		t.Errorf("static field token = %v, want it left unchanged", got)
+	}
+	if len(encoded) != 20 {
+		t.Fatalf("encoded %d entries, want 20", len(encoded))
+	}
+
+	body, _ := json.Marshal(encoded[0])
+	var entry struct {
+		Deploy map[string]string   `json:"deploy"`
+		Items  []map[string]string `json:"items"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Deploy["token"] != redactedValue || entry.Deploy["region"] != "eu" {
+		t.Errorf("deploy = %v, want token redacted and region kept", entry.Deploy)
+	}
+	if entry.Items[0]["token"] != redactedValue {
+		t.Errorf("items[0].token = %q, want %q", entry.Items[0]["token"], redactedValue)
+	}
+}
+
+// TestLogWriterCloseAccountsForEveryLine closes an async writer while lines
+// are still being written. Each line must end up buffered or counted as
+// dropped; none may be stranded in the queue after run has drained it.
+func TestLogWriterCloseAccountsForEveryLine(t *testing.T) {
+	for round := 0; round < 5; round++ {
+		w, err := NewLogWriter(LogConfig{
+			// Nothing listens here, so delivered lines are buffered
+			Host:          "127.0.0.1:1",
+			BufferSize:    100000,
+			Async:         true,
+			FlushInterval: time.Millisecond,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var written atomic.Uint64
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					w.Write([]byte(`{"message":"hello"}`))
+					written.Add(1)
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		w.Close()
+		wg.Wait()
+
+		stats := w.Stats()
+		if got := uint64(stats.Buffered) + stats.Dropped; got != written.Load() {
+			t.Fatalf("round %d: buffered %d + dropped %d = %d, want all %d written lines", round, stats.Buffered, stats.Dropped, got, written.Load())
+		}
+	}
+}
+
+func TestLogWriterMetricsShareRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	for _, cfg := range []LogConfig{
+		{Host: "127.0.0.1:1", ServiceName: "payment_service"},
+		{Host: "127.0.0.1:1", ServiceName: "subscription_service"},
+		{Host: "127.0.0.1:2", ServiceName: "subscription_service"},
+	} {
+		w, err := NewLogWriter(cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		// Panics on a duplicate registration
+		w.RegisterMetrics(registry)
+	}
+
+	names := gatheredNames(t, registry)
+	for _, name := range []string{"payment_service_logstash_connected", "subscription_service_logstash_connected"} {
+		if !names[name] {
+			t.Errorf("%s not registered", name)
+		}
+	}
+}
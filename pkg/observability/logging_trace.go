@@ -0,0 +1,71 @@
+package observability
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// correlatedBaggageKeys are the baggage members copied onto log lines.
+var correlatedBaggageKeys = []string{"user.id", "tenant.id"}
+
+// LogWithTrace returns a child of logger carrying the trace_id and span_id of
+// the span in ctx, the request_id set by RequestIDMiddleware, and the user.id
+// and tenant.id baggage members, so a log line can be followed to its trace.
+// logger is returned unchanged when ctx holds none of these.
+func LogWithTrace(ctx context.Context, logger zerolog.Logger) zerolog.Logger {
+	logCtx := logger.With()
+
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		logCtx = logCtx.
+			Str("trace_id", sc.TraceID().String()).
+			Str("span_id", sc.SpanID().String())
+	}
+
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		logCtx = logCtx.Str("request_id", requestID)
+	}
+
+	for _, key := range correlatedBaggageKeys {
+		if value := BaggageValue(ctx, key); value != "" {
+			logCtx = logCtx.Str(key, value)
+		}
+	}
+
+	return logCtx.Logger()
+}
+
+// TraceHook adds the trace_id and span_id of the span in an event's context
+// to the event. zerolog events only carry a context when one is set with
+// Event.Ctx or on the logger with Ctx, so install the hook once with
+// logger.Hook(TraceHook{}) and derive request loggers with Ctx. Unlike
+// LogWithTrace, the IDs are read when each event is written.
+type TraceHook struct{}
+
+func (TraceHook) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if sc := trace.SpanContextFromContext(e.GetCtx()); sc.IsValid() {
+		e.Str("trace_id", sc.TraceID().String()).
+			Str("span_id", sc.SpanID().String())
+	}
+}
+
+// Ctx returns a child of logger whose events carry ctx, so a TraceHook on
+// logger tags them with the span in ctx.
+func Ctx(logger zerolog.Logger, ctx context.Context) zerolog.Logger {
+	return logger.With().Ctx(ctx).Logger()
+}
+
+// SampledLevel ties log verbosity to trace sampling: it returns logger at
+// Debug when the span in ctx is sampled, so the traces worth inspecting keep
+// their detail, and at Info otherwise. A logger already above Info keeps its
+// level, and the global level still applies to both.
+func SampledLevel(ctx context.Context, logger zerolog.Logger) zerolog.Logger {
+	if trace.SpanContextFromContext(ctx).IsSampled() {
+		return logger.Level(zerolog.DebugLevel)
+	}
+	if logger.GetLevel() < zerolog.InfoLevel {
+		return logger.Level(zerolog.InfoLevel)
+	}
+	return logger
+}
@@ -0,0 +1,52 @@
+package observability
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog"
+)
+
+// LogLevelBody is the body of GET and PUT /debug/loglevel.
+type LogLevelBody struct {
+	Level string `json:"level"`
+}
+
+// LogLevelHandler reports the global zerolog level on GET and replaces it on
+// PUT {"level":"info"}. zerolog stores the global level atomically and every
+// logger consults it before building an event, so a change applies to all
+// loggers at once without a restart. A logger given its own higher level,
+// as SampledLevel does for unsampled requests, keeps it. Serve it behind
+// SecureMetricsHandler, and only when MetricsAuthConfig.Enabled.
+func LogLevelHandler(logger zerolog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var body LogLevelBody
+			if err := DecodeJSON(w, r, &body, 1<<10); err != nil {
+				return
+			}
+			level, err := zerolog.ParseLevel(body.Level)
+			if err != nil || body.Level == "" {
+				WriteError(w, r, http.StatusBadRequest, "INVALID_LEVEL",
+					"level must be one of trace, debug, info, warn, error, fatal, panic or disabled")
+				return
+			}
+
+			previous := zerolog.GlobalLevel()
+			zerolog.SetGlobalLevel(level)
+			// Warn so the change is logged at any level up to warn
+			logger.Warn().
+				Str("previous_level", previous.String()).
+				Str("level", level.String()).
+				Str("client_ip", r.RemoteAddr).
+				Msg("Log level changed")
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+
+		Respond(w, r, http.StatusOK, LogLevelBody{Level: zerolog.GlobalLevel().String()})
+	}
+}
@@ -1,11 +1,13 @@
 package observability
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -15,6 +17,9 @@ type MetricsConfig struct {
 	ServiceName string
 	Labels      []string
 	Registry    *prometheus.Registry
+	// ErrorsByEndpoint adds an endpoint label to ErrorsTotal. It is opt-in so
+	// existing dashboards keep their label set until they are updated.
+	ErrorsByEndpoint bool
 }
 
 type Metrics struct {
@@ -25,6 +30,14 @@ type Metrics struct {
 	RequestDuration    *prometheus.HistogramVec
 	ActiveRequests     prometheus.Gauge
 	PaymentsProcessed  *prometheus.CounterVec
+	PaymentDuration    *prometheus.HistogramVec
+	RefundsTotal       *prometheus.CounterVec
+	FraudFlagsTotal    *prometheus.CounterVec
+
+	// Endpoints bounds the endpoint label; nil uses the raw path
+	Endpoints *LabelSanitizer
+
+	errorsByEndpoint bool
 }
 
 type ResponseWriter struct {
@@ -38,7 +51,7 @@ func (rw *ResponseWriter) WriteHeader(code int) {
 }
 
 func NewMetrics(cfg MetricsConfig) *Metrics {
-	m := &Metrics{}
+	m := &Metrics{errorsByEndpoint: cfg.ErrorsByEndpoint}
 
 	commonLabels := append([]string{}, cfg.Labels...)
 
@@ -55,6 +68,31 @@ func NewMetrics(cfg MetricsConfig) *Metrics {
 		[]string{"plan", "status"},
 	)
 
+	m.PaymentDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    cfg.ServiceName + "_payment_processing_duration_seconds",
+			Help:    "Time spent processing payments by plan and outcome",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"plan", "status"},
+	)
+
+	m.RefundsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: cfg.ServiceName + "_refunds_total",
+			Help: "Total number of refunds by reason",
+		},
+		[]string{"reason"},
+	)
+
+	m.FraudFlagsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: cfg.ServiceName + "_fraud_flags_total",
+			Help: "Total number of payments flagged as suspected fraud by rule",
+		},
+		[]string{"rule"},
+	)
+
 	m.UnsubscribesByPlan = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: cfg.ServiceName + "_unsubscribes_by_plan",
@@ -71,12 +109,16 @@ func NewMetrics(cfg MetricsConfig) *Metrics {
 		append([]string{"method", "endpoint"}, commonLabels...),
 	)
 
+	errorLabels := []string{"method", "error_type"}
+	if cfg.ErrorsByEndpoint {
+		errorLabels = []string{"method", "endpoint", "error_type"}
+	}
 	m.ErrorsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: fmt.Sprintf("%s_errors_total", cfg.ServiceName),
 			Help: "Total number of errors by method and type",
 		},
-		append([]string{"method", "error_type"}, commonLabels...),
+		append(errorLabels, commonLabels...),
 	)
 
 	m.RequestDuration = prometheus.NewHistogramVec(
@@ -99,6 +141,9 @@ func NewMetrics(cfg MetricsConfig) *Metrics {
 		cfg.Registry.MustRegister(
 			m.QueueLength,
 			m.PaymentsProcessed,
+			m.PaymentDuration,
+			m.RefundsTotal,
+			m.FraudFlagsTotal,
 			m.UnsubscribesByPlan,
 			m.RequestsTotal,
 			m.ErrorsTotal,
@@ -108,6 +153,10 @@ func NewMetrics(cfg MetricsConfig) *Metrics {
 	} else {
 		prometheus.MustRegister(
 			m.QueueLength,
+			m.PaymentsProcessed,
+			m.PaymentDuration,
+			m.RefundsTotal,
+			m.FraudFlagsTotal,
 			m.UnsubscribesByPlan,
 			m.RequestsTotal,
 			m.ErrorsTotal,
@@ -119,6 +168,39 @@ func NewMetrics(cfg MetricsConfig) *Metrics {
 	return m
 }
 
+// RegisterRuntimeMetrics adds Go runtime (GC, heap, goroutines) and process
+// (CPU, memory, open fds) collectors to reg, or to the default registry when
+// reg is nil. Collectors already registered, as both are on the default
+// registry, are skipped.
+func RegisterRuntimeMetrics(reg *prometheus.Registry) {
+	var registerer prometheus.Registerer = prometheus.DefaultRegisterer
+	if reg != nil {
+		registerer = reg
+	}
+
+	for _, collector := range []prometheus.Collector{
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	} {
+		if err := registerer.Register(collector); err != nil {
+			var already prometheus.AlreadyRegisteredError
+			if !errors.As(err, &already) {
+				panic(err)
+			}
+		}
+	}
+}
+
+// RecordError increments ErrorsTotal, including endpoint only when the
+// metrics were built with ErrorsByEndpoint.
+func (m *Metrics) RecordError(method, endpoint, errorType string) {
+	if m.errorsByEndpoint {
+		m.ErrorsTotal.WithLabelValues(method, endpoint, errorType).Inc()
+		return
+	}
+	m.ErrorsTotal.WithLabelValues(method, errorType).Inc()
+}
+
 func InstrumentHandler(next http.HandlerFunc, metrics *Metrics) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
@@ -136,16 +218,17 @@ func InstrumentHandler(next http.HandlerFunc, metrics *Metrics) http.HandlerFunc
 		metrics.ActiveRequests.Inc()
 		defer metrics.ActiveRequests.Dec()
 
-		metrics.RequestsTotal.WithLabelValues(r.Method, r.URL.Path).Inc()
+		endpoint := metrics.Endpoints.Endpoint(r.URL.Path)
+		metrics.RequestsTotal.WithLabelValues(r.Method, endpoint).Inc()
 
 		wrapped := &ResponseWriter{ResponseWriter: w, Status: http.StatusOK}
 		next.ServeHTTP(wrapped, r.WithContext(ctx))
 
 		duration := time.Since(startTime).Seconds()
-		metrics.RequestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
+		metrics.RequestDuration.WithLabelValues(r.Method, endpoint).Observe(duration)
 
 		if wrapped.Status >= 400 {
-			metrics.ErrorsTotal.WithLabelValues(r.Method, fmt.Sprintf("http_%d", wrapped.Status)).Inc()
+			metrics.RecordError(r.Method, endpoint, fmt.Sprintf("http_%d", wrapped.Status))
 		}
 	}
 }
@@ -0,0 +1,80 @@
+package observability
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// MetricsAuthConfig restricts who may scrape /metrics. Both checks are
+// optional; with neither set the handler is served unchanged, which keeps
+// local demos working without credentials.
+type MetricsAuthConfig struct {
+	// BearerToken, when set, must be sent as "Authorization: Bearer <token>".
+	BearerToken string
+	// AllowedCIDRs, when set, limits scrapes to these source networks.
+	AllowedCIDRs []string
+}
+
+// Enabled reports whether either check is configured. Endpoints more
+// sensitive than /metrics should only be served when it is true.
+func (c MetricsAuthConfig) Enabled() bool {
+	return c.BearerToken != "" || len(c.AllowedCIDRs) > 0
+}
+
+// SecureMetricsHandler wraps h so requests from outside AllowedCIDRs get 403
+// and requests without the bearer token get 401. The source address is taken
+// from the connection, not from X-Forwarded-For, so it cannot be spoofed by
+// the client.
+func SecureMetricsHandler(h http.Handler, cfg MetricsAuthConfig) (http.Handler, error) {
+	if !cfg.Enabled() {
+		return h, nil
+	}
+
+	networks := make([]*net.IPNet, 0, len(cfg.AllowedCIDRs))
+	for _, cidr := range cfg.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid metrics CIDR %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+
+	expected := []byte("Bearer " + cfg.BearerToken)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(networks) > 0 && !remoteAddrAllowed(r.RemoteAddr, networks) {
+			WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "Client address is not allowed")
+			return
+		}
+
+		if cfg.BearerToken != "" &&
+			subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			WriteError(w, r, http.StatusUnauthorized, "UNAUTHORIZED", "Missing or invalid bearer token")
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}), nil
+}
+
+func remoteAddrAllowed(remoteAddr string, networks []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecureMetricsHandler(t *testing.T) {
+	scraped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler, err := SecureMetricsHandler(scraped, MetricsAuthConfig{
+		BearerToken:  "scrape-token",
+		AllowedCIDRs: []string{"10.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		auth       string
+		want       int
+	}{
+		{"outside allowed CIDRs", "192.0.2.1:4000", "Bearer scrape-token", http.StatusForbidden},
+		{"missing token", "10.1.2.3:4000", "", http.StatusUnauthorized},
+		{"wrong token", "10.1.2.3:4000", "Bearer other", http.StatusUnauthorized},
+		{"allowed", "10.1.2.3:4000", "Bearer scrape-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			req.RemoteAddr = tt.remoteAddr
+			// Forwarded headers must not widen the allowed networks
+			req.Header.Set("X-Forwarded-For", "10.1.2.3")
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestSecureMetricsHandlerDisabled(t *testing.T) {
+	scraped := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler, err := SecureMetricsHandler(scraped, MetricsAuthConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d without auth configured", rec.Code, http.StatusOK)
+	}
+
+	if _, err := SecureMetricsHandler(scraped, MetricsAuthConfig{AllowedCIDRs: []string{"not-a-cidr"}}); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+}
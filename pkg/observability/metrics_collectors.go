@@ -0,0 +1,51 @@
+package observability
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PlanCounter reports the current number of subscriptions per plan.
+type PlanCounter interface {
+	CountByPlan() map[string]int
+}
+
+// ActiveSubscriptionsCollector exposes active subscriptions per plan, read
+// from the repository at scrape time. Unlike the event-driven
+// MetricsV3.SubscriptionsActive gauge it cannot drift: a restart, a missed
+// delete or a plan change is reflected on the next scrape.
+type ActiveSubscriptionsCollector struct {
+	mu     sync.Mutex // serialises concurrent scrapes around Reset
+	gauge  *prometheus.GaugeVec
+	source PlanCounter
+}
+
+func NewActiveSubscriptionsCollector(serviceName string, source PlanCounter) *ActiveSubscriptionsCollector {
+	return &ActiveSubscriptionsCollector{
+		gauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: serviceName + "_v3_subscriptions_active_by_plan",
+				Help: "Current number of active subscriptions by plan, read from the repository",
+			},
+			[]string{"plan"},
+		),
+		source: source,
+	}
+}
+
+func (c *ActiveSubscriptionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.gauge.Describe(ch)
+}
+
+func (c *ActiveSubscriptionsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Reset so plans with no subscriptions left disappear
+	c.gauge.Reset()
+	for plan, count := range c.source.CountByPlan() {
+		c.gauge.WithLabelValues(plan).Set(float64(count))
+	}
+	c.gauge.Collect(ch)
+}
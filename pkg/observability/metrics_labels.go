@@ -0,0 +1,141 @@
+package observability
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// OtherLabelValue replaces endpoint labels that match no known route or
+	// arrive after the distinct-value cap has been reached.
+	OtherLabelValue = "other"
+
+	defaultMaxLabelValues = 100
+)
+
+type LabelSanitizerConfig struct {
+	ServiceName string
+	// Patterns are the known routes, e.g. "/v3/subscriptions/{id}". A
+	// segment in braces matches any single non-empty path segment. With no
+	// patterns every path is passed through, subject to MaxValues.
+	Patterns []string
+	// MaxValues caps the distinct endpoint values handed out. Defaults to 100.
+	MaxValues int
+	Registry  *prometheus.Registry
+}
+
+// LabelSanitizer keeps endpoint labels bounded. Labelling metrics with the
+// raw r.URL.Path lets a scanner probing random IDs create one time series per
+// request; the sanitizer maps paths onto their route pattern instead and
+// reports unknown paths as "other".
+//
+// The values it hands out are a fixed set: the first MaxValues distinct
+// values seen are kept for the life of the process, and any value after that
+// is reported as "other", counting each such request in
+// <service>_metrics_label_overflow_total. Nothing is evicted, not even
+// values that stop being requested. An LRU would not bound anything here,
+// since the series of an evicted value stay in the registry, and deleting
+// them would reset counters that rate() depends on.
+//
+// A nil *LabelSanitizer passes paths through unchanged.
+type LabelSanitizer struct {
+	patterns  [][]string
+	maxValues int
+	overflow  prometheus.Counter
+
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+func NewLabelSanitizer(cfg LabelSanitizerConfig) *LabelSanitizer {
+	s := &LabelSanitizer{
+		maxValues: cfg.MaxValues,
+		seen:      make(map[string]struct{}),
+	}
+	if s.maxValues <= 0 {
+		s.maxValues = defaultMaxLabelValues
+	}
+	for _, pattern := range cfg.Patterns {
+		s.patterns = append(s.patterns, strings.Split(pattern, "/"))
+	}
+
+	s.overflow = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: cfg.ServiceName + "_metrics_label_overflow_total",
+		Help: "Requests whose endpoint label was replaced because the distinct-value cap was reached",
+	})
+
+	if cfg.Registry != nil {
+		cfg.Registry.MustRegister(s.overflow)
+	} else {
+		// Use default registry when nil is passed
+		prometheus.MustRegister(s.overflow)
+	}
+
+	return s
+}
+
+// Endpoint returns the label value to use for path.
+func (s *LabelSanitizer) Endpoint(path string) string {
+	if s == nil {
+		return path
+	}
+
+	value := path
+	if len(s.patterns) > 0 {
+		value = s.match(path)
+		if value == OtherLabelValue {
+			return value
+		}
+	}
+
+	s.mu.RLock()
+	_, known := s.seen[value]
+	s.mu.RUnlock()
+	if known {
+		return value
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, known := s.seen[value]; known {
+		return value
+	}
+	if len(s.seen) >= s.maxValues {
+		s.overflow.Inc()
+		return OtherLabelValue
+	}
+	s.seen[value] = struct{}{}
+	return value
+}
+
+// match returns the first pattern path satisfies, or OtherLabelValue.
+func (s *LabelSanitizer) match(path string) string {
+	segments := strings.Split(path, "/")
+
+	for _, pattern := range s.patterns {
+		if len(pattern) != len(segments) {
+			continue
+		}
+		matched := true
+		for i, part := range pattern {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				if segments[i] == "" {
+					matched = false
+					break
+				}
+				continue
+			}
+			if part != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return strings.Join(pattern, "/")
+		}
+	}
+
+	return OtherLabelValue
+}
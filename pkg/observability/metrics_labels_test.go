@@ -0,0 +1,75 @@
+package observability
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLabelSanitizerKeepsFirstValues(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	endpoints := NewLabelSanitizer(LabelSanitizerConfig{
+		ServiceName: "labels_test",
+		MaxValues:   2,
+		Registry:    registry,
+	})
+
+	for _, path := range []string{"/a", "/b", "/a"} {
+		if got := endpoints.Endpoint(path); got != path {
+			t.Errorf("Endpoint(%s) = %s, want it kept", path, got)
+		}
+	}
+
+	// Once the set is full, new values are capped and the old ones stay,
+	// however recently they were used
+	for i := 0; i < 3; i++ {
+		if got := endpoints.Endpoint("/c"); got != OtherLabelValue {
+			t.Errorf("Endpoint(/c) = %s, want %s", got, OtherLabelValue)
+		}
+	}
+	if got := endpoints.Endpoint("/b"); got != "/b" {
+		t.Errorf("Endpoint(/b) = %s, want it kept", got)
+	}
+
+	if got := gatheredCounter(t, registry, "labels_test_metrics_label_overflow_total"); got != 3 {
+		t.Errorf("overflow = %v, want 3", got)
+	}
+}
+
+func TestLabelSanitizerPatterns(t *testing.T) {
+	endpoints := NewLabelSanitizer(LabelSanitizerConfig{
+		ServiceName: "patterns_test",
+		Patterns:    []string{"/v3/subscriptions", "/v3/subscriptions/{id}"},
+		Registry:    prometheus.NewRegistry(),
+	})
+
+	tests := map[string]string{
+		"/v3/subscriptions":         "/v3/subscriptions",
+		"/v3/subscriptions/sub_123": "/v3/subscriptions/{id}",
+		"/v3/subscriptions/":        OtherLabelValue,
+		"/admin":                    OtherLabelValue,
+	}
+	for path, want := range tests {
+		if got := endpoints.Endpoint(path); got != want {
+			t.Errorf("Endpoint(%s) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+// gatheredCounter returns the summed value of the counter family name.
+func gatheredCounter(t *testing.T, registry *prometheus.Registry, name string) float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total float64
+	for _, family := range families {
+		if family.GetName() == name {
+			for _, metric := range family.GetMetric() {
+				total += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,68 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+const defaultOTLPMetricsInterval = 15 * time.Second
+
+type OTLPMetricsConfig struct {
+	ServiceName string
+	// Endpoint is the collector's OTLP/gRPC address, either host:port or a
+	// URL. Falls back to OTEL_EXPORTER_OTLP_ENDPOINT.
+	Endpoint string
+	// Interval between exports. Defaults to 15s, matching a typical scrape.
+	Interval time.Duration
+}
+
+// InitOTLPMetrics sets up a MeterProvider that pushes to an OpenTelemetry
+// collector on a fixed interval and installs it as the global provider, so
+// instruments created through otel.Meter are exported over OTLP. It is
+// additive: the Prometheus metrics keep being served on /metrics for
+// scraping.
+//
+// The existing Prometheus collectors are not mirrored automatically. To send
+// them through the collector too, either have the collector scrape /metrics
+// with its prometheus receiver, or add a reader built with
+// go.opentelemetry.io/contrib/bridges/prometheus to the provider.
+//
+// The returned function flushes pending metrics and shuts the provider down.
+func InitOTLPMetrics(cfg OTLPMetricsConfig) (*metric.MeterProvider, func(context.Context) error, error) {
+	var opts []otlpmetricgrpc.Option
+	if host, insecure, ok := resolveOTLPEndpoint(cfg.Endpoint); ok {
+		opts = append(opts, otlpmetricgrpc.WithEndpoint(host))
+		if insecure {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		}
+	}
+
+	exporter, err := otlpmetricgrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = defaultOTLPMetricsInterval
+	}
+
+	mp := metric.NewMeterProvider(
+		metric.WithReader(metric.NewPeriodicReader(exporter, metric.WithInterval(interval))),
+		metric.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(cfg.ServiceName),
+		)),
+	)
+
+	otel.SetMeterProvider(mp)
+
+	return mp, mp.Shutdown, nil
+}
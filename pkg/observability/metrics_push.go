@@ -0,0 +1,63 @@
+package observability
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/rs/zerolog"
+)
+
+// finalPushTimeout bounds the last push PushPeriodically makes after its
+// context is cancelled.
+const finalPushTimeout = 5 * time.Second
+
+// PushConfig describes where short-lived jobs push their metrics. A nil
+// Registry pushes the default registry.
+type PushConfig struct {
+	Gateway  string
+	Job      string
+	Registry *prometheus.Registry
+}
+
+// PushMetrics pushes the current metric values to the Pushgateway, replacing
+// any earlier push for the same job. Use it for batch or cron workloads that
+// exit before Prometheus could scrape them.
+func PushMetrics(ctx context.Context, cfg PushConfig) error {
+	var gatherer prometheus.Gatherer = prometheus.DefaultGatherer
+	if cfg.Registry != nil {
+		gatherer = cfg.Registry
+	}
+	return push.New(cfg.Gateway, cfg.Job).Gatherer(gatherer).PushContext(ctx)
+}
+
+// PushPeriodically pushes every interval in a background goroutine until ctx
+// is cancelled, then pushes once more so the final values are not lost.
+// Failures are logged and retried on the next tick. The returned channel is
+// closed once the final push has finished; wait on it before exiting.
+func PushPeriodically(ctx context.Context, interval time.Duration, cfg PushConfig, logger zerolog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := PushMetrics(ctx, cfg); err != nil {
+					logger.Warn().Err(err).Str("gateway", cfg.Gateway).Msg("Failed to push metrics")
+				}
+			case <-ctx.Done():
+				finalCtx, cancel := context.WithTimeout(context.Background(), finalPushTimeout)
+				if err := PushMetrics(finalCtx, cfg); err != nil {
+					logger.Error().Err(err).Str("gateway", cfg.Gateway).Msg("Failed to push final metrics")
+				}
+				cancel()
+				return
+			}
+		}
+	}()
+	return done
+}
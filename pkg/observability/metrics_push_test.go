@@ -0,0 +1,54 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestPushPeriodicallyFinalPush(t *testing.T) {
+	var pushes atomic.Int32
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/job/push_test") {
+			pushes.Add(1)
+		}
+	}))
+	defer gateway.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{Name: "push_test_total", Help: "test"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := PushPeriodically(ctx, time.Hour, PushConfig{Gateway: gateway.URL, Job: "push_test", Registry: registry}, zerolog.Nop())
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(finalPushTimeout + time.Second):
+		t.Fatal("done was not closed after the final push")
+	}
+	if got := pushes.Load(); got != 1 {
+		t.Errorf("pushes = %d, want the final push only", got)
+	}
+}
+
+func TestPushPeriodicallyLogsFailures(t *testing.T) {
+	var logs bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	// Nothing listens here, so the final push fails
+	done := PushPeriodically(ctx, time.Hour, PushConfig{Gateway: "http://127.0.0.1:1", Job: "push_test"}, zerolog.New(&logs))
+	cancel()
+	<-done
+
+	if !strings.Contains(logs.String(), "Failed to push final metrics") {
+		t.Errorf("logs = %q, want the failed final push", logs.String())
+	}
+}
@@ -0,0 +1,24 @@
+package observability
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// NewConfigReloadCounter creates <service>_config_reloads_total, labelled by
+// result ("success" or "failure").
+func NewConfigReloadCounter(serviceName string, reg *prometheus.Registry) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: serviceName + "_config_reloads_total",
+			Help: "Total number of configuration reloads by result",
+		},
+		[]string{"result"},
+	)
+
+	if reg != nil {
+		reg.MustRegister(counter)
+	} else {
+		// Use default registry when nil is passed
+		prometheus.MustRegister(counter)
+	}
+
+	return counter
+}
@@ -0,0 +1,24 @@
+package observability
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// MetricsSet groups the V1, V2 and V3 metrics of one service.
+type MetricsSet struct {
+	V1 *MetricsV1
+	V2 *MetricsV2
+	V3 *MetricsV3
+}
+
+// NewMetricsSet builds all three metric versions against one fresh registry
+// and returns it alongside the set, so callers can serve exactly these
+// metrics with promhttp.HandlerFor, or scope a registry per test, instead of
+// relying on the global default registry.
+func NewMetricsSet(serviceName string) (*MetricsSet, *prometheus.Registry) {
+	reg := prometheus.NewRegistry()
+
+	return &MetricsSet{
+		V1: NewMetricsV1(serviceName, reg),
+		V2: NewMetricsV2(serviceName, reg),
+		V3: NewMetricsV3(serviceName, reg),
+	}, reg
+}
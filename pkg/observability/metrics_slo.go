@@ -0,0 +1,78 @@
+package observability
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type SLOConfig struct {
+	ServiceName string
+	// Target is the fraction of good requests, e.g. 0.99.
+	Target float64
+	// Window is the SLO period, exposed as the window label on the target
+	// gauge so burn-rate rules can pick the matching range.
+	Window time.Duration
+	// LatencyObjective marks successful requests slower than this as bad.
+	// Zero disables the latency check.
+	LatencyObjective time.Duration
+}
+
+// SLORecorder classifies requests as good or bad against an SLO and exposes
+// the counts together with the target, the building blocks for error-budget
+// burn-rate alerts:
+//
+//	(rate(bad[1h]) / (rate(good[1h]) + rate(bad[1h]))) / (1 - slo_target)
+//
+// A nil *SLORecorder records nothing.
+type SLORecorder struct {
+	good             prometheus.Counter
+	bad              prometheus.Counter
+	target           prometheus.Gauge
+	latencyObjective time.Duration
+}
+
+func NewSLORecorder(reg *prometheus.Registry, cfg SLOConfig) *SLORecorder {
+	s := &SLORecorder{latencyObjective: cfg.LatencyObjective}
+
+	s.good = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: cfg.ServiceName + "_slo_good_requests_total",
+		Help: "Requests that met the SLO",
+	})
+
+	s.bad = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: cfg.ServiceName + "_slo_bad_requests_total",
+		Help: "Requests that failed or exceeded the latency objective",
+	})
+
+	s.target = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        cfg.ServiceName + "_slo_target",
+		Help:        "SLO target as a fraction of good requests",
+		ConstLabels: prometheus.Labels{"window": cfg.Window.String()},
+	})
+	s.target.Set(cfg.Target)
+
+	if reg != nil {
+		reg.MustRegister(s.good, s.bad, s.target)
+	} else {
+		// Use default registry when nil is passed
+		prometheus.MustRegister(s.good, s.bad, s.target)
+	}
+
+	return s
+}
+
+// RecordRequest counts a request as bad when it returned a 5xx status or took
+// longer than the latency objective, and as good otherwise. Client errors
+// count as good since they do not consume the service's error budget.
+func (s *SLORecorder) RecordRequest(status int, duration time.Duration) {
+	if s == nil {
+		return
+	}
+
+	if status >= 500 || (s.latencyObjective > 0 && duration > s.latencyObjective) {
+		s.bad.Inc()
+		return
+	}
+	s.good.Inc()
+}
@@ -0,0 +1,96 @@
+package observability
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewMetricsNilRegistryIncludesPayments(t *testing.T) {
+	metrics := NewMetrics(MetricsConfig{ServiceName: "metrics_default_test"})
+	metrics.PaymentsProcessed.WithLabelValues("premium", "success").Inc()
+	metrics.QueueLength.Set(2)
+
+	names := gatheredNames(t, prometheus.DefaultGatherer)
+	for _, name := range []string{
+		"metrics_default_test_payments_processed_total",
+		"metrics_default_test_queue_length",
+	} {
+		if !names[name] {
+			t.Errorf("%s not on the default registry", name)
+		}
+	}
+}
+
+// errorLabels returns the label names of the single ErrorsTotal series.
+func errorLabels(t *testing.T, registry *prometheus.Registry) []string {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "payment_service_errors_total" {
+			continue
+		}
+		if len(family.GetMetric()) != 1 {
+			t.Fatalf("%d error series, want 1", len(family.GetMetric()))
+		}
+		var labels []string
+		for _, pair := range family.GetMetric()[0].GetLabel() {
+			labels = append(labels, pair.GetName()+"="+pair.GetValue())
+		}
+		return labels
+	}
+	t.Fatal("payment_service_errors_total not registered")
+	return nil
+}
+
+func TestRecordError(t *testing.T) {
+	tests := []struct {
+		name             string
+		errorsByEndpoint bool
+		want             []string
+	}{
+		{"without endpoint", false, []string{"error_type=declined", "method=POST"}},
+		{"by endpoint", true, []string{"endpoint=/process", "error_type=declined", "method=POST"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+			metrics := NewMetrics(MetricsConfig{
+				ServiceName:      "payment_service",
+				Registry:         registry,
+				ErrorsByEndpoint: tt.errorsByEndpoint,
+			})
+			metrics.RecordError("POST", "/process", "declined")
+
+			got := errorLabels(t, registry)
+			if len(got) != len(tt.want) {
+				t.Fatalf("labels = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("labels = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterRuntimeMetrics(t *testing.T) {
+	// The default registry already has both collectors
+	RegisterRuntimeMetrics(nil)
+
+	registry := prometheus.NewRegistry()
+	RegisterRuntimeMetrics(registry)
+	RegisterRuntimeMetrics(registry)
+
+	names := gatheredNames(t, registry)
+	for _, name := range []string{"go_goroutines", "go_memstats_heap_alloc_bytes"} {
+		if !names[name] {
+			t.Errorf("%s not registered", name)
+		}
+	}
+}
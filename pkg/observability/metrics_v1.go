@@ -24,22 +24,26 @@ type MetricsV1 struct {
 	TotalErrors   prometheus.Counter
 }
 
-func NewMetricsV1(serviceName string) *MetricsV1 {
+func NewMetricsV1(serviceName string, registry *prometheus.Registry) *MetricsV1 {
 	m := &MetricsV1{}
 
-	// Bad: No labels, no context, hard-coded names
+	// Bad: No labels, no context
 	m.TotalRequests = prometheus.NewCounter(prometheus.CounterOpts{
-		Name: "requests_v1", // Bad: too generic but at least versioned
-		Help: "requests",    // Bad: unhelpful description
+		Name: serviceName + "_requests_v1", // Bad: too generic but at least versioned
+		Help: "requests",                   // Bad: unhelpful description
 	})
 
 	m.TotalErrors = prometheus.NewCounter(prometheus.CounterOpts{
-		Name: "errors_v1", // Bad: too generic but at least versioned
-		Help: "errors",    // Bad: unhelpful description
+		Name: serviceName + "_errors_v1", // Bad: too generic but at least versioned
+		Help: "errors",                   // Bad: unhelpful description
 	})
 
-	// Register with default registry (bad practice in production)
-	prometheus.MustRegister(m.TotalRequests, m.TotalErrors)
+	if registry != nil {
+		registry.MustRegister(m.TotalRequests, m.TotalErrors)
+	} else {
+		// Use default registry when nil is passed
+		prometheus.MustRegister(m.TotalRequests, m.TotalErrors)
+	}
 
 	return m
 }
@@ -0,0 +1,40 @@
+package observability
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatheredNames returns the names of the metric families g exposes.
+func gatheredNames(t *testing.T, g prometheus.Gatherer) map[string]bool {
+	t.Helper()
+	families, err := g.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool, len(families))
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	return names
+}
+
+func TestNewMetricsV1SeparateRegistries(t *testing.T) {
+	first := prometheus.NewRegistry()
+	second := prometheus.NewRegistry()
+
+	a := NewMetricsV1("subscription_service", first)
+	b := NewMetricsV1("subscription_service", second)
+	a.TotalRequests.Inc()
+	b.TotalErrors.Inc()
+
+	for _, registry := range []*prometheus.Registry{first, second} {
+		names := gatheredNames(t, registry)
+		for _, name := range []string{"subscription_service_requests_v1", "subscription_service_errors_v1"} {
+			if !names[name] {
+				t.Errorf("%s not registered", name)
+			}
+		}
+	}
+}
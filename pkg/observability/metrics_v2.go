@@ -28,6 +28,9 @@ type MetricsV2 struct {
 	RequestDuration    *prometheus.HistogramVec
 	ActiveRequests     prometheus.Gauge
 	SubscriptionsTotal prometheus.Counter // Better: business metric
+
+	// Endpoints bounds the endpoint label; nil uses the raw path
+	Endpoints *LabelSanitizer
 }
 
 func NewMetricsV2(serviceName string, registry *prometheus.Registry) *MetricsV2 {
@@ -86,6 +89,15 @@ func NewMetricsV2(serviceName string, registry *prometheus.Registry) *MetricsV2
 			m.ActiveRequests,
 			m.SubscriptionsTotal,
 		)
+	} else {
+		// Use default registry when nil is passed
+		prometheus.MustRegister(
+			m.RequestsTotal,
+			m.ErrorsTotal,
+			m.RequestDuration,
+			m.ActiveRequests,
+			m.SubscriptionsTotal,
+		)
 	}
 
 	return m
@@ -111,7 +123,7 @@ func InstrumentHandlerV2(next http.HandlerFunc, metrics *MetricsV2) http.Handler
 		defer metrics.ActiveRequests.Dec()
 
 		// Better: Count with labels
-		metrics.RequestsTotal.WithLabelValues(r.Method, r.URL.Path).Inc()
+		metrics.RequestsTotal.WithLabelValues(r.Method, metrics.Endpoints.Endpoint(r.URL.Path)).Inc()
 
 		wrapped := &ResponseWriter{ResponseWriter: w, Status: http.StatusOK}
 		next.ServeHTTP(wrapped, r.WithContext(ctx))
@@ -0,0 +1,29 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewMetricsV2NilRegistryUsesDefault(t *testing.T) {
+	// A name of its own keeps the default registry free of clashes
+	metrics := NewMetricsV2("metrics_v2_test", nil)
+	handler := InstrumentHandlerV2(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}, metrics)
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v2/subscriptions", nil))
+
+	names := gatheredNames(t, prometheus.DefaultGatherer)
+	for _, name := range []string{
+		"metrics_v2_test_v2_requests_total",
+		"metrics_v2_test_v2_request_duration_seconds",
+		"metrics_v2_test_v2_active_requests",
+	} {
+		if !names[name] {
+			t.Errorf("%s not on the default registry", name)
+		}
+	}
+}
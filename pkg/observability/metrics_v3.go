@@ -3,6 +3,7 @@ package observability
 import (
 	"fmt"
 	"net/http"
+	"runtime"
 	"strconv"
 	"time"
 
@@ -25,15 +26,21 @@ import (
 type MetricsV3 struct {
 	// SLI Metrics - Service Level Indicators
 	HTTPRequestsTotal    *prometheus.CounterVec
-	HTTPRequestDuration  *prometheus.HistogramVec
+	HTTPRequestDuration  prometheus.ObserverVec // histogram, or summary with UseSummary
 	HTTPRequestsInFlight prometheus.Gauge
+	HTTPRequestSize      *prometheus.HistogramVec
+	HTTPResponseSize     *prometheus.HistogramVec
 
 	// Business Metrics - Domain specific
 	SubscriptionsCreated  *prometheus.CounterVec
 	SubscriptionsActive   prometheus.Gauge
+	SubscriptionsExpired  *prometheus.CounterVec
 	SubscriptionRevenue   *prometheus.CounterVec
 	PaymentProcessingTime *prometheus.HistogramVec
 	PaymentFailures       *prometheus.CounterVec
+	PaymentCircuitState   prometheus.Gauge // 0 closed, 1 half-open, 2 open
+	PaymentQueueDepth     prometheus.Gauge
+	PaymentAmountMismatch *prometheus.CounterVec
 
 	// System Metrics - Resource utilization
 	ServiceUptime  prometheus.Gauge
@@ -42,9 +49,77 @@ type MetricsV3 struct {
 	// Error Metrics - Detailed error classification
 	BusinessErrors  *prometheus.CounterVec
 	TechnicalErrors *prometheus.CounterVec
+
+	// Endpoints bounds the endpoint label; nil uses the raw path
+	Endpoints *LabelSanitizer
+	// SLO classifies each request against the SLO; nil disables it
+	SLO *SLORecorder
+}
+
+// MetricsV3Config tunes MetricsV3 beyond the defaults used by NewMetricsV3.
+//
+// UseSummary records request latency in a summary instead of a histogram.
+// Summaries compute exact quantiles on the client, so they need no bucket
+// layout, but their quantiles cannot be aggregated across instances or
+// re-sliced by label in PromQL, and each series costs more to maintain.
+// Histograms allow histogram_quantile over any aggregation at the price of
+// bucket-limited accuracy, which is why they remain the default.
+type MetricsV3Config struct {
+	ServiceName string
+	Registry    *prometheus.Registry
+
+	UseSummary bool
+	// SummaryObjectives maps quantiles to their allowed absolute error.
+	// Defaults to p50, p90 and p99.
+	SummaryObjectives map[float64]float64
+
+	// DurationBuckets and PaymentBuckets override the request and payment
+	// latency buckets. Both must be sorted ascending.
+	DurationBuckets []float64
+	PaymentBuckets  []float64
 }
 
+var (
+	defaultSummaryObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+	defaultDurationBuckets   = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10} // API-appropriate buckets
+	defaultPaymentBuckets    = []float64{.1, .25, .5, 1, 2, 5, 10}                               // Payment-specific buckets
+)
+
 func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3 {
+	// The defaults are always valid
+	m, _ := NewMetricsV3WithConfig(MetricsV3Config{ServiceName: serviceName, Registry: registry})
+	return m
+}
+
+func NewMetricsV3WithConfig(cfg MetricsV3Config) (*MetricsV3, error) {
+	serviceName, registry := cfg.ServiceName, cfg.Registry
+
+	objectives := cfg.SummaryObjectives
+	if len(objectives) == 0 {
+		objectives = defaultSummaryObjectives
+	}
+	for quantile, epsilon := range objectives {
+		if quantile <= 0 || quantile >= 1 || epsilon < 0 {
+			return nil, fmt.Errorf("invalid summary objective %v: %v", quantile, epsilon)
+		}
+	}
+
+	durationBuckets := cfg.DurationBuckets
+	if len(durationBuckets) == 0 {
+		durationBuckets = defaultDurationBuckets
+	}
+	if err := validateBuckets(durationBuckets); err != nil {
+		return nil, fmt.Errorf("invalid duration buckets: %w", err)
+	}
+
+	paymentBuckets := cfg.PaymentBuckets
+	if len(paymentBuckets) == 0 {
+		paymentBuckets = defaultPaymentBuckets
+	}
+	if err := validateBuckets(paymentBuckets); err != nil {
+		return nil, fmt.Errorf("invalid payment buckets: %w", err)
+	}
+
 	m := &MetricsV3{}
 
 	// Consistent labeling scheme across all metrics
@@ -61,15 +136,27 @@ func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3
 		httpLabels,
 	)
 
-	// Proper buckets for API response times (SLI: Latency)
-	m.HTTPRequestDuration = prometheus.NewHistogramVec(
-		prometheus.HistogramOpts{
-			Name:    serviceName + "_v3_http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds (SLI: Latency)",
-			Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}, // API-appropriate buckets
-		},
-		httpLabels,
-	)
+	if cfg.UseSummary {
+		// Client-side quantiles (SLI: Latency)
+		m.HTTPRequestDuration = prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name:       serviceName + "_v3_http_request_duration_seconds",
+				Help:       "HTTP request duration in seconds (SLI: Latency)",
+				Objectives: objectives,
+			},
+			httpLabels,
+		)
+	} else {
+		// Proper buckets for API response times (SLI: Latency)
+		m.HTTPRequestDuration = prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    serviceName + "_v3_http_request_duration_seconds",
+				Help:    "HTTP request duration in seconds (SLI: Latency)",
+				Buckets: durationBuckets,
+			},
+			httpLabels,
+		)
+	}
 
 	m.HTTPRequestsInFlight = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -78,6 +165,27 @@ func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3
 		},
 	)
 
+	// Payload sizes - outliers here often explain latency outliers
+	sizeBuckets := prometheus.ExponentialBuckets(100, 10, 6) // 100B to 10MB
+
+	m.HTTPRequestSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    serviceName + "_v3_http_request_size_bytes",
+			Help:    "HTTP request body size in bytes",
+			Buckets: sizeBuckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+
+	m.HTTPResponseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    serviceName + "_v3_http_response_size_bytes",
+			Help:    "HTTP response body size in bytes",
+			Buckets: sizeBuckets,
+		},
+		[]string{"method", "endpoint"},
+	)
+
 	// Business Metrics - Critical for business monitoring
 	m.SubscriptionsCreated = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -94,6 +202,36 @@ func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3
 		},
 	)
 
+	m.SubscriptionsExpired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: serviceName + "_v3_subscriptions_expired_total",
+			Help: "Total number of subscriptions removed after their end date",
+		},
+		[]string{"plan"},
+	)
+
+	m.PaymentCircuitState = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: serviceName + "_v3_payment_circuit_state",
+			Help: "State of the payment service circuit breaker: 0 closed, 1 half-open, 2 open",
+		},
+	)
+
+	m.PaymentQueueDepth = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: serviceName + "_v3_payment_queue_depth",
+			Help: "Number of subscription payments queued while the payment service is unavailable",
+		},
+	)
+
+	m.PaymentAmountMismatch = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: serviceName + "_v3_payment_amount_mismatch_total",
+			Help: "Total number of payments that charged a different amount than requested",
+		},
+		[]string{"plan"},
+	)
+
 	m.SubscriptionRevenue = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: serviceName + "_v3_subscription_revenue_total",
@@ -107,7 +245,7 @@ func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3
 		prometheus.HistogramOpts{
 			Name:    serviceName + "_v3_payment_processing_duration_seconds",
 			Help:    "Time spent processing payments",
-			Buckets: []float64{.1, .25, .5, 1, 2, 5, 10}, // Payment-specific buckets
+			Buckets: paymentBuckets,
 		},
 		[]string{"payment_method", "plan"},
 	)
@@ -158,11 +296,17 @@ func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3
 			m.HTTPRequestsTotal,
 			m.HTTPRequestDuration,
 			m.HTTPRequestsInFlight,
+			m.HTTPRequestSize,
+			m.HTTPResponseSize,
 			m.SubscriptionsCreated,
 			m.SubscriptionsActive,
+			m.SubscriptionsExpired,
 			m.SubscriptionRevenue,
 			m.PaymentProcessingTime,
 			m.PaymentFailures,
+			m.PaymentCircuitState,
+			m.PaymentQueueDepth,
+			m.PaymentAmountMismatch,
 			m.ServiceUptime,
 			m.GoroutineCount,
 			m.BusinessErrors,
@@ -174,11 +318,17 @@ func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3
 			m.HTTPRequestsTotal,
 			m.HTTPRequestDuration,
 			m.HTTPRequestsInFlight,
+			m.HTTPRequestSize,
+			m.HTTPResponseSize,
 			m.SubscriptionsCreated,
 			m.SubscriptionsActive,
+			m.SubscriptionsExpired,
 			m.SubscriptionRevenue,
 			m.PaymentProcessingTime,
 			m.PaymentFailures,
+			m.PaymentCircuitState,
+			m.PaymentQueueDepth,
+			m.PaymentAmountMismatch,
 			m.ServiceUptime,
 			m.GoroutineCount,
 			m.BusinessErrors,
@@ -189,7 +339,43 @@ func NewMetricsV3(serviceName string, registry *prometheus.Registry) *MetricsV3
 	// Initialize uptime
 	m.ServiceUptime.SetToCurrentTime()
 
-	return m
+	return m, nil
+}
+
+// validateBuckets reports an error unless buckets are strictly ascending.
+func validateBuckets(buckets []float64) error {
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return fmt.Errorf("bucket %v at index %d is not greater than %v", buckets[i], i, buckets[i-1])
+		}
+	}
+	return nil
+}
+
+// BusinessLabelsFromRequest returns the region and payment_method business
+// labels from the X-Region and X-Payment-Method request headers, defaulting
+// to "default" and "credit_card" when they are absent.
+func BusinessLabelsFromRequest(r *http.Request) (region, paymentMethod string) {
+	region = r.Header.Get("X-Region")
+	if region == "" {
+		region = "default"
+	}
+	paymentMethod = r.Header.Get("X-Payment-Method")
+	if paymentMethod == "" {
+		paymentMethod = "credit_card"
+	}
+	return region, paymentMethod
+}
+
+// observeWithTraceExemplar records value with a trace_id exemplar when sc
+// belongs to a sampled trace, so a latency bucket links to a trace that was
+// actually exported. Exemplars are only exposed in the OpenMetrics format.
+func observeWithTraceExemplar(observer prometheus.Observer, value float64, sc trace.SpanContext) {
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && sc.IsValid() && sc.IsSampled() {
+		exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{"trace_id": sc.TraceID().String()})
+		return
+	}
+	observer.Observe(value)
 }
 
 // V3 Handler - Best practice metrics collection
@@ -214,33 +400,43 @@ func InstrumentHandlerV3(next http.HandlerFunc, metrics *MetricsV3) http.Handler
 		// Update system metrics
 		metrics.GoroutineCount.Set(float64(getGoroutineCount()))
 
-		wrapped := &ResponseWriter{ResponseWriter: w, Status: http.StatusOK}
+		wrapped := &responseWrapperV3{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(wrapped, r.WithContext(ctx))
 
-		duration := time.Since(startTime).Seconds()
-		statusClass := getStatusClass(wrapped.Status)
+		elapsed := time.Since(startTime)
+		duration := elapsed.Seconds()
+		statusClass := getStatusClass(wrapped.statusCode)
+
+		metrics.SLO.RecordRequest(wrapped.statusCode, elapsed)
 
 		// Consistent labeling for all HTTP metrics
-		labels := []string{r.Method, r.URL.Path, statusClass}
+		endpoint := metrics.Endpoints.Endpoint(r.URL.Path)
+		labels := []string{r.Method, endpoint, statusClass}
 
 		// SLI metrics with consistent labels
 		metrics.HTTPRequestsTotal.WithLabelValues(labels...).Inc()
-		metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(duration)
+		observeWithTraceExemplar(metrics.HTTPRequestDuration.WithLabelValues(labels...), duration, span.SpanContext())
+
+		// Payload sizes; ContentLength is -1 when the request size is unknown
+		if r.ContentLength >= 0 {
+			metrics.HTTPRequestSize.WithLabelValues(r.Method, endpoint).Observe(float64(r.ContentLength))
+		}
+		metrics.HTTPResponseSize.WithLabelValues(r.Method, endpoint).Observe(float64(wrapped.bytesWritten))
 
 		// Detailed error classification
-		if wrapped.Status >= 400 {
-			if wrapped.Status >= 500 {
+		if wrapped.statusCode >= 400 {
+			if wrapped.statusCode >= 500 {
 				// Technical error
 				metrics.TechnicalErrors.WithLabelValues(
 					"http_server_error",
-					strconv.Itoa(wrapped.Status),
+					strconv.Itoa(wrapped.statusCode),
 					"high",
 				).Inc()
 			} else {
 				// Business error
 				metrics.BusinessErrors.WithLabelValues(
 					"http_client_error",
-					strconv.Itoa(wrapped.Status),
+					strconv.Itoa(wrapped.statusCode),
 					"medium",
 				).Inc()
 			}
@@ -266,7 +462,5 @@ func getStatusClass(status int) string {
 
 // Helper function to get goroutine count
 func getGoroutineCount() int {
-	// This is a placeholder - in real implementation you'd use runtime.NumGoroutine()
-	// but we want to avoid importing runtime in this example
-	return 10
+	return runtime.NumGoroutine()
 }
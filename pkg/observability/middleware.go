@@ -0,0 +1,51 @@
+package observability
+
+import "net/http"
+
+// Middleware wraps a handler with extra behaviour.
+type Middleware = func(http.HandlerFunc) http.HandlerFunc
+
+// Chain composes middlewares in declared order: the first one listed is the
+// outermost and sees the request first. nil entries are skipped, so optional
+// middleware can be passed unconditionally.
+//
+//	chain := Chain(tracing.InstrumentHandler, MetricsMiddlewareV3(metrics), rateLimit)
+//	mux.HandleFunc("/v3/subscriptions", chain(handler))
+func Chain(mw ...Middleware) Middleware {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		for i := len(mw) - 1; i >= 0; i-- {
+			if mw[i] != nil {
+				handler = mw[i](handler)
+			}
+		}
+		return handler
+	}
+}
+
+// MetricsMiddleware adapts InstrumentHandler to Middleware.
+func MetricsMiddleware(metrics *Metrics) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return InstrumentHandler(next, metrics)
+	}
+}
+
+// MetricsMiddlewareV1 adapts InstrumentHandlerV1 to Middleware.
+func MetricsMiddlewareV1(metrics *MetricsV1) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return InstrumentHandlerV1(next, metrics)
+	}
+}
+
+// MetricsMiddlewareV2 adapts InstrumentHandlerV2 to Middleware.
+func MetricsMiddlewareV2(metrics *MetricsV2) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return InstrumentHandlerV2(next, metrics)
+	}
+}
+
+// MetricsMiddlewareV3 adapts InstrumentHandlerV3 to Middleware.
+func MetricsMiddlewareV3(metrics *MetricsV3) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return InstrumentHandlerV3(next, metrics)
+	}
+}
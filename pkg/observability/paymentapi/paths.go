@@ -0,0 +1,12 @@
+// Package paymentapi holds the routes the payment service serves, so its
+// handlers and the subscription service's client cannot drift apart.
+package paymentapi
+
+const (
+	// ProcessPath charges a payment synchronously
+	ProcessPath = "/process"
+	// ProcessAsyncPath accepts a payment and charges it in the background
+	ProcessAsyncPath = "/process-async"
+	// RefundPath refunds part or all of a processed payment
+	RefundPath = "/refund"
+)
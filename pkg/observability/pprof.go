@@ -0,0 +1,39 @@
+package observability
+
+import (
+	"errors"
+	"net/http"
+	"net/http/pprof"
+)
+
+// RegisterPprof mounts the net/http/pprof handlers under /debug/pprof/ when
+// enabled, behind SecureMetricsHandler with auth. Profiles reveal internals,
+// cmdline may include secrets, and the CPU profile and trace run for as long
+// as the caller asks, so services keep this off unless configured otherwise
+// and it is an error to enable it without credentials.
+func RegisterPprof(mux *http.ServeMux, enabled bool, auth MetricsAuthConfig) error {
+	if !enabled {
+		return nil
+	}
+	if !auth.Enabled() {
+		return errors.New("pprof requires a metrics bearer token or allowed CIDRs")
+	}
+
+	routes := map[string]http.HandlerFunc{
+		// Index also serves the named profiles, e.g. /debug/pprof/heap
+		"/debug/pprof/":        pprof.Index,
+		"/debug/pprof/cmdline": pprof.Cmdline,
+		"/debug/pprof/profile": pprof.Profile,
+		"/debug/pprof/symbol":  pprof.Symbol,
+		"/debug/pprof/trace":   pprof.Trace,
+	}
+	for path, handler := range routes {
+		secured, err := SecureMetricsHandler(handler, auth)
+		if err != nil {
+			return err
+		}
+		mux.Handle(path, secured)
+	}
+
+	return nil
+}
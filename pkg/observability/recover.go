@@ -0,0 +1,98 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewPanicCounter creates <service>_panics_total for RecoverMiddleware.
+func NewPanicCounter(serviceName string, reg *prometheus.Registry) prometheus.Counter {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: serviceName + "_panics_total",
+		Help: "Total number of handler panics recovered",
+	})
+
+	if reg != nil {
+		reg.MustRegister(counter)
+	} else {
+		// Use default registry when nil is passed
+		prometheus.MustRegister(counter)
+	}
+
+	return counter
+}
+
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoverWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// RecoverMiddleware turns a handler panic into a 500 instead of a crashed
+// process. It logs the panic with its stack, counts it in panics (which may
+// be nil), and records it on the span in the request context, if any. Use it
+// as the outermost middleware. http.ErrAbortHandler is re-raised, since it is
+// the standard way to abort a response.
+func RecoverMiddleware(logger zerolog.Logger, panics prometheus.Counter) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			rw := &recoverWriter{ResponseWriter: w}
+
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				stack := string(debug.Stack())
+
+				if panics != nil {
+					panics.Inc()
+				}
+
+				requestLogger := LogWithTrace(r.Context(), logger)
+				requestLogger.Error().
+					Str("panic", fmt.Sprintf("%v", recovered)).
+					Str("stack", stack).
+					Str("method", r.Method).
+					Str("path", r.URL.Path).
+					Msg("Recovered from handler panic")
+
+				span := trace.SpanFromContext(r.Context())
+				span.RecordError(fmt.Errorf("panic: %v", recovered))
+				span.SetStatus(codes.Error, "Handler panicked")
+				span.SetAttributes(
+					attribute.String("error.type", "panic"),
+					semconv.ExceptionStacktrace(stack),
+				)
+
+				// Too late for a status code once the handler started writing
+				if !rw.wroteHeader {
+					WriteError(rw, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+				}
+			}()
+
+			next(rw, r)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	registry := prometheus.NewRegistry()
+	panics := NewPanicCounter("recover_test", registry)
+	tracing := NewTracingV3Noop()
+
+	handler := RecoverMiddleware(zerolog.New(&logs), panics)(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	ctx, span := tracing.tracer.Start(context.Background(), "GET /v3/subscriptions")
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/v3/subscriptions", nil).WithContext(ctx))
+	span.End()
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(rec.Body.String(), "INTERNAL_ERROR") {
+		t.Errorf("body = %s, want an INTERNAL_ERROR error", rec.Body.String())
+	}
+
+	logged := logs.String()
+	if !strings.Contains(logged, `"panic":"boom"`) || !strings.Contains(logged, "recover_test.go") {
+		t.Errorf("log = %s, want the panic value and a stack through this test", logged)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetMetric()[0].GetCounter().GetValue() != 1 {
+		t.Errorf("recover_test_panics_total was not incremented once")
+	}
+
+	spans := tracing.RecordedSpans()
+	if len(spans) != 1 || len(spans[0].Events) == 0 || spans[0].Events[0].Name != "exception" {
+		t.Errorf("span did not record the panic as an exception event")
+	}
+}
+
+func TestRecoverMiddlewareReraisesAbort(t *testing.T) {
+	var logs bytes.Buffer
+	handler := RecoverMiddleware(zerolog.New(&logs), nil)(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler re-raised", recovered)
+		}
+		if logs.Len() != 0 {
+			t.Errorf("aborted response was logged: %s", logs.String())
+		}
+	}()
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v3/subscriptions", nil))
+}
+
+// TestRecoverMiddlewareAroundTracingV3 is the /v3 chain: InstrumentHandler
+// records the panic on the server span and re-panics so the outer
+// RecoverMiddleware still counts and logs it.
+func TestRecoverMiddlewareAroundTracingV3(t *testing.T) {
+	var logs bytes.Buffer
+	registry := prometheus.NewRegistry()
+	tracing := NewTracingV3Noop()
+
+	handler := Chain(
+		RecoverMiddleware(zerolog.New(&logs), NewPanicCounter("recover_v3_test", registry)),
+		tracing.InstrumentHandler,
+	)(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/v3/subscriptions", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if !strings.Contains(logs.String(), `"panic":"boom"`) {
+		t.Errorf("log = %s, want the panic logged by RecoverMiddleware", logs.String())
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetMetric()[0].GetCounter().GetValue() != 1 {
+		t.Errorf("recover_v3_test_panics_total was not incremented once")
+	}
+
+	spans := tracing.RecordedSpans()
+	if len(spans) != 1 || spans[0].Status.Description != "Handler panicked" {
+		t.Errorf("server span did not record the panic")
+	}
+}
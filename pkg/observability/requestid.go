@@ -0,0 +1,92 @@
+package observability
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+
+	// Longer client-supplied IDs are replaced rather than trusted
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID RequestIDMiddleware assigned to the
+// request, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestIDMiddleware keeps the client's X-Request-ID when it looks sane and
+// generates a UUID otherwise. The ID is stored in the context, echoed in the
+// response header, set as the request.id span attribute and baggage member,
+// and picked up by LogWithTrace. Place it inside the tracing middleware so
+// the server span exists.
+func RequestIDMiddleware() Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", id))
+			if member, err := baggage.NewMember("request.id", id); err == nil {
+				if b, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+					ctx = baggage.ContextWithBaggage(ctx, b)
+				}
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+			next(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// validRequestID accepts non-empty printable ASCII without spaces, which
+// keeps log lines and baggage values intact.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// randRead is replaced in tests to simulate an entropy failure.
+var randRead = rand.Read
+
+// fallbackRequestSeq keeps fallback IDs from the same nanosecond distinct.
+var fallbackRequestSeq atomic.Uint64
+
+// newRequestID returns a random version 4 UUID. Should the system's random
+// source fail, it falls back to the current time and a process-wide counter,
+// which are unique but predictable.
+func newRequestID() string {
+	var b [16]byte
+	if _, err := randRead(b[:]); err != nil {
+		binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(b[8:], fallbackRequestSeq.Add(1))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,32 @@
+package observability
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+var uuidV4 = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewRequestIDFallback(t *testing.T) {
+	defer func(read func([]byte) (int, error)) { randRead = read }(randRead)
+	randRead = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := newRequestID()
+		if !uuidV4.MatchString(id) {
+			t.Fatalf("fallback ID %q is not a version 4 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("fallback ID %q repeated", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNewRequestIDRandom(t *testing.T) {
+	if a, b := newRequestID(), newRequestID(); !uuidV4.MatchString(a) || a == b {
+		t.Errorf("IDs %q and %q, want two distinct version 4 UUIDs", a, b)
+	}
+}
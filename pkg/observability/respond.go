@@ -0,0 +1,189 @@
+package observability
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeXML  = "application/xml"
+	contentTypeCSV  = "text/csv"
+)
+
+var errNotTabular = errors.New("payload is not a struct or a slice of structs")
+
+// xmlList gives slice payloads the single root element XML requires.
+type xmlList struct {
+	XMLName xml.Name    `xml:"items"`
+	Items   interface{} `xml:"item"`
+}
+
+// Respond writes payload with status in the format the Accept header asks
+// for: JSON, XML (application/xml or text/xml) or CSV (text/csv). JSON is
+// used when Accept is absent, "*/*" or names nothing supported, and also
+// when the payload has no XML or CSV form, such as a map. CSV needs a struct
+// or a slice of structs and gets a header row built from the json tags.
+func Respond(w http.ResponseWriter, r *http.Request, status int, payload interface{}) error {
+	contentType := negotiateContentType(r.Header.Get("Accept"))
+
+	var body []byte
+	var err error
+	switch contentType {
+	case contentTypeXML:
+		body, err = encodeXML(payload)
+	case contentTypeCSV:
+		body, err = encodeCSV(payload)
+	}
+	if contentType == contentTypeJSON || err != nil {
+		contentType = contentTypeJSON
+		body, err = json.Marshal(payload)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+			return err
+		}
+		body = append(body, '\n')
+	}
+
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, err = w.Write(body)
+	return err
+}
+
+// NegotiatedContentType returns the media type Respond prefers for r, so
+// callers can derive per-representation values such as ETags. Respond still
+// falls back to JSON for payloads with no XML or CSV form.
+func NegotiatedContentType(r *http.Request) string {
+	return negotiateContentType(r.Header.Get("Accept"))
+}
+
+// negotiateContentType picks the supported type with the highest q-value in
+// accept, preferring earlier entries on ties.
+func negotiateContentType(accept string) string {
+	best, bestQ := contentTypeJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		var candidate string
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			candidate = contentTypeJSON
+		case "application/xml", "text/xml":
+			candidate = contentTypeXML
+		case "text/csv":
+			candidate = contentTypeCSV
+		default:
+			continue
+		}
+
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
+
+func encodeXML(payload interface{}) ([]byte, error) {
+	if v := reflect.ValueOf(payload); v.Kind() == reflect.Slice {
+		payload = xmlList{Items: payload}
+	}
+
+	body, err := xml.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// encodeCSV writes one row per struct, with columns named after the json
+// tags of the exported fields.
+func encodeCSV(payload interface{}) ([]byte, error) {
+	v := reflect.Indirect(reflect.ValueOf(payload))
+
+	var rows []reflect.Value
+	var rowType reflect.Type
+	switch {
+	case v.Kind() == reflect.Struct:
+		rows, rowType = []reflect.Value{v}, v.Type()
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		rowType = v.Type().Elem()
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, v.Index(i))
+		}
+	default:
+		return nil, errNotTabular
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < rowType.NumField(); i++ {
+		field := rowType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			record[i] = csvValue(row.Field(field))
+		}
+		cw.Write(record)
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// csvValue formats one cell. Text starting with =, +, -, @, tab or CR is
+// prefixed with ' so spreadsheets do not run it as a formula; numbers are
+// left alone so negative values stay numeric.
+func csvValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	s := fmt.Sprint(v.Interface())
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return s
+	}
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package observability
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespondCSVEscapesFormulas(t *testing.T) {
+	type row struct {
+		Name    string  `json:"name"`
+		Balance float64 `json:"balance"`
+	}
+	rows := []row{
+		{Name: "=HYPERLINK(\"http://evil.example\")", Balance: -12.5},
+		{Name: "+1", Balance: 3},
+		{Name: "-2", Balance: 0},
+		{Name: "@SUM(A1)", Balance: 0},
+		{Name: "plain", Balance: 0},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v3/subscriptions", nil)
+	req.Header.Set("Accept", "text/csv")
+	rec := httptest.NewRecorder()
+	if err := Respond(rec, req, http.StatusOK, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"name", "balance"},
+		{"'=HYPERLINK(\"http://evil.example\")", "-12.5"},
+		{"'+1", "3"},
+		{"'-2", "0"},
+		{"'@SUM(A1)", "0"},
+		{"plain", "0"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("record %d field %d = %q, want %q", i, j, records[i][j], want[i][j])
+			}
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package observability
+
+import "net/http"
+
+// PathValue returns the wildcard segment name matched by a Go 1.22 ServeMux
+// pattern such as "/v3/subscriptions/{id}", or "" when the route has no such
+// wildcard. Unlike slicing r.URL.Path it is unaffected by trailing slashes
+// and nested paths, which simply fail to match the pattern.
+func PathValue(r *http.Request, name string) string {
+	return r.PathValue(name)
+}
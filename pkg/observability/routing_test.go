@@ -0,0 +1,47 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathValue(t *testing.T) {
+	mux := http.NewServeMux()
+	for _, version := range []string{"v1", "v2", "v3"} {
+		mux.HandleFunc("/"+version+"/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(PathValue(r, "id")))
+		})
+	}
+
+	tests := []struct {
+		target string
+		status int
+		id     string
+	}{
+		{"/v3/subscriptions/sub_1", http.StatusOK, "sub_1"},
+		{"/v3/subscriptions/sub_1?foo=bar", http.StatusOK, "sub_1"},
+		{"/v1/subscriptions/sub_1?foo=bar&id=other", http.StatusOK, "sub_1"},
+		{"/v2/subscriptions/sub_%2F1", http.StatusOK, "sub_/1"},
+		{"/v3/subscriptions/sub_1/", http.StatusNotFound, ""},
+		{"/v2/subscriptions/sub_1/payments", http.StatusNotFound, ""},
+		{"/v3/subscriptions/", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.target, rec.Code, tt.status)
+			continue
+		}
+		if tt.status == http.StatusOK && rec.Body.String() != tt.id {
+			t.Errorf("%s: id = %q, want %q", tt.target, rec.Body.String(), tt.id)
+		}
+	}
+
+	// Outside a pattern match there is no wildcard to return
+	if got := PathValue(httptest.NewRequest(http.MethodGet, "/v3/subscriptions/sub_1", nil), "id"); got != "" {
+		t.Errorf("PathValue on an unrouted request = %q, want empty", got)
+	}
+}
@@ -0,0 +1,61 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ShutdownTimeout bounds how long RunServer spends draining requests and
+// running the shutdown functions combined.
+const ShutdownTimeout = 15 * time.Second
+
+// RunServer serves until SIGINT or SIGTERM, then stops accepting connections,
+// waits for in-flight requests and calls each shutdown in order, all within
+// ShutdownTimeout. Pass tracer and log writer shutdowns last so spans and log
+// lines produced while draining are still flushed.
+//
+// Shutdowns also run when the server fails to start. The returned error
+// joins the serve, Shutdown and shutdown-function errors.
+func RunServer(server *http.Server, shutdowns ...func(context.Context) error) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(stop)
+
+	var err error
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	case <-stop:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := server.Shutdown(ctx); shutdownErr != nil {
+		err = errors.Join(err, fmt.Errorf("server shutdown: %w", shutdownErr))
+	}
+
+	for _, shutdown := range shutdowns {
+		if shutdown == nil {
+			continue
+		}
+		if shutdownErr := shutdown(ctx); shutdownErr != nil {
+			err = errors.Join(err, shutdownErr)
+		}
+	}
+
+	return err
+}
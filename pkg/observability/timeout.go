@@ -0,0 +1,112 @@
+package observability
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// timeoutWriter buffers the handler's response so that it can be discarded
+// in favour of a 504 if the deadline passes first.
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.status = code
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+// TimeoutMiddleware gives each request d to complete. The handler runs with
+// a context that is cancelled at the deadline, so outbound calls made with
+// it give up too. If the handler has not returned by then the client gets a
+// 504 and the span a request.timeout event; anything the handler writes
+// afterwards is discarded. Zero or less disables the timeout.
+func TimeoutMiddleware(d time.Duration) Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if d <= 0 {
+			return next
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						panicked <- recovered
+					}
+				}()
+				next(tw, r)
+				close(done)
+			}()
+
+			select {
+			case recovered := <-panicked:
+				// Re-raise on the serving goroutine so RecoverMiddleware sees it
+				panic(recovered)
+
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+
+				dst := w.Header()
+				for key, values := range tw.header {
+					dst[key] = values
+				}
+				if tw.wroteHeader {
+					w.WriteHeader(tw.status)
+				}
+				w.Write(tw.buf.Bytes())
+
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+
+				trace.SpanFromContext(ctx).AddEvent("request.timeout", trace.WithAttributes(
+					attribute.Int64("request.timeout_ms", d.Milliseconds()),
+				))
+				WriteError(w, r, http.StatusGatewayTimeout, "TIMEOUT", "Request timed out")
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	tracing := NewTracingV3Noop()
+	release := make(chan struct{})
+	lateWrite := make(chan error, 1)
+
+	handler := TimeoutMiddleware(20 * time.Millisecond)(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		_, err := w.Write([]byte("late response"))
+		lateWrite <- err
+	})
+
+	ctx, span := tracing.tracer.Start(context.Background(), "GET /v3/subscriptions")
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/v3/subscriptions", nil).WithContext(ctx))
+	span.End()
+
+	// The handler only writes once the 504 has been sent
+	close(release)
+	if err := <-lateWrite; err != http.ErrHandlerTimeout {
+		t.Errorf("late Write error = %v, want http.ErrHandlerTimeout", err)
+	}
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "late response") || !strings.Contains(body, "TIMEOUT") {
+		t.Errorf("body = %s, want only the TIMEOUT error", body)
+	}
+
+	spans := tracing.RecordedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	var found bool
+	for _, event := range spans[0].Events {
+		if event.Name == "request.timeout" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("span events = %v, want request.timeout", spans[0].Events)
+	}
+}
+
+func TestTimeoutMiddlewareFastHandler(t *testing.T) {
+	handler := TimeoutMiddleware(time.Second)(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/v3/subscriptions", nil))
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "created" {
+		t.Errorf("response = %d %q, want 201 \"created\"", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/plain" {
+		t.Errorf("Content-Type = %q, want the handler's header", got)
+	}
+}
@@ -1,8 +1,20 @@
 package observability
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	jaegerprop "go.opentelemetry.io/contrib/propagators/jaeger"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
@@ -10,13 +22,55 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+// tracerShutdownTimeout bounds the flush and shutdown performed by the
+// function returned from InitTracer when the caller's context has no deadline.
+const tracerShutdownTimeout = 5 * time.Second
+
+const (
+	ExporterJaeger   = "jaeger"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+)
+
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+	PropagatorJaeger       = "jaeger"
+)
+
 type TracerConfig struct {
 	ServiceName    string
 	JaegerEndpoint string
 	SampleRatio    float64
+	// SampleRatioFunc, when set, replaces SampleRatio and is read on every
+	// root sampling decision, so the ratio can change at runtime.
+	SampleRatioFunc func() float64
+	// Exporter selects the span exporter: ExporterJaeger (default),
+	// ExporterOTLPGRPC or ExporterOTLPHTTP.
+	Exporter string
+	// OTLPEndpoint is the collector address for the OTLP exporters, either
+	// host:port or a URL. Falls back to OTEL_EXPORTER_OTLP_ENDPOINT.
+	OTLPEndpoint string
+	// SamplerType selects how root spans are sampled: SamplerRatio (default,
+	// uses SampleRatio), SamplerAlways, SamplerNever or SamplerRateLimit
+	// (uses MaxTracesPerSecond). Whatever the type, spans with a parent
+	// follow the parent's decision, so SamplerNever still records traces
+	// that an upstream service chose to sample.
+	SamplerType        string
+	MaxTracesPerSecond float64
+	// Propagators lists the header formats to read and write, from
+	// PropagatorTraceContext, PropagatorBaggage, PropagatorB3,
+	// PropagatorB3Multi and PropagatorJaeger. Defaults to tracecontext and
+	// baggage.
+	Propagators []string
 }
 
-func InitTracer(cfg TracerConfig) (*tracesdk.TracerProvider, error) {
+// InitTracer installs a global tracer provider and returns it along with a
+// shutdown function that flushes any buffered spans before shutting the
+// provider down. Call the shutdown function before the process exits.
+func InitTracer(cfg TracerConfig) (*tracesdk.TracerProvider, func(context.Context) error, error) {
 	if cfg.JaegerEndpoint == "" {
 		cfg.JaegerEndpoint = "http://jaeger:14268/api/traces"
 	}
@@ -24,14 +78,22 @@ func InitTracer(cfg TracerConfig) (*tracesdk.TracerProvider, error) {
 		cfg.SampleRatio = 0.2
 	}
 
-	exporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(cfg.JaegerEndpoint)))
+	rootSampler, err := newRootSampler(cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	sampler := tracesdk.ParentBased(
-		tracesdk.TraceIDRatioBased(cfg.SampleRatio),
-	)
+	propagator, err := newPropagator(cfg.Propagators)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	exporter, err := newSpanExporter(cfg.Exporter, cfg.JaegerEndpoint, cfg.OTLPEndpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sampler := tracesdk.ParentBased(rootSampler)
 
 	tp := tracesdk.NewTracerProvider(
 		tracesdk.WithSampler(sampler),
@@ -42,10 +104,114 @@ func InitTracer(cfg TracerConfig) (*tracesdk.TracerProvider, error) {
 		)),
 	)
 	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-	return tp, nil
+	otel.SetTextMapPropagator(propagator)
+	return tp, shutdownFunc(tp), nil
+}
+
+// shutdownFunc returns a function that force-flushes tp and then shuts it
+// down, applying tracerShutdownTimeout if ctx carries no deadline.
+func shutdownFunc(tp *tracesdk.TracerProvider) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tracerShutdownTimeout)
+			defer cancel()
+		}
+
+		flushErr := tp.ForceFlush(ctx)
+		return errors.Join(flushErr, tp.Shutdown(ctx))
+	}
+}
+
+// newPropagator builds a composite propagator from the named formats,
+// defaulting to W3C trace context and baggage.
+func newPropagator(names []string) (propagation.TextMapPropagator, error) {
+	if len(names) == 0 {
+		names = []string{PropagatorTraceContext, PropagatorBaggage}
+	}
+
+	propagators := make([]propagation.TextMapPropagator, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3.New())
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case PropagatorJaeger:
+			propagators = append(propagators, jaegerprop.Jaeger{})
+		default:
+			return nil, fmt.Errorf("unknown propagator %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+// newSpanExporter builds the exporter named by kind, defaulting to Jaeger.
+func newSpanExporter(kind, jaegerEndpoint, otlpEndpoint string) (tracesdk.SpanExporter, error) {
+	switch kind {
+	case "", ExporterJaeger:
+		return jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(jaegerEndpoint)))
+	case ExporterOTLPGRPC:
+		var opts []otlptracegrpc.Option
+		if host, insecure, ok := resolveOTLPEndpoint(otlpEndpoint); ok {
+			opts = append(opts, otlptracegrpc.WithEndpoint(host))
+			if insecure {
+				opts = append(opts, otlptracegrpc.WithInsecure())
+			}
+		}
+		return otlptracegrpc.New(context.Background(), opts...)
+	case ExporterOTLPHTTP:
+		var opts []otlptracehttp.Option
+		if host, insecure, ok := resolveOTLPEndpoint(otlpEndpoint); ok {
+			opts = append(opts, otlptracehttp.WithEndpoint(host))
+			if insecure {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			}
+		}
+		return otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", kind)
+	}
+}
+
+// resolveOTLPEndpoint resolves the configured endpoint, or OTEL_EXPORTER_OTLP_ENDPOINT,
+// to the host:port form the exporters expect. URLs with an http scheme and
+// bare host:port values are treated as plaintext, as in the demo compose setup.
+func resolveOTLPEndpoint(endpoint string) (host string, insecure bool, ok bool) {
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if endpoint == "" {
+		return "", false, false
+	}
+
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		return u.Host, u.Scheme != "https", true
+	}
+	return endpoint, true, true
 }
 
 func GetTracer(name string) trace.Tracer {
 	return otel.Tracer(name)
 }
+
+// BaggageToMap returns the baggage members in ctx as key/value pairs, e.g.
+// the user.id, tenant.id and session.id set by TracingV3.AddBusinessContext.
+func BaggageToMap(ctx context.Context) map[string]string {
+	members := baggage.FromContext(ctx).Members()
+	values := make(map[string]string, len(members))
+	for _, member := range members {
+		values[member.Key()] = member.Value()
+	}
+	return values
+}
+
+// BaggageValue returns the value of the baggage member key in ctx, or "" if
+// it is not set.
+func BaggageValue(ctx context.Context, key string) string {
+	return baggage.FromContext(ctx).Member(key).Value()
+}
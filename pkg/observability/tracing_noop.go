@@ -0,0 +1,84 @@
+package observability
+
+import (
+	"go.opentelemetry.io/otel/propagation"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const noopServiceName = "test"
+
+// newRecordingProvider returns a provider that samples everything and keeps
+// finished spans in memory instead of exporting them.
+func newRecordingProvider() (*tracesdk.TracerProvider, *tracetest.InMemoryExporter) {
+	recorder := tracetest.NewInMemoryExporter()
+	tp := tracesdk.NewTracerProvider(
+		tracesdk.WithSampler(tracesdk.AlwaysSample()),
+		tracesdk.WithSyncer(recorder),
+	)
+	return tp, recorder
+}
+
+// NewTracingV1Noop returns a TracingV1 that records spans in memory for tests
+// instead of exporting them to Jaeger.
+func NewTracingV1Noop() *TracingV1 {
+	tp, recorder := newRecordingProvider()
+	return &TracingV1{
+		tracer:   tp.Tracer(noopServiceName),
+		tp:       tp,
+		recorder: recorder,
+	}
+}
+
+// NewTracingV2Noop returns a TracingV2 that records spans in memory for tests
+// instead of exporting them to Jaeger.
+func NewTracingV2Noop() *TracingV2 {
+	tp, recorder := newRecordingProvider()
+	return &TracingV2{
+		tracer:     tp.Tracer(noopServiceName),
+		tp:         tp,
+		propagator: propagation.TraceContext{},
+		recorder:   recorder,
+	}
+}
+
+// NewTracingV3Noop returns a TracingV3 that records spans in memory for tests
+// instead of exporting them. Baggage is enabled as in the services.
+func NewTracingV3Noop() *TracingV3 {
+	tp, recorder := newRecordingProvider()
+	return &TracingV3{
+		tracer:     tp.Tracer(noopServiceName),
+		tp:         tp,
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		config: TracingV3Config{
+			ServiceName:   noopServiceName,
+			EnableBaggage: true,
+		},
+		recorder: recorder,
+	}
+}
+
+// RecordedSpans returns the spans ended so far. It is nil unless t was built
+// with NewTracingV1Noop.
+func (t *TracingV1) RecordedSpans() []tracetest.SpanStub {
+	return recordedSpans(t.recorder)
+}
+
+// RecordedSpans returns the spans ended so far. It is nil unless t was built
+// with NewTracingV2Noop.
+func (t *TracingV2) RecordedSpans() []tracetest.SpanStub {
+	return recordedSpans(t.recorder)
+}
+
+// RecordedSpans returns the spans ended so far. It is nil unless t was built
+// with NewTracingV3Noop.
+func (t *TracingV3) RecordedSpans() []tracetest.SpanStub {
+	return recordedSpans(t.recorder)
+}
+
+func recordedSpans(recorder *tracetest.InMemoryExporter) []tracetest.SpanStub {
+	if recorder == nil {
+		return nil
+	}
+	return recorder.GetSpans()
+}
@@ -0,0 +1,70 @@
+package observability
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+const incomingTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracingV1NoopRecordsSpans(t *testing.T) {
+	tracing := NewTracingV1Noop()
+	handler := tracing.InstrumentHandler(func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/subscriptions", nil)
+	req.Header.Set("traceparent", incomingTraceparent)
+	handler(httptest.NewRecorder(), req)
+
+	spans := tracing.RecordedSpans()
+	if len(spans) != 1 || spans[0].Name != "request" {
+		t.Fatalf("recorded %v, want one span named request", spans)
+	}
+	// V1 ignores the caller's trace
+	if spans[0].SpanContext.TraceID().String() == "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Error("V1 span continued the incoming trace")
+	}
+}
+
+func TestTracingV3NoopRecordsSpans(t *testing.T) {
+	tracing := NewTracingV3Noop()
+	handler := tracing.InstrumentHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v3/subscriptions", nil)
+	req.Header.Set("traceparent", incomingTraceparent)
+	handler(httptest.NewRecorder(), req)
+
+	spans := tracing.RecordedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "POST /v3/subscriptions" {
+		t.Errorf("span name = %q, want %q", span.Name, "POST /v3/subscriptions")
+	}
+	if span.Parent.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("span trace = %s, want the incoming trace", span.Parent.TraceID())
+	}
+	if span.Status.Code != codes.Ok {
+		t.Errorf("span status = %v, want Ok", span.Status.Code)
+	}
+	var status int64
+	for _, kv := range span.Attributes {
+		if kv.Key == "http.status_code" {
+			status = kv.Value.AsInt64()
+		}
+	}
+	if status != http.StatusCreated {
+		t.Errorf("http.status_code = %d, want %d", status, http.StatusCreated)
+	}
+}
+
+func TestRecordedSpansWithoutNoop(t *testing.T) {
+	if spans := (&TracingV2{}).RecordedSpans(); spans != nil {
+		t.Errorf("RecordedSpans() = %v, want nil for an exporting tracer", spans)
+	}
+}
@@ -0,0 +1,171 @@
+package observability
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SamplerRatio     = "ratio"
+	SamplerAlways    = "always"
+	SamplerNever     = "never"
+	SamplerRateLimit = "ratelimit"
+)
+
+// newRootSampler builds the sampler that decides for root spans. InitTracer
+// wraps it in ParentBased, so it is only consulted when a span has no parent;
+// spans with a parent follow the parent's sampling decision, including
+// parents propagated from upstream services.
+func newRootSampler(cfg TracerConfig) (tracesdk.Sampler, error) {
+	switch cfg.SamplerType {
+	case "", SamplerRatio:
+		if cfg.SampleRatioFunc != nil {
+			return NewRatioSampler(cfg.SampleRatioFunc), nil
+		}
+		return tracesdk.TraceIDRatioBased(cfg.SampleRatio), nil
+	case SamplerAlways:
+		return tracesdk.AlwaysSample(), nil
+	case SamplerNever:
+		return tracesdk.NeverSample(), nil
+	case SamplerRateLimit:
+		if cfg.MaxTracesPerSecond <= 0 {
+			return nil, fmt.Errorf("ratelimit sampler requires MaxTracesPerSecond > 0")
+		}
+		return NewRateLimitSampler(cfg.MaxTracesPerSecond), nil
+	default:
+		return nil, fmt.Errorf("unknown sampler type %q", cfg.SamplerType)
+	}
+}
+
+// RatioSampler is TraceIDRatioBased with a ratio read from a function on
+// every decision, so it can be changed while the tracer provider runs, for
+// example on a config reload.
+type RatioSampler struct {
+	ratio   func() float64
+	current atomic.Pointer[ratioSamplerState]
+}
+
+type ratioSamplerState struct {
+	ratio   float64
+	sampler tracesdk.Sampler
+}
+
+func NewRatioSampler(ratio func() float64) *RatioSampler {
+	return &RatioSampler{ratio: ratio}
+}
+
+func (s *RatioSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	return s.sampler().ShouldSample(p)
+}
+
+func (s *RatioSampler) Description() string {
+	return fmt.Sprintf("RatioSampler{%g}", s.ratio())
+}
+
+// sampler returns a TraceIDRatioBased sampler for the current ratio,
+// rebuilding it only when the ratio has changed.
+func (s *RatioSampler) sampler() tracesdk.Sampler {
+	ratio := s.ratio()
+	if state := s.current.Load(); state != nil && state.ratio == ratio {
+		return state.sampler
+	}
+
+	state := &ratioSamplerState{ratio: ratio, sampler: tracesdk.TraceIDRatioBased(ratio)}
+	s.current.Store(state)
+	return state.sampler
+}
+
+// RateLimitSampler samples at most a fixed number of traces per second using
+// a token bucket. The bucket holds up to one second's worth of tokens, so
+// short bursts are allowed after an idle period. It always holds at least one
+// token, so rates below one trace per second still sample.
+type RateLimitSampler struct {
+	mu         sync.Mutex
+	rate       float64
+	burst      float64
+	tokens     float64
+	lastRefill time.Time
+}
+
+func NewRateLimitSampler(maxPerSecond float64) *RateLimitSampler {
+	burst := math.Max(maxPerSecond, 1)
+	return &RateLimitSampler{
+		rate:       maxPerSecond,
+		burst:      burst,
+		tokens:     burst,
+		lastRefill: time.Now(),
+	}
+}
+
+func (s *RateLimitSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	decision := tracesdk.Drop
+	if s.take() {
+		decision = tracesdk.RecordAndSample
+	}
+
+	return tracesdk.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *RateLimitSampler) Description() string {
+	return fmt.Sprintf("RateLimitSampler{%g}", s.rate)
+}
+
+func (s *RateLimitSampler) take() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.tokens += now.Sub(s.lastRefill).Seconds() * s.rate
+	if s.tokens > s.burst {
+		s.tokens = s.burst
+	}
+	s.lastRefill = now
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+// ForceSampleAttribute marks a span that must be sampled regardless of the
+// configured ratio. It only takes effect when passed at span start, since
+// that is when the sampler runs.
+var ForceSampleAttribute = attribute.Bool("sampling.force", true)
+
+// ForceSampler samples spans started with ForceSampleAttribute and defers to
+// base for everything else. Wrap it around ParentBased rather than inside it,
+// otherwise children of unsampled parents never reach it.
+type ForceSampler struct {
+	base tracesdk.Sampler
+}
+
+func NewForceSampler(base tracesdk.Sampler) *ForceSampler {
+	return &ForceSampler{base: base}
+}
+
+func (s *ForceSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	for _, attr := range p.Attributes {
+		if attr == ForceSampleAttribute {
+			return tracesdk.SamplingResult{
+				Decision:   tracesdk.RecordAndSample,
+				Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+			}
+		}
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s *ForceSampler) Description() string {
+	return fmt.Sprintf("ForceSampler{%s}", s.base.Description())
+}
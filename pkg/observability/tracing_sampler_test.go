@@ -0,0 +1,25 @@
+package observability
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitSamplerBelowOnePerSecond(t *testing.T) {
+	s := NewRateLimitSampler(0.5)
+
+	if !s.take() {
+		t.Fatal("first trace was not sampled")
+	}
+	if s.take() {
+		t.Fatal("second trace sampled before a token was refilled")
+	}
+
+	// Two seconds refill one token at 0.5 per second
+	s.mu.Lock()
+	s.lastRefill = s.lastRefill.Add(-2 * time.Second)
+	s.mu.Unlock()
+	if !s.take() {
+		t.Error("trace not sampled after the bucket refilled")
+	}
+}
@@ -0,0 +1,80 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanMetricsProcessor derives RED metrics from finished server spans so the
+// request counts and latencies on /metrics match what the traces show. Only
+// recorded spans reach a processor, so with ratio sampling the counts cover
+// the sampled share of traffic.
+type SpanMetricsProcessor struct {
+	Requests *prometheus.CounterVec
+	Duration *prometheus.HistogramVec
+}
+
+func NewSpanMetricsProcessor(serviceName string) *SpanMetricsProcessor {
+	prefix := strings.ReplaceAll(serviceName, "-", "_")
+	labels := []string{"method", "endpoint", "status_class"}
+
+	return &SpanMetricsProcessor{
+		Requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: prefix + "_v3_span_requests_total",
+				Help: "Total number of server spans, derived from traces",
+			},
+			labels,
+		),
+		Duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    prefix + "_v3_span_duration_seconds",
+				Help:    "Server span duration in seconds, derived from traces",
+				Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			},
+			labels,
+		),
+	}
+}
+
+// Register adds the collectors to registry, or the default registry if nil.
+func (p *SpanMetricsProcessor) Register(registry *prometheus.Registry) {
+	if registry != nil {
+		registry.MustRegister(p.Requests, p.Duration)
+	} else {
+		prometheus.MustRegister(p.Requests, p.Duration)
+	}
+}
+
+func (p *SpanMetricsProcessor) OnStart(context.Context, tracesdk.ReadWriteSpan) {}
+
+func (p *SpanMetricsProcessor) OnEnd(s tracesdk.ReadOnlySpan) {
+	if s.SpanKind() != trace.SpanKindServer {
+		return
+	}
+
+	method, endpoint, statusClass := "unknown", s.Name(), "unknown"
+	for _, attr := range s.Attributes() {
+		switch attr.Key {
+		case semconv.HTTPMethodKey:
+			method = attr.Value.AsString()
+		case semconv.HTTPRouteKey:
+			endpoint = attr.Value.AsString()
+		case semconv.HTTPStatusCodeKey:
+			statusClass = fmt.Sprintf("%dxx", attr.Value.AsInt64()/100)
+		}
+	}
+
+	p.Requests.WithLabelValues(method, endpoint, statusClass).Inc()
+	p.Duration.WithLabelValues(method, endpoint, statusClass).Observe(s.EndTime().Sub(s.StartTime()).Seconds())
+}
+
+func (p *SpanMetricsProcessor) Shutdown(context.Context) error { return nil }
+
+func (p *SpanMetricsProcessor) ForceFlush(context.Context) error { return nil }
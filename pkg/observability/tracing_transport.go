@@ -0,0 +1,107 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracedTransportName = "observability/http"
+
+// tracedTransport starts a client span around every request it sends and
+// injects the span's context into the outgoing headers.
+type tracedTransport struct {
+	base       http.RoundTripper
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// TransportOption configures NewTracedTransport.
+type TransportOption func(*tracedTransport)
+
+// WithTracerProvider starts client spans from tp instead of the global
+// tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) TransportOption {
+	return func(t *tracedTransport) {
+		t.tracer = tp.Tracer(tracedTransportName)
+	}
+}
+
+// WithPropagator injects the span context with p instead of the global
+// propagator.
+func WithPropagator(p propagation.TextMapPropagator) TransportOption {
+	return func(t *tracedTransport) {
+		t.propagator = p
+	}
+}
+
+// WithTracingV3 uses the tracer provider and propagator of tracing, so client
+// spans are exported and sampled with the rest of its traces.
+func WithTracingV3(tracing *TracingV3) TransportOption {
+	return func(t *tracedTransport) {
+		t.tracer = tracing.namedTracer(tracedTransportName)
+		t.propagator = tracing.propagator
+	}
+}
+
+// NewTracedTransport wraps base so that outgoing requests are traced. Without
+// options it uses the global tracer provider and propagator, as they are
+// when each request is sent. A nil base uses http.DefaultTransport.
+func NewTracedTransport(base http.RoundTripper, opts ...TransportOption) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &tracedTransport{base: base}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tracer, propagator := t.tracer, t.propagator
+	if tracer == nil {
+		tracer = otel.Tracer(tracedTransportName)
+	}
+	if propagator == nil {
+		propagator = otel.GetTextMapPropagator()
+	}
+
+	ctx, span := tracer.Start(req.Context(), fmt.Sprintf("HTTP %s", req.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+	)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.HTTPMethod(req.Method),
+		semconv.HTTPTarget(req.URL.Path),
+		semconv.HTTPScheme(req.URL.Scheme),
+		attribute.String("http.host", req.URL.Host),
+	)
+
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, "Server error")
+	} else if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, "Client error")
+	}
+
+	return resp, nil
+}
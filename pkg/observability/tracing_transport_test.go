@@ -0,0 +1,47 @@
+package observability
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracedTransportWithTracingV3(t *testing.T) {
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	tracing := NewTracingV3Noop()
+	client := &http.Client{Transport: NewTracedTransport(nil, WithTracingV3(tracing))}
+
+	ctx, parent := tracing.StartSpan(context.Background(), "request")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/v1/payments", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	var found bool
+	for _, span := range tracing.RecordedSpans() {
+		if span.Name != "HTTP GET" {
+			continue
+		}
+		found = true
+		if span.Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Error("client span is not a child of the request span")
+		}
+		want := span.SpanContext.TraceID().String() + "-" + span.SpanContext.SpanID().String()
+		if !strings.Contains(traceparent, want) {
+			t.Errorf("traceparent = %q, want it to carry the client span %s", traceparent, want)
+		}
+	}
+	if !found {
+		t.Fatal("no client span recorded by the TracingV3 provider")
+	}
+}
@@ -8,8 +8,10 @@ import (
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -21,16 +23,33 @@ import (
 // - Manual timing instead of spans
 // - No error handling
 type TracingV1 struct {
-	tracer trace.Tracer
+	tracer           trace.Tracer
+	tp               *tracesdk.TracerProvider
+	propagateContext bool
+	recorder         *tracetest.InMemoryExporter
+}
+
+// TracingV1Config lets V1 users fix its worst habits one at a time.
+type TracingV1Config struct {
+	ServiceName string
+	// PropagateContext extracts the incoming trace context from request
+	// headers and hands the span context to the wrapped handler.
+	PropagateContext bool
 }
 
 func NewTracingV1(serviceName string) *TracingV1 {
+	return NewTracingV1WithConfig(TracingV1Config{ServiceName: serviceName})
+}
+
+func NewTracingV1WithConfig(config TracingV1Config) *TracingV1 {
+	serviceName := config.ServiceName
+
 	// V1: Minimal setup with poor configuration
 	exporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint("http://jaeger:14268/api/traces")))
 	if err != nil {
 		log.Printf("V1: Failed to create exporter: %v", err)
 		// V1: Poor error handling - just continue without tracing
-		return &TracingV1{tracer: otel.Tracer("noop")}
+		return &TracingV1{tracer: otel.Tracer("noop"), propagateContext: config.PropagateContext}
 	}
 
 	// V1: Poor sampling - either all or nothing
@@ -41,16 +60,35 @@ func NewTracingV1(serviceName string) *TracingV1 {
 			semconv.ServiceName(serviceName),
 		)),
 	)
-	otel.SetTracerProvider(tp)
 
 	return &TracingV1{
-		tracer: otel.Tracer(serviceName),
+		tracer:           tp.Tracer(serviceName),
+		tp:               tp,
+		propagateContext: config.PropagateContext,
 	}
 }
 
+// Shutdown flushes and stops this version's tracer provider.
+func (t *TracingV1) Shutdown(ctx context.Context) error {
+	if t.tp == nil {
+		return nil
+	}
+	return t.tp.Shutdown(ctx)
+}
+
 // V1: Poor middleware - no context propagation, minimal span information
 func (t *TracingV1) InstrumentHandler(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if t.propagateContext {
+			// V1 (opt-in fix): Continue the caller's trace and pass it on
+			ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := t.tracer.Start(ctx, "request")
+			defer span.End()
+
+			handler(w, r.WithContext(ctx))
+			return
+		}
+
 		// V1: Create span with poor naming (generic, not descriptive)
 		_, span := t.tracer.Start(context.Background(), "request")
 		defer span.End()
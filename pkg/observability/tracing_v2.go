@@ -2,6 +2,7 @@ package observability
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -12,6 +13,7 @@ import (
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -24,7 +26,9 @@ import (
 // - Some custom attributes but not standardized
 type TracingV2 struct {
 	tracer     trace.Tracer
+	tp         *tracesdk.TracerProvider
 	propagator propagation.TextMapPropagator
+	recorder   *tracetest.InMemoryExporter
 }
 
 func NewTracingV2(serviceName string) *TracingV2 {
@@ -52,20 +56,27 @@ func NewTracingV2(serviceName string) *TracingV2 {
 			semconv.ServiceVersion("v2"), // V2: Add version but hardcoded
 		)),
 	)
-	otel.SetTracerProvider(tp)
 
 	// V2: Set up propagation (but limited)
 	propagator := propagation.NewCompositeTextMapPropagator(
 		propagation.TraceContext{},
 	)
-	otel.SetTextMapPropagator(propagator)
 
 	return &TracingV2{
-		tracer:     otel.Tracer(serviceName),
+		tracer:     tp.Tracer(serviceName),
+		tp:         tp,
 		propagator: propagator,
 	}
 }
 
+// Shutdown flushes and stops this version's tracer provider.
+func (t *TracingV2) Shutdown(ctx context.Context) error {
+	if t.tp == nil {
+		return nil
+	}
+	return t.tp.Shutdown(ctx)
+}
+
 // V2: Better middleware - basic context propagation, some span attributes
 func (t *TracingV2) InstrumentHandler(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -143,7 +154,7 @@ func (t *TracingV2) AddAttributes(span trace.Span, attributes map[string]interfa
 			span.SetAttributes(attribute.Bool(key, v))
 		default:
 			// V2: Convert to string for unknown types
-			span.SetAttributes(attribute.String(key, ""+interface{}(v).(string)))
+			span.SetAttributes(attribute.String(key, fmt.Sprintf("%v", v)))
 		}
 	}
 }
@@ -0,0 +1,52 @@
+package observability
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestTracingV2AddAttributes(t *testing.T) {
+	tracing := NewTracingV2Noop()
+	_, span := tracing.StartSpan(context.Background(), "attributes")
+	tracing.AddAttributes(span, map[string]interface{}{
+		"amount":  9.99,
+		"timeout": 1500 * time.Millisecond,
+		"plan":    struct{ Name string }{"premium"},
+		"user_id": "user_1",
+		"retries": 3,
+	})
+	span.End()
+
+	spans := tracing.RecordedSpans()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	got := make(map[attribute.Key]attribute.Value)
+	for _, kv := range spans[0].Attributes {
+		got[kv.Key] = kv.Value
+	}
+
+	want := map[attribute.Key]string{
+		"amount":  "9.99",
+		"timeout": "1.5s",
+		"plan":    "{premium}",
+		"user_id": "user_1",
+		"retries": "3",
+	}
+	for key, value := range want {
+		v, ok := got[key]
+		if !ok {
+			t.Errorf("attribute %s missing", key)
+			continue
+		}
+		if v.Emit() != value {
+			t.Errorf("attribute %s = %q, want %q", key, v.Emit(), value)
+		}
+	}
+	if got["retries"].Type() != attribute.INT64 {
+		t.Errorf("retries type = %s, want INT64", got["retries"].Type())
+	}
+}
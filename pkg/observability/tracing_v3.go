@@ -2,21 +2,27 @@ package observability
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -33,10 +39,17 @@ import (
 // - Resource attributes for deployment context
 type TracingV3 struct {
 	tracer     trace.Tracer
+	tp         *tracesdk.TracerProvider
 	propagator propagation.TextMapPropagator
 	config     TracingV3Config
+	recorder   *tracetest.InMemoryExporter
+	// SpanMetrics holds the span-derived RED metrics, nil unless
+	// EnableMetrics is set.
+	SpanMetrics *SpanMetricsProcessor
 }
 
+const defaultSlowRequestThreshold = time.Second
+
 type TracingV3Config struct {
 	ServiceName    string
 	ServiceVersion string
@@ -46,6 +59,30 @@ type TracingV3Config struct {
 	JaegerEndpoint string
 	EnableMetrics  bool
 	EnableBaggage  bool
+	// SampleRatioFunc, when set, replaces SampleRatio and is read on every
+	// sampling decision, so the ratio can change at runtime.
+	SampleRatioFunc func() float64
+	// MetricsRegistry receives the span-derived metrics when EnableMetrics
+	// is set. Nil uses the default registry.
+	MetricsRegistry *prometheus.Registry
+	// Exporter and OTLPEndpoint select the span exporter as in TracerConfig.
+	Exporter     string
+	OTLPEndpoint string
+	// RoutePatternFunc maps a request to its route template, e.g.
+	// /v3/subscriptions/{id}, for span names and http.route. The raw path
+	// is used when nil.
+	RoutePatternFunc func(*http.Request) string
+	// Propagators selects header formats as in TracerConfig.
+	Propagators []string
+	// SlowRequestThreshold is the duration above which InstrumentHandler adds
+	// a slow_request event (default 1s). SlowRequestThresholds overrides it
+	// per route pattern, as returned by RoutePatternFunc.
+	SlowRequestThreshold  time.Duration
+	SlowRequestThresholds map[string]time.Duration
+	// RecoverPanics makes InstrumentHandler answer 500 after recording a
+	// handler panic instead of re-panicking. Leave it off behind
+	// RecoverMiddleware, which would otherwise never see the panic.
+	RecoverPanics bool
 }
 
 func NewTracingV3(config TracingV3Config) *TracingV3 {
@@ -71,9 +108,12 @@ func NewTracingV3(config TracingV3Config) *TracingV3 {
 	if config.JaegerEndpoint == "" {
 		config.JaegerEndpoint = "http://jaeger:14268/api/traces"
 	}
+	if config.SlowRequestThreshold == 0 {
+		config.SlowRequestThreshold = defaultSlowRequestThreshold
+	}
 
 	// V3: Enhanced exporter configuration
-	exporter, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(config.JaegerEndpoint)))
+	exporter, err := newSpanExporter(config.Exporter, config.JaegerEndpoint, config.OTLPEndpoint)
 	if err != nil {
 		log.Printf("V3: Failed to create tracer exporter: %v", err)
 		return &TracingV3{
@@ -84,19 +124,24 @@ func NewTracingV3(config TracingV3Config) *TracingV3 {
 	}
 
 	// V3: Sophisticated sampling strategy
+	sampleRatio := config.SampleRatioFunc
+	if sampleRatio == nil {
+		sampleRatio = func() float64 { return config.SampleRatio }
+	}
 	var sampler tracesdk.Sampler
 	if config.Environment == "production" {
 		// V3: Lower sampling in production with parent-based decisions
-		sampler = tracesdk.ParentBased(
-			tracesdk.TraceIDRatioBased(config.SampleRatio),
-		)
+		sampler = tracesdk.ParentBased(NewRatioSampler(sampleRatio))
 	} else {
 		// V3: Higher sampling in non-production
-		sampler = tracesdk.ParentBased(
-			tracesdk.TraceIDRatioBased(config.SampleRatio * 2),
-		)
+		sampler = tracesdk.ParentBased(NewRatioSampler(func() float64 {
+			return sampleRatio() * 2
+		}))
 	}
 
+	// V3: Let individual operations opt out of the ratio (see TraceOperationSampled)
+	sampler = NewForceSampler(sampler)
+
 	// V3: Rich resource attributes for deployment context
 	hostname, _ := os.Hostname()
 	resource := resource.NewWithAttributes(
@@ -110,7 +155,7 @@ func NewTracingV3(config TracingV3Config) *TracingV3 {
 		attribute.String("telemetry.sdk.version", runtime.Version()),
 	)
 
-	tp := tracesdk.NewTracerProvider(
+	tpOptions := []tracesdk.TracerProviderOption{
 		tracesdk.WithSampler(sampler),
 		tracesdk.WithBatcher(exporter,
 			// V3: Optimized batching configuration
@@ -119,22 +164,44 @@ func NewTracingV3(config TracingV3Config) *TracingV3 {
 			tracesdk.WithMaxQueueSize(2048),
 		),
 		tracesdk.WithResource(resource),
-	)
-	otel.SetTracerProvider(tp)
+	}
+
+	// V3: RED metrics straight from the spans, so traces and dashboards agree
+	var spanMetrics *SpanMetricsProcessor
+	if config.EnableMetrics {
+		spanMetrics = NewSpanMetricsProcessor(config.ServiceName)
+		spanMetrics.Register(config.MetricsRegistry)
+		tpOptions = append(tpOptions, tracesdk.WithSpanProcessor(spanMetrics))
+	}
+
+	tp := tracesdk.NewTracerProvider(tpOptions...)
 
 	// V3: Full propagation setup with baggage for business context
-	propagators := []propagation.TextMapPropagator{
-		propagation.TraceContext{},
-		propagation.Baggage{},
+	propagator, err := newPropagator(config.Propagators)
+	if err != nil {
+		log.Printf("V3: Invalid propagators, using tracecontext and baggage: %v", err)
+		propagator, _ = newPropagator(nil)
 	}
-	propagator := propagation.NewCompositeTextMapPropagator(propagators...)
-	otel.SetTextMapPropagator(propagator)
 
+	// V3: Own provider rather than the global one, so V1/V2/V3 can run side by side
 	return &TracingV3{
-		tracer:     otel.Tracer(config.ServiceName),
-		propagator: propagator,
-		config:     config,
+		tracer:      tp.Tracer(config.ServiceName),
+		tp:          tp,
+		propagator:  propagator,
+		config:      config,
+		SpanMetrics: spanMetrics,
+	}
+}
+
+// V3: Flush pending spans and stop the exporter
+func (t *TracingV3) Shutdown(ctx context.Context) error {
+	if t.tp == nil {
+		return nil
+	}
+	if err := t.tp.ForceFlush(ctx); err != nil {
+		return err
 	}
+	return t.tp.Shutdown(ctx)
 }
 
 // V3: Comprehensive HTTP middleware with full observability
@@ -146,7 +213,8 @@ func (t *TracingV3) InstrumentHandler(handler http.HandlerFunc) http.HandlerFunc
 		ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
 
 		// V3: Semantic span naming following OpenTelemetry conventions
-		spanName := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+		route := t.routePattern(r)
+		spanName := fmt.Sprintf("%s %s", r.Method, route)
 		ctx, span := t.tracer.Start(ctx, spanName,
 			trace.WithSpanKind(trace.SpanKindServer),
 		)
@@ -156,7 +224,7 @@ func (t *TracingV3) InstrumentHandler(handler http.HandlerFunc) http.HandlerFunc
 		span.SetAttributes(
 			semconv.HTTPMethod(r.Method),
 			semconv.HTTPTarget(r.URL.Path),
-			semconv.HTTPRoute(r.URL.Path), // In real app, this would be the route pattern
+			semconv.HTTPRoute(route),
 			semconv.HTTPScheme(r.URL.Scheme),
 			attribute.String("http.host", r.Host),
 			semconv.HTTPUserAgent(r.UserAgent()),
@@ -188,6 +256,17 @@ func (t *TracingV3) InstrumentHandler(handler http.HandlerFunc) http.HandlerFunc
 			bytesWritten:   0,
 		}
 
+		// V3: Make handler crashes visible in the trace
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				t.recordPanic(span, recovered)
+				if !t.config.RecoverPanics || recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				WriteError(wrapper, r.WithContext(ctx), http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+			}
+		}()
+
 		// V3: Execute handler with enriched context
 		handler(wrapper, r.WithContext(ctx))
 
@@ -219,21 +298,102 @@ func (t *TracingV3) InstrumentHandler(handler http.HandlerFunc) http.HandlerFunc
 			attribute.Int64("duration_ms", duration.Milliseconds()),
 		))
 
-		// V3: Performance annotations
-		if duration > 1*time.Second {
+		// V3: Performance annotations against the route's own SLO
+		if threshold := t.slowThreshold(route); duration > threshold {
 			span.AddEvent("slow_request", trace.WithAttributes(
 				attribute.Int64("duration_ms", duration.Milliseconds()),
+				attribute.Int64("threshold_ms", threshold.Milliseconds()),
 				attribute.String("performance.issue", "slow_response"),
 			))
 		}
 	}
 }
 
+// V3: Per-route slow request thresholds
+func (t *TracingV3) slowThreshold(route string) time.Duration {
+	if threshold, ok := t.config.SlowRequestThresholds[route]; ok {
+		return threshold
+	}
+	if t.config.SlowRequestThreshold > 0 {
+		return t.config.SlowRequestThreshold
+	}
+	return defaultSlowRequestThreshold
+}
+
+// V3: Panic recording with the stack trace attached
+func (t *TracingV3) recordPanic(span trace.Span, recovered interface{}) {
+	stack := string(debug.Stack())
+
+	t.RecordError(span, fmt.Errorf("panic: %v", recovered), nil)
+	span.SetStatus(codes.Error, "Handler panicked")
+	span.SetAttributes(
+		semconv.HTTPStatusCode(http.StatusInternalServerError),
+		attribute.String("error.type", "panic"),
+		semconv.ExceptionStacktrace(stack),
+	)
+	span.AddEvent("panic", trace.WithAttributes(
+		attribute.String("panic.value", fmt.Sprintf("%v", recovered)),
+	))
+}
+
+// V3: Route templates keep span names low-cardinality
+func (t *TracingV3) routePattern(r *http.Request) string {
+	if t.config.RoutePatternFunc != nil {
+		if route := t.config.RoutePatternFunc(r); route != "" {
+			return route
+		}
+	}
+	return r.URL.Path
+}
+
 // V3: Advanced operation tracing with business context
 func (t *TracingV3) TraceOperation(ctx context.Context, operationName string, operationType string, attributes map[string]interface{}, operation func(context.Context) error) error {
-	ctx, span := t.tracer.Start(ctx, operationName,
-		trace.WithSpanKind(trace.SpanKindInternal),
-	)
+	return t.traceOperation(ctx, operationName, operationType, attributes, operation)
+}
+
+// V3: Per-operation sampling override. With sampleHint set the span is always
+// recorded, whatever the configured ratio, so rare but important operations
+// such as payments are never lost to a low global sampling rate. If the
+// surrounding trace was not sampled the operation starts a new trace linked
+// to it, since its parent spans were never recorded. Without the hint the
+// configured sampler decides as usual.
+func (t *TracingV3) TraceOperationSampled(ctx context.Context, operationName string, operationType string, sampleHint bool, attributes map[string]interface{}, operation func(context.Context) error) error {
+	if !sampleHint {
+		return t.traceOperation(ctx, operationName, operationType, attributes, operation)
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithAttributes(ForceSampleAttribute),
+	}
+	if parent := trace.SpanContextFromContext(ctx); parent.IsValid() && !parent.IsSampled() {
+		opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: parent}))
+	}
+	return t.traceOperation(ctx, operationName, operationType, attributes, operation, opts...)
+}
+
+// V3: Per-operation deadline. When the operation returns because the deadline
+// passed, the span gets an operation.timeout event and operation.timed_out
+// attribute before the error is recorded, so a hung downstream is obvious.
+func (t *TracingV3) TraceOperationWithTimeout(ctx context.Context, operationName string, operationType string, timeout time.Duration, attributes map[string]interface{}, operation func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return t.traceOperation(ctx, operationName, operationType, attributes, func(ctx context.Context) error {
+		err := operation(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			span := trace.SpanFromContext(ctx)
+			span.AddEvent("operation.timeout", trace.WithAttributes(
+				attribute.Int64("timeout_ms", timeout.Milliseconds()),
+			))
+			span.SetAttributes(attribute.Bool("operation.timed_out", true))
+		}
+		return err
+	})
+}
+
+func (t *TracingV3) traceOperation(ctx context.Context, operationName string, operationType string, attributes map[string]interface{}, operation func(context.Context) error, opts ...trace.SpanStartOption) error {
+	opts = append([]trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindInternal)}, opts...)
+	ctx, span := t.tracer.Start(ctx, operationName, opts...)
 	defer span.End()
 
 	// V3: Standard operation attributes
@@ -268,6 +428,39 @@ func (t *TracingV3) TraceOperation(ctx context.Context, operationName string, op
 	return err
 }
 
+// V3: Fan-out tracing - the span links back to the work that triggered it
+// instead of being its child, so independent async jobs stay separate traces
+func (t *TracingV3) TraceOperationWithLinks(ctx context.Context, operationName string, links []trace.Link, operation func(context.Context) error) error {
+	ctx, span := t.tracer.Start(ctx, operationName,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithLinks(links...),
+	)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("operation.name", operationName),
+		attribute.Int("operation.links", len(links)),
+	)
+
+	err := operation(ctx)
+
+	if err != nil {
+		t.RecordError(span, err, map[string]interface{}{
+			"operation.name": operationName,
+		})
+	} else {
+		span.SetStatus(codes.Ok, "Operation completed successfully")
+	}
+
+	return err
+}
+
+// LinkFromContext returns a link to the span active in ctx, for use with
+// TraceOperationWithLinks.
+func LinkFromContext(ctx context.Context) trace.Link {
+	return trace.LinkFromContext(ctx)
+}
+
 // V3: Database operation tracing with full semantic conventions
 func (t *TracingV3) TraceDBOperation(ctx context.Context, operation, table, database string, query func(context.Context) error) error {
 	spanName := fmt.Sprintf("db %s %s", operation, table)
@@ -302,8 +495,81 @@ func (t *TracingV3) TraceDBOperation(ctx context.Context, operation, table, data
 	return err
 }
 
-// V3: HTTP client tracing with full semantic conventions
+// DBSpanConfig describes a database call for TraceDBOperationV2. System is a
+// db.system value such as "postgresql", "mysql" or "sqlite" and defaults to
+// "other_sql". StatementFingerprint may be a raw query; literals are replaced
+// with ? before it is recorded.
+type DBSpanConfig struct {
+	System               string
+	Name                 string
+	Table                string
+	Operation            string
+	StatementFingerprint string
+}
+
+// V3: Database tracing for any engine, recording rows affected and a
+// sanitized statement instead of the raw query
+func (t *TracingV3) TraceDBOperationV2(ctx context.Context, cfg DBSpanConfig, query func(context.Context) (int, error)) error {
+	if cfg.System == "" {
+		cfg.System = "other_sql"
+	}
+
+	spanName := fmt.Sprintf("db %s %s", cfg.Operation, cfg.Table)
+	ctx, span := t.tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+	)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.system", cfg.System),
+		semconv.DBName(cfg.Name),
+		semconv.DBOperation(cfg.Operation),
+		attribute.String("db.table", cfg.Table),
+	)
+	if cfg.StatementFingerprint != "" {
+		span.SetAttributes(semconv.DBStatement(fingerprintStatement(cfg.StatementFingerprint)))
+	}
+
+	span.AddEvent("db.query.started")
+
+	rows, err := query(ctx)
+
+	if err != nil {
+		t.RecordError(span, err, map[string]interface{}{
+			"db.operation": cfg.Operation,
+			"db.table":     cfg.Table,
+		})
+	} else {
+		span.SetAttributes(attribute.Int("db.rows_affected", rows))
+		span.SetStatus(codes.Ok, "Database operation successful")
+	}
+
+	span.AddEvent("db.query.completed")
+	return err
+}
+
+var (
+	sqlStringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	sqlWhitespace     = regexp.MustCompile(`\s+`)
+)
+
+// fingerprintStatement replaces string and numeric literals with ? and
+// collapses whitespace, so statements group by shape and carry no user data.
+func fingerprintStatement(statement string) string {
+	statement = sqlStringLiteral.ReplaceAllString(statement, "?")
+	statement = sqlNumericLiteral.ReplaceAllString(statement, "?")
+	return strings.TrimSpace(sqlWhitespace.ReplaceAllString(statement, " "))
+}
+
+// V3: HTTP client tracing for requests without a body
 func (t *TracingV3) TraceHTTPClient(ctx context.Context, method, url string, requestFunc func(context.Context, *http.Request) (*http.Response, error)) (*http.Response, error) {
+	return t.TraceHTTPClientRequest(ctx, method, url, nil, nil, requestFunc)
+}
+
+// V3: HTTP client tracing with full semantic conventions. Headers are copied
+// onto the request before the trace context is injected.
+func (t *TracingV3) TraceHTTPClientRequest(ctx context.Context, method, url string, body io.Reader, header http.Header, requestFunc func(context.Context, *http.Request) (*http.Response, error)) (*http.Response, error) {
 	spanName := fmt.Sprintf("HTTP %s", method)
 	ctx, span := t.tracer.Start(ctx, spanName,
 		trace.WithSpanKind(trace.SpanKindClient),
@@ -311,7 +577,7 @@ func (t *TracingV3) TraceHTTPClient(ctx context.Context, method, url string, req
 	defer span.End()
 
 	// V3: Create HTTP request with context
-	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		t.RecordError(span, err, map[string]interface{}{
 			"http.method": method,
@@ -320,12 +586,19 @@ func (t *TracingV3) TraceHTTPClient(ctx context.Context, method, url string, req
 		return nil, err
 	}
 
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
 	// V3: Full HTTP client semantic attributes
 	span.SetAttributes(
 		semconv.HTTPMethod(method),
 		semconv.HTTPTarget(req.URL.Path),
 		attribute.String("http.host", req.URL.Host),
 		semconv.HTTPScheme(req.URL.Scheme),
+		attribute.Int64("http.request.content_length", req.ContentLength),
 	)
 
 	// V3: Inject trace context into outgoing request
@@ -372,6 +645,15 @@ func (t *TracingV3) StartSpan(ctx context.Context, name string, opts ...trace.Sp
 	return t.tracer.Start(ctx, name, opts...)
 }
 
+// namedTracer returns a tracer called name from t's provider, or t's own
+// tracer when exporting is disabled.
+func (t *TracingV3) namedTracer(name string) trace.Tracer {
+	if t.tp == nil {
+		return t.tracer
+	}
+	return t.tp.Tracer(name)
+}
+
 // V3: Comprehensive error recording with context
 func (t *TracingV3) RecordError(span trace.Span, err error, context map[string]interface{}) {
 	span.SetStatus(codes.Error, err.Error())
@@ -1,39 +1,173 @@
 package config
 
 import (
-	"os"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"observability/billing"
+	sharedconfig "observability/config"
 )
 
 type Config struct {
-	Port              string
-	PaymentServiceURL string
-	JaegerEndpoint    string
-	LogstashHost      string
+	Port               string   `yaml:"port"`
+	PaymentServiceURL  string   `yaml:"payment_service_url"`
+	JaegerEndpoint     string   `yaml:"jaeger_endpoint"`
+	TraceExporter      string   `yaml:"trace_exporter"`
+	OTLPEndpoint       string   `yaml:"otlp_endpoint"`
+	SampleRatio        float64  `yaml:"sample_ratio"` // V3 tracer; reloadable
+	OTLPLogsEnabled    bool     `yaml:"otlp_logs_enabled"`
+	OTLPMetricsEnabled bool     `yaml:"otlp_metrics_enabled"`
+	LogstashHost       string   `yaml:"logstash_host"`
+	LogFallbackPath    string   `yaml:"log_fallback_path"`
+	LogRedactKeys      []string `yaml:"log_redact_keys"`
+	RepositoryBackend  string   `yaml:"repository_backend"`
+	BoltPath           string   `yaml:"bolt_path"`
+	MaxPerUser         int      `yaml:"max_subscriptions_per_user"`
+	SnapshotPath       string   `yaml:"snapshot_path"`
+
+	// Plans on sale; only settable from CONFIG_FILE, empty uses
+	// billing.DefaultPlans
+	Plans []billing.Plan `yaml:"plans"`
+
+	// Zero values use the circuit breaker defaults
+	PaymentBreakerThreshold int           `yaml:"payment_breaker_threshold"`
+	PaymentBreakerCoolDown  time.Duration `yaml:"payment_breaker_cooldown"`
+
+	// Probe the payment service at startup and log whether it is reachable
+	PaymentStartupProbe bool `yaml:"payment_startup_probe"`
+	// Accept creates as pending and queue their payments while the payment
+	// service is unavailable, retrying every PaymentRetryInterval
+	PaymentDegradedMode  bool          `yaml:"payment_degraded_mode"`
+	PaymentRetryInterval time.Duration `yaml:"payment_retry_interval"`
+
+	// Deadline for handling a request, after which the client gets a 504;
+	// zero disables it
+	RequestTimeout time.Duration `yaml:"request_timeout"`
+
+	// Per-client limit on /v3 requests; zero disables it
+	RateLimitRPS   float64 `yaml:"rate_limit_rps"`
+	RateLimitBurst int     `yaml:"rate_limit_burst"`
+
+	// HS256 secret for bearer tokens on /v3; empty leaves /v3 unauthenticated.
+	// Setting it disables /v1 and /v2, which have no owner checks.
+	AuthJWTSecret string `yaml:"auth_jwt_secret"`
+
+	// Browser origins allowed by CORS; empty disables CORS handling
+	CORSAllowedOrigins []string `yaml:"cors_allowed_origins"`
+
+	// Guard /metrics and the /debug endpoints; empty values leave them open
+	MetricsBearerToken  string   `yaml:"metrics_bearer_token"`
+	MetricsAllowedCIDRs []string `yaml:"metrics_allowed_cidrs"`
+
+	// Serve /debug/pprof behind the metrics credentials, which must be set
+	PprofEnabled bool `yaml:"pprof_enabled"`
+	// Serve POST /debug/loadgen, which sends synthetic /v3 traffic to this
+	// service, behind the metrics credentials, which must be set
+	LoadgenEnabled bool `yaml:"loadgen_enabled"`
+
+	// mu guards SampleRatio, which Watch may replace; read it through
+	// CurrentSampleRatio once it runs
+	mu sync.RWMutex
 }
 
-func NewConfig() *Config {
-	cfg := &Config{
-		Port:              ":8080",
-		PaymentServiceURL: "http://payment-service:8081",
-		JaegerEndpoint:    "",
-		LogstashHost:      "localhost:5044",
-	}
+// Load reads the config from the environment, then overlays CONFIG_FILE, a
+// YAML or JSON file keyed by the yaml tags above, when it is set.
+func Load() (*Config, error) {
+	cfg := NewConfig()
 
-	if port := os.Getenv("PORT"); port != "" {
-		cfg.Port = ":" + port
+	if path := sharedconfig.GetEnv("CONFIG_FILE", ""); path != "" {
+		if err := sharedconfig.LoadFromFile(path, cfg); err != nil {
+			return nil, err
+		}
 	}
 
-	if paymentURL := os.Getenv("PAYMENT_SERVICE_URL"); paymentURL != "" {
-		cfg.PaymentServiceURL = paymentURL
+	// The file may give a bare port number, as the environment does
+	if !strings.HasPrefix(cfg.Port, ":") {
+		cfg.Port = ":" + cfg.Port
 	}
 
-	if jaegerEndpoint := os.Getenv("JAEGER_ENDPOINT"); jaegerEndpoint != "" {
-		cfg.JaegerEndpoint = jaegerEndpoint
+	return cfg, nil
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Port:               ":" + sharedconfig.GetEnv("PORT", "8080"),
+		PaymentServiceURL:  sharedconfig.GetEnv("PAYMENT_SERVICE_URL", "http://payment-service:8081"),
+		JaegerEndpoint:     sharedconfig.GetEnv("JAEGER_ENDPOINT", ""),
+		TraceExporter:      sharedconfig.GetEnv("TRACE_EXPORTER", ""),
+		OTLPEndpoint:       sharedconfig.GetEnv("OTLP_ENDPOINT", ""),
+		SampleRatio:        sharedconfig.GetFloatEnv("TRACE_SAMPLE_RATIO", 0.1),
+		OTLPLogsEnabled:    sharedconfig.GetBoolEnv("OTLP_LOGS_ENABLED", false),
+		OTLPMetricsEnabled: sharedconfig.GetBoolEnv("OTLP_METRICS_ENABLED", false),
+		LogstashHost:       sharedconfig.GetEnv("LOGSTASH_HOST", "localhost:5044"),
+		LogFallbackPath:    sharedconfig.GetEnv("LOG_FALLBACK_PATH", ""),
+		LogRedactKeys:      sharedconfig.GetListEnv("LOG_REDACT_KEYS"),
+		RepositoryBackend:  sharedconfig.GetEnv("REPOSITORY_BACKEND", "memory"),
+		BoltPath:           sharedconfig.GetEnv("BOLT_PATH", "subscriptions.db"),
+		MaxPerUser:         sharedconfig.GetIntEnv("MAX_SUBSCRIPTIONS_PER_USER", 0),
+		SnapshotPath:       sharedconfig.GetEnv("SNAPSHOT_PATH", ""),
+
+		PaymentBreakerThreshold: sharedconfig.GetIntEnv("PAYMENT_BREAKER_THRESHOLD", 0),
+		PaymentBreakerCoolDown:  sharedconfig.GetDurationEnv("PAYMENT_BREAKER_COOLDOWN", 0),
+
+		PaymentStartupProbe:  sharedconfig.GetBoolEnv("PAYMENT_STARTUP_PROBE", false),
+		PaymentDegradedMode:  sharedconfig.GetBoolEnv("PAYMENT_DEGRADED_MODE", false),
+		PaymentRetryInterval: sharedconfig.GetDurationEnv("PAYMENT_RETRY_INTERVAL", 15*time.Second),
+
+		RequestTimeout: sharedconfig.GetDurationEnv("REQUEST_TIMEOUT", 5*time.Second),
+
+		RateLimitRPS:   sharedconfig.GetFloatEnv("RATE_LIMIT_RPS", 0),
+		RateLimitBurst: sharedconfig.GetIntEnv("RATE_LIMIT_BURST", 0),
+
+		AuthJWTSecret: sharedconfig.GetEnv("AUTH_JWT_SECRET", ""),
+
+		CORSAllowedOrigins: sharedconfig.GetListEnv("CORS_ALLOWED_ORIGINS"),
+
+		MetricsBearerToken:  sharedconfig.GetEnv("METRICS_BEARER_TOKEN", ""),
+		MetricsAllowedCIDRs: sharedconfig.GetListEnv("METRICS_ALLOWED_CIDRS"),
+
+		PprofEnabled:   sharedconfig.GetBoolEnv("PPROF_ENABLED", false),
+		LoadgenEnabled: sharedconfig.GetBoolEnv("LOADGEN_ENABLED", false),
 	}
+}
+
+// PlanRegistry builds the registry of the configured plans.
+func (c *Config) PlanRegistry() (*billing.PlanRegistry, error) {
+	return billing.NewPlanRegistry(c.Plans)
+}
+
+func (c *Config) CurrentSampleRatio() float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.SampleRatio
+}
+
+// Watch reloads SampleRatio from the environment and CONFIG_FILE whenever
+// the process receives SIGHUP, until ctx is done. Other settings still need
+// a restart. onReload, if set, is called after each attempt with its error;
+// a failed reload keeps the current value.
+func (c *Config) Watch(ctx context.Context, onReload func(error)) {
+	sharedconfig.OnReloadSignal(ctx, func() {
+		err := c.reload()
+		if onReload != nil {
+			onReload(err)
+		}
+	})
+}
 
-	if logstashHost := os.Getenv("LOGSTASH_HOST"); logstashHost != "" {
-		cfg.LogstashHost = logstashHost
+func (c *Config) reload() error {
+	fresh, err := Load()
+	if err != nil {
+		return err
+	}
+	if err := fresh.Validate(); err != nil {
+		return err
 	}
 
-	return cfg
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SampleRatio = fresh.SampleRatio
+	return nil
 }
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	observe "observability"
+)
+
+// Validate reports every invalid setting at once, so a misconfigured
+// deployment fails at startup instead of misbehaving later.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if err := validatePort(c.Port); err != nil {
+		errs = append(errs, fmt.Errorf("PORT: %w", err))
+	}
+
+	if err := validateURL(c.PaymentServiceURL); err != nil {
+		errs = append(errs, fmt.Errorf("PAYMENT_SERVICE_URL: %w", err))
+	}
+
+	switch c.TraceExporter {
+	case "", observe.ExporterJaeger:
+		// Empty uses the tracing package default
+		if c.JaegerEndpoint != "" {
+			if err := validateURL(c.JaegerEndpoint); err != nil {
+				errs = append(errs, fmt.Errorf("JAEGER_ENDPOINT: %w", err))
+			}
+		}
+	case observe.ExporterOTLPGRPC, observe.ExporterOTLPHTTP:
+		// OTLP_ENDPOINT may be empty; the exporters then read
+		// OTEL_EXPORTER_OTLP_ENDPOINT
+	default:
+		errs = append(errs, fmt.Errorf("TRACE_EXPORTER: unknown exporter %q", c.TraceExporter))
+	}
+
+	switch c.RepositoryBackend {
+	case "memory":
+	case "bolt":
+		if c.BoltPath == "" {
+			errs = append(errs, errors.New("BOLT_PATH: required by the bolt repository"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("REPOSITORY_BACKEND: unknown backend %q", c.RepositoryBackend))
+	}
+
+	if _, err := c.PlanRegistry(); err != nil {
+		errs = append(errs, fmt.Errorf("plans: %w", err))
+	}
+
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("TRACE_SAMPLE_RATIO: %v is outside 0-1", c.SampleRatio))
+	}
+	if c.MaxPerUser < 0 {
+		errs = append(errs, errors.New("MAX_SUBSCRIPTIONS_PER_USER: must not be negative"))
+	}
+	if c.PaymentBreakerThreshold < 0 || c.PaymentBreakerCoolDown < 0 {
+		errs = append(errs, errors.New("PAYMENT_BREAKER_THRESHOLD, PAYMENT_BREAKER_COOLDOWN: must not be negative"))
+	}
+	if c.PaymentRetryInterval < 0 {
+		errs = append(errs, errors.New("PAYMENT_RETRY_INTERVAL: must not be negative"))
+	}
+	if c.RequestTimeout < 0 {
+		errs = append(errs, errors.New("REQUEST_TIMEOUT: must not be negative"))
+	}
+	if c.RateLimitRPS < 0 || c.RateLimitBurst < 0 {
+		errs = append(errs, errors.New("RATE_LIMIT_RPS, RATE_LIMIT_BURST: must not be negative"))
+	}
+
+	metricsAuth := observe.MetricsAuthConfig{BearerToken: c.MetricsBearerToken, AllowedCIDRs: c.MetricsAllowedCIDRs}
+	if c.PprofEnabled && !metricsAuth.Enabled() {
+		errs = append(errs, errors.New("PPROF_ENABLED: requires METRICS_BEARER_TOKEN or METRICS_ALLOWED_CIDRS"))
+	}
+	if c.LoadgenEnabled && !metricsAuth.Enabled() {
+		errs = append(errs, errors.New("LOADGEN_ENABLED: requires METRICS_BEARER_TOKEN or METRICS_ALLOWED_CIDRS"))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validatePort(port string) error {
+	n, err := strconv.Atoi(strings.TrimPrefix(port, ":"))
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q is not a port number", port)
+	}
+	return nil
+}
+
+// validateURL accepts absolute http and https URLs.
+func validateURL(raw string) error {
+	if raw == "" {
+		return errors.New("must not be empty")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", raw)
+	}
+	return nil
+}
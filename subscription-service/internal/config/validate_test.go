@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"empty payment service URL", func(c *Config) { c.PaymentServiceURL = "" }, "PAYMENT_SERVICE_URL: must not be empty"},
+		{"relative payment service URL", func(c *Config) { c.PaymentServiceURL = "payment-service:8081" }, "PAYMENT_SERVICE_URL:"},
+		{"bad jaeger endpoint", func(c *Config) { c.JaegerEndpoint = "jaeger:14268" }, "JAEGER_ENDPOINT:"},
+		{"non-numeric port", func(c *Config) { c.Port = ":http" }, "PORT:"},
+		{"port out of range", func(c *Config) { c.Port = ":70000" }, "PORT:"},
+		{"sample ratio", func(c *Config) { c.SampleRatio = 1.5 }, "TRACE_SAMPLE_RATIO:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Port = "abc"
+	cfg.PaymentServiceURL = ""
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want errors")
+	}
+	for _, want := range []string{"PORT:", "PAYMENT_SERVICE_URL:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to include %s", err, want)
+		}
+	}
+}
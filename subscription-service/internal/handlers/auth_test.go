@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"subscription-service/internal/services"
+
+	observe "observability"
+	"observability/billing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+var testAuthSecret = []byte("handlers-test-secret")
+
+// testAuth is the Auth middleware main installs when AUTH_JWT_SECRET is set.
+func testAuth() observe.Middleware {
+	return observe.AuthMiddleware(observe.AuthConfig{Verifier: observe.NewHMACVerifier(testAuthSecret)})
+}
+
+// signedToken returns an HS256 JWT for userID and roles signed with
+// testAuthSecret.
+func signedToken(userID string, roles ...string) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	claims := map[string]interface{}{"user_id": userID, "roles": roles}
+	unsigned := encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, testAuthSecret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authedRequest builds a request carrying a bearer token for userID and
+// roles.
+func authedRequest(method, target, body, userID string, roles ...string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+signedToken(userID, roles...))
+	return req
+}
+
+func TestListOnlyReturnsCallersSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	repo := services.NewInMemoryRepository()
+	for _, userID := range []string{"alice", "bob", "alice"} {
+		if _, err := repo.Create(ctx, userID, "basic"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := NewV3Handler(&Dependencies{Logger: zerolog.Nop(), Repository: repo})
+
+	rec := httptest.NewRecorder()
+	testAuth()(h.HandleSubscriptions)(rec, authedRequest(http.MethodGet, "/v3/subscriptions", "", "alice"))
+
+	var subs []struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &subs); err != nil {
+		t.Fatalf("status %d, body %s: %v", rec.Code, rec.Body, err)
+	}
+	if len(subs) != 2 || rec.Header().Get("X-Total-Count") != "2" {
+		t.Fatalf("got %d subscriptions (total %s), want alice's 2", len(subs), rec.Header().Get("X-Total-Count"))
+	}
+	for _, sub := range subs {
+		if sub.UserID != "alice" {
+			t.Errorf("listed %s's subscription to alice", sub.UserID)
+		}
+	}
+}
+
+func TestLegacyVersionsDisabledWithAuth(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	deps := &Dependencies{
+		Logger:     zerolog.Nop(),
+		Repository: services.NewInMemoryRepository(),
+		MetricsV1:  observe.NewMetricsV1("auth_test", registry),
+		MetricsV2:  observe.NewMetricsV2("auth_test", registry),
+		TracingV1:  observe.NewTracingV1Noop(),
+		TracingV2:  observe.NewTracingV2Noop(),
+		Auth:       testAuth(),
+	}
+	mux := http.NewServeMux()
+	RegisterV1Routes(mux, deps)
+	RegisterV2Routes(mux, deps)
+
+	for _, target := range []string{"/v1/subscriptions", "/v2/subscriptions/sub_1"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestBatchRequiresAdmin(t *testing.T) {
+	plans, err := billing.NewPlanRegistry(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := services.NewInMemoryRepository()
+	h := NewV3Handler(&Dependencies{
+		Logger:     zerolog.Nop(),
+		Repository: repo,
+		Plans:      plans,
+		MetricsV3:  observe.NewMetricsV3("batch_test", prometheus.NewRegistry()),
+		TracingV3:  observe.NewTracingV3Noop(),
+	})
+	body := `[{"user_id":"bob","plan":"premium"}]`
+
+	// Without auth there is no caller to trust
+	rec := httptest.NewRecorder()
+	h.HandleBatch(rec, httptest.NewRequest(http.MethodPost, "/v3/subscriptions:batch", strings.NewReader(body)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unauthenticated: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	rec = httptest.NewRecorder()
+	testAuth()(h.HandleBatch)(rec, authedRequest(http.MethodPost, "/v3/subscriptions:batch", body, "alice"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("non-admin: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if got := repo.Count(context.Background()); got != 0 {
+		t.Fatalf("refused batches stored %d subscriptions", got)
+	}
+
+	rec = httptest.NewRecorder()
+	testAuth()(h.HandleBatch)(rec, authedRequest(http.MethodPost, "/v3/subscriptions:batch", body, "ops", observe.RoleAdmin))
+	if rec.Code != http.StatusCreated {
+		t.Errorf("admin: status = %d, want %d; body %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+}
@@ -1,18 +1,27 @@
 package handlers
 
 import (
+	"errors"
+	"net/http"
+	"strings"
+
 	"subscription-service/internal/config"
 	"subscription-service/internal/services"
 
 	observe "observability"
+	"observability/billing"
 
 	"github.com/rs/zerolog"
 )
 
+// maxBodyBytes bounds JSON request bodies, leaving room for a full batch of
+// maxBatchSize items
+const maxBodyBytes = 256 << 10
+
 type Dependencies struct {
 	Config         *config.Config
 	Logger         zerolog.Logger
-	Repository     *services.SubscriptionRepository
+	Repository     services.Repository
 	PaymentService *services.PaymentService
 	MetricsV1      *observe.MetricsV1
 	MetricsV2      *observe.MetricsV2
@@ -20,12 +29,34 @@ type Dependencies struct {
 	TracingV1      *observe.TracingV1
 	TracingV2      *observe.TracingV2
 	TracingV3      *observe.TracingV3
+	// Metrics holds the unversioned business metrics, such as
+	// UnsubscribesByPlan; nil skips them
+	Metrics *observe.Metrics
+	// Plans decides which plans are valid and what they cost
+	Plans *billing.PlanRegistry
+	// Health runs the /readyz dependency checks
+	Health *services.HealthChecker
+	// PaymentQueue enables degraded mode: creates are accepted as pending
+	// while the payment service is unavailable. nil rejects them instead.
+	PaymentQueue *services.PaymentQueue
+
+	// Recover is the outermost middleware on every route
+	Recover observe.Middleware
+	// RateLimit wraps rate-limited handlers; nil leaves them unlimited
+	RateLimit observe.Middleware
+	// Auth wraps handlers that need a verified caller; nil leaves them open.
+	// V1 and V2 have no owner checks, so they answer 403 once it is set.
+	Auth observe.Middleware
+	// Timeout is the innermost middleware on every route; nil disables it
+	Timeout observe.Middleware
+	// AccessLog logs one line per V3 request; nil disables it
+	AccessLog observe.Middleware
 }
 
 func NewDependencies(
 	cfg *config.Config,
 	logger zerolog.Logger,
-	repo *services.SubscriptionRepository,
+	repo services.Repository,
 	paymentService *services.PaymentService,
 	metricsV1 *observe.MetricsV1,
 	metricsV2 *observe.MetricsV2,
@@ -47,3 +78,34 @@ func NewDependencies(
 		TracingV3:      tracingV3,
 	}
 }
+
+// writeCreateError answers a failed Repository.Create: 409 when the user hit
+// the per-user limit, 500 otherwise.
+func writeCreateError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		observe.WriteError(w, r, http.StatusConflict, "QUOTA_EXCEEDED", "Subscription limit reached")
+		return
+	}
+	observe.WriteError(w, r, http.StatusInternalServerError, "CREATE_FAILED", "Failed to create subscription")
+}
+
+// RoutePattern maps a request path to its route template so that
+// /v3/subscriptions/sub_123 is reported as /v3/subscriptions/{id}.
+func RoutePattern(r *http.Request) string {
+	for _, version := range []string{"v1", "v2", "v3"} {
+		prefix := "/" + version + "/subscriptions/"
+		if strings.HasPrefix(r.URL.Path, prefix) && len(r.URL.Path) > len(prefix) {
+			return prefix + "{id}"
+		}
+	}
+	return r.URL.Path
+}
+
+// versionDisabled answers every request to an API version that cannot
+// enforce subscription ownership with 403, pointing callers at /v3.
+func versionDisabled(version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		observe.WriteError(w, r, http.StatusForbidden, "VERSION_DISABLED",
+			version+" is disabled while authentication is enabled; use /v3")
+	}
+}
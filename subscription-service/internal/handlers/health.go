@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"subscription-service/internal/services"
+
+	observe "observability"
+)
+
+type HealthHandler struct {
+	deps *Dependencies
+}
+
+func NewHealthHandler(deps *Dependencies) *HealthHandler {
+	return &HealthHandler{deps: deps}
+}
+
+// Liveness reports only that the process is serving requests; it never
+// probes dependencies, so a payment outage cannot get the pod restarted.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
+	observe.Respond(w, r, http.StatusOK, map[string]string{
+		"status":  "ok",
+		"service": "subscription-service",
+	})
+}
+
+// Readiness answers 503 while the repository or the payment service is
+// unavailable, with the per-dependency results in the body. In degraded
+// mode an unavailable payment service reports "degraded" with a 200, since
+// creates are still accepted.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result := h.deps.Health.Readiness(ctx)
+
+	status := http.StatusOK
+	if result.Status == services.HealthStatusUnhealthy {
+		h.deps.Logger.Warn().
+			Interface("checks", result.Checks).
+			Msg("Readiness check failed")
+		status = http.StatusServiceUnavailable
+	}
+
+	observe.Respond(w, r, status, map[string]interface{}{
+		"status":    result.Status,
+		"service":   "subscription-service",
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"checks":    result.Checks,
+	})
+}
+
+func RegisterHealthRoutes(mux *http.ServeMux, deps *Dependencies) {
+	handler := NewHealthHandler(deps)
+
+	mux.HandleFunc("/healthz", handler.Liveness)
+	mux.HandleFunc("/readyz", handler.Readiness)
+}
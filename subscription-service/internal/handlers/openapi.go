@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"subscription-service/internal/models"
+	"subscription-service/internal/services"
+
+	observe "observability"
+	"observability/openapi"
+)
+
+// OpenAPIDocument describes the subscription API. Plan names come from
+// plans, so the enum matches what the handlers accept.
+func OpenAPIDocument(plans []string) *openapi.Document {
+	doc := openapi.NewDocument(openapi.Info{
+		Title:   "Subscription service",
+		Version: "3",
+		Description: "Subscriptions CRUD in three versions of increasing observability maturity. " +
+			"Errors use the Error body.",
+	})
+
+	input := openapi.SchemaOf(services.CreateInput{})
+	input.Properties["plan"] = openapi.String("", plans...)
+	inputRef := doc.Define("SubscriptionInput", input)
+
+	subscription := openapi.SchemaOf(models.Subscription{})
+	subscription.Properties["plan"] = openapi.String("", plans...)
+	subscription.Properties["status"] = openapi.String("Pending subscriptions await payment", models.StatusPending, models.StatusActive)
+	subscriptionRef := doc.Define("Subscription", subscription)
+
+	doc.Define("Error", openapi.SchemaOf(observe.ErrorResponse{}))
+	batchError := openapi.SchemaOf(observe.ErrorResponse{})
+	batchError.Properties["error"].Properties["details"] = openapi.ArrayOf(openapi.SchemaOf(batchItemError{}))
+	batchErrorRef := doc.Define("BatchError", batchError)
+	readinessRef := doc.Define("Readiness", &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"status":    openapi.String("", services.HealthStatusHealthy, services.HealthStatusDegraded, services.HealthStatusUnhealthy),
+			"service":   openapi.String(""),
+			"timestamp": {Type: "string", Format: "date-time"},
+			"checks":    openapi.ArrayOf(openapi.SchemaOf(services.DependencyCheck{})),
+		},
+		Required: []string{"status", "service", "timestamp", "checks"},
+	})
+
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"bearerAuth": {
+			Type:         "http",
+			Scheme:       "bearer",
+			BearerFormat: "JWT",
+			Description:  "Required on /v3 only when AUTH_JWT_SECRET is set, which also disables /v1 and /v2 with 403",
+		},
+	}
+
+	for _, version := range []string{"v1", "v2"} {
+		addLegacyPaths(doc, version, inputRef, subscriptionRef)
+	}
+	addV3Paths(doc, inputRef, subscriptionRef, batchErrorRef)
+
+	doc.Path("/healthz").Get = &openapi.Operation{
+		Summary:   "Liveness probe",
+		Tags:      []string{"health"},
+		Responses: map[string]openapi.Response{"200": openapi.Content("Serving", openapi.SchemaOf(map[string]string{}))},
+	}
+	doc.Path("/readyz").Get = &openapi.Operation{
+		Summary: "Readiness probe with per-dependency checks",
+		Tags:    []string{"health"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.Content("Ready, possibly degraded", readinessRef),
+			"503": openapi.Content("A dependency is unavailable", readinessRef),
+		},
+	}
+	doc.Path("/metrics").Get = &openapi.Operation{
+		Summary:   "Prometheus metrics",
+		Tags:      []string{"observability"},
+		Responses: map[string]openapi.Response{"200": openapi.Text("Prometheus text exposition format")},
+	}
+
+	logLevel := openapi.SchemaOf(observe.LogLevelBody{})
+	logLevel.Properties["level"] = openapi.String("", "trace", "debug", "info", "warn", "error", "fatal", "panic", "disabled")
+	logLevelRef := doc.Define("LogLevel", logLevel)
+	logLevelPath := doc.Path("/debug/loglevel")
+	logLevelPath.Get = &openapi.Operation{
+		Summary:   "Current global log level; served only when /metrics credentials are configured",
+		Tags:      []string{"observability"},
+		Responses: map[string]openapi.Response{"200": openapi.Content("Current level", logLevelRef)},
+	}
+	logLevelPath.Put = &openapi.Operation{
+		Summary:     "Change the global log level without a restart; served only when /metrics credentials are configured",
+		Tags:        []string{"observability"},
+		RequestBody: openapi.JSONBody(logLevelRef),
+		Responses: map[string]openapi.Response{
+			"200": openapi.Content("New level", logLevelRef),
+			"400": errorResponse("Unknown level"),
+		},
+	}
+
+	return doc
+}
+
+// addLegacyPaths describes /v1 and /v2, which share one contract.
+func addLegacyPaths(doc *openapi.Document, version string, inputRef, subscriptionRef *openapi.Schema) {
+	tags := []string{version}
+	id := openapi.PathParam("id", "Subscription ID")
+
+	collection := doc.Path(fmt.Sprintf("/%s/subscriptions", version))
+	collection.Get = &openapi.Operation{
+		Summary:   "List all subscriptions",
+		Tags:      tags,
+		Responses: map[string]openapi.Response{"200": openapi.Content("Subscriptions", openapi.ArrayOf(subscriptionRef))},
+	}
+	collection.Post = &openapi.Operation{
+		Summary:     "Create a subscription and charge for it",
+		Tags:        tags,
+		RequestBody: openapi.JSONBody(inputRef),
+		Responses: map[string]openapi.Response{
+			"200": openapi.Content("Created", subscriptionRef),
+			"400": errorResponse("Malformed body, missing fields or unknown plan"),
+			"409": errorResponse("Per-user subscription limit reached"),
+			"413": errorResponse("Body too large"),
+			"500": errorResponse("Payment or storage failed"),
+		},
+	}
+
+	item := doc.Path(fmt.Sprintf("/%s/subscriptions/{id}", version))
+	item.Get = &openapi.Operation{
+		Summary:    "Get a subscription",
+		Tags:       tags,
+		Parameters: []openapi.Parameter{id},
+		Responses: map[string]openapi.Response{
+			"200": openapi.Content("Subscription", subscriptionRef),
+			"404": errorResponse("Not found"),
+		},
+	}
+	item.Put = &openapi.Operation{
+		Summary:     "Replace a subscription's user and plan",
+		Tags:        tags,
+		Parameters:  []openapi.Parameter{id},
+		RequestBody: openapi.JSONBody(inputRef),
+		Responses: map[string]openapi.Response{
+			"200": openapi.Content("Updated", subscriptionRef),
+			"400": errorResponse("Malformed body or unknown plan"),
+			"404": errorResponse("Not found"),
+			"413": errorResponse("Body too large"),
+		},
+	}
+	item.Delete = &openapi.Operation{
+		Summary:    "Delete a subscription",
+		Tags:       tags,
+		Parameters: []openapi.Parameter{id},
+		Responses: map[string]openapi.Response{
+			"204": openapi.NoContent("Deleted"),
+			"404": errorResponse("Not found"),
+		},
+	}
+}
+
+func addV3Paths(doc *openapi.Document, inputRef, subscriptionRef, batchErrorRef *openapi.Schema) {
+	tags := []string{"v3"}
+	security := []map[string][]string{{"bearerAuth": {}}}
+	id := openapi.PathParam("id", "Subscription ID")
+	negotiated := []string{"application/json", "application/xml", "text/csv"}
+	etag := map[string]openapi.Header{"ETag": {Description: "Current version and representation, e.g. \"3+json\", for If-None-Match and If-Match", Schema: &openapi.Schema{Type: "string"}}}
+
+	// Responses every /v3 route can return from its middleware
+	common := func(responses map[string]openapi.Response) map[string]openapi.Response {
+		responses["401"] = errorResponse("Missing or invalid bearer token")
+		responses["429"] = errorResponse("Rate limited; see Retry-After")
+		responses["504"] = errorResponse("Request timed out")
+		return responses
+	}
+
+	list := openapi.Content("A page of subscriptions", openapi.ArrayOf(subscriptionRef), negotiated...)
+	list.Headers = map[string]openapi.Header{
+		"X-Total-Count": {Description: "Matching subscriptions across all pages", Schema: &openapi.Schema{Type: "integer"}},
+		"ETag":          {Description: "Weak tag over the page and its representation", Schema: &openapi.Schema{Type: "string"}},
+	}
+	collection := doc.Path("/v3/subscriptions")
+	collection.Get = &openapi.Operation{
+		Summary:  "List subscriptions with paging, filtering and sorting",
+		Tags:     tags,
+		Security: security,
+		Parameters: []openapi.Parameter{
+			openapi.QueryParam("limit", "Page size; 0 returns everything", openapi.Integer("")),
+			openapi.QueryParam("offset", "Subscriptions to skip", openapi.Integer("")),
+			openapi.QueryParam("plan", "Only this plan", openapi.String("")),
+			openapi.QueryParam("sort", "Sort key", openapi.String("", services.SortByStartDate, services.SortByID, services.SortByPlan)),
+			openapi.HeaderParam("If-None-Match", "ETag of a cached page"),
+		},
+		Responses: common(map[string]openapi.Response{
+			"200": list,
+			"304": openapi.NoContent("The cached page is current"),
+			"400": errorResponse("Invalid query parameter"),
+		}),
+	}
+	collection.Post = &openapi.Operation{
+		Summary:     "Create a subscription and charge for it",
+		Tags:        tags,
+		Security:    security,
+		RequestBody: openapi.JSONBody(inputRef),
+		Responses: common(map[string]openapi.Response{
+			"200": openapi.Content("Created and paid", subscriptionRef, negotiated...),
+			"202": openapi.Content("Accepted as pending while the payment service is down (degraded mode)", subscriptionRef, negotiated...),
+			"400": errorResponse("Malformed body, missing fields or unknown plan"),
+			"402": errorResponse("Payment declined"),
+			"403": errorResponse("user_id differs from the authenticated caller"),
+			"409": errorResponse("Per-user subscription limit reached"),
+			"413": errorResponse("Body too large"),
+			"502": errorResponse("The payment service misbehaved, e.g. charged the wrong amount"),
+			"503": errorResponse("Payment service unavailable"),
+		}),
+	}
+
+	item := doc.Path("/v3/subscriptions/{id}")
+	found := openapi.Content("Subscription", subscriptionRef, negotiated...)
+	found.Headers = etag
+	item.Get = &openapi.Operation{
+		Summary:    "Get a subscription",
+		Tags:       tags,
+		Security:   security,
+		Parameters: []openapi.Parameter{id, openapi.HeaderParam("If-None-Match", "ETag of a cached copy")},
+		Responses: common(map[string]openapi.Response{
+			"200": found,
+			"304": openapi.NoContent("The cached copy is current"),
+			"404": errorResponse("Not found, or owned by another user"),
+		}),
+	}
+	updated := openapi.Content("Updated", subscriptionRef, negotiated...)
+	updated.Headers = etag
+	item.Put = &openapi.Operation{
+		Summary:     "Replace a subscription's user and plan",
+		Tags:        tags,
+		Security:    security,
+		Parameters:  []openapi.Parameter{id, openapi.HeaderParam("If-Match", "Only update if the ETag still matches")},
+		RequestBody: openapi.JSONBody(inputRef),
+		Responses: common(map[string]openapi.Response{
+			"200": updated,
+			"400": errorResponse("Malformed body, unknown plan or invalid If-Match"),
+			"403": errorResponse("user_id differs from the authenticated caller"),
+			"404": errorResponse("Not found, or owned by another user"),
+			"412": errorResponse("Modified since the If-Match version"),
+			"413": errorResponse("Body too large"),
+		}),
+	}
+	item.Delete = &openapi.Operation{
+		Summary:  "Cancel a subscription, optionally refunding its payment",
+		Tags:     tags,
+		Security: security,
+		Parameters: []openapi.Parameter{
+			id,
+			openapi.QueryParam("refund", "Refund the payment before deleting", &openapi.Schema{Type: "boolean"}),
+		},
+		Responses: common(map[string]openapi.Response{
+			"204": openapi.NoContent("Cancelled"),
+			"400": errorResponse("Invalid refund parameter"),
+			"402": errorResponse("Refund declined; the subscription is kept"),
+			"404": errorResponse("Not found, or owned by another user"),
+			"502": errorResponse("Refund rejected by the payment service; the subscription is kept"),
+			"503": errorResponse("Payment service unavailable; the subscription is kept"),
+		}),
+	}
+
+	doc.Path("/v3/subscriptions:batch").Post = &openapi.Operation{
+		Summary:     "Create already-paid subscriptions in bulk (admin role only); one invalid item rejects the batch",
+		Tags:        tags,
+		Security:    security,
+		RequestBody: openapi.JSONBody(openapi.ArrayOf(inputRef)),
+		Responses: common(map[string]openapi.Response{
+			"201": openapi.Content("Created", openapi.ArrayOf(subscriptionRef), negotiated...),
+			"400": openapi.Content("Invalid batch size, or invalid items listed in error.details", batchErrorRef),
+			"403": errorResponse("Caller is not an authenticated admin"),
+			"409": errorResponse("A user would exceed the subscription limit"),
+			"413": errorResponse("Body too large"),
+		}),
+	}
+}
+
+// errorResponse is a response with the Error body written by
+// observe.WriteError.
+func errorResponse(description string) openapi.Response {
+	return openapi.Content(description, openapi.Ref("Error"))
+}
+
+func RegisterOpenAPIRoutes(mux *http.ServeMux, deps *Dependencies) {
+	mux.HandleFunc("/openapi.json", openapi.Handler(OpenAPIDocument(deps.Plans.Names())))
+}
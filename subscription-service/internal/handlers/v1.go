@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"subscription-service/internal/models"
@@ -27,12 +26,12 @@ func (h *V1Handler) HandleSubscriptions(w http.ResponseWriter, r *http.Request)
 	case http.MethodGet:
 		h.getSubscriptions(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 }
 
 func (h *V1Handler) HandleSubscriptionByID(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[len("/v1/subscriptions/"):]
+	id := observe.PathValue(r, "id")
 
 	switch r.Method {
 	case http.MethodGet:
@@ -42,7 +41,7 @@ func (h *V1Handler) HandleSubscriptionByID(w http.ResponseWriter, r *http.Reques
 	case http.MethodDelete:
 		h.deleteSubscription(w, r, id)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 }
 
@@ -54,21 +53,20 @@ func (h *V1Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 		Plan   string `json:"plan"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+	if err := observe.DecodeJSON(w, r, &reqData, maxBodyBytes); err != nil {
 		h.deps.Logger.Error().Err(err).Str("version", "v1").Msg("bad request")
-		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
 	if reqData.UserID == "" || reqData.Plan == "" {
 		h.deps.Logger.Warn().Str("version", "v1").Msg("missing fields")
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "MISSING_FIELDS", "user_id and plan are required")
 		return
 	}
 
-	if !models.IsValidPlan(reqData.Plan) {
+	if !h.deps.Plans.IsValid(reqData.Plan) {
 		h.deps.Logger.Warn().Str("version", "v1").Str("plan", reqData.Plan).Msg("invalid plan")
-		http.Error(w, "Invalid plan", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_PLAN", "Invalid plan")
 		return
 	}
 
@@ -76,53 +74,55 @@ func (h *V1Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 		h.deps.Logger.Debug().Str("version", "v1").Msg("Creating subscription")
 	})
 
-	sub := h.deps.Repository.Create(reqData.UserID, reqData.Plan)
+	sub, err := h.deps.Repository.Create(r.Context(), reqData.UserID, reqData.Plan)
+	if err != nil {
+		h.deps.Logger.Warn().Err(err).Str("version", "v1").Msg("create failed")
+		writeCreateError(w, r, err)
+		return
+	}
 
 	paymentReq := models.PaymentRequest{
 		SubscriptionID: sub.ID,
-		Amount:         models.GetPlanPrice(sub.Plan),
+		Amount:         h.deps.Plans.Price(sub.Plan),
 		Plan:           sub.Plan,
 	}
 
 	ctx := r.Context()
 	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(make(http.Header)))
 
-	_, err := h.deps.PaymentService.ProcessPayment(ctx, paymentReq)
+	_, err = h.deps.PaymentService.ProcessPayment(ctx, paymentReq)
 	if err != nil {
 		h.deps.Logger.Error().Err(err).Str("version", "v1").Msg("payment failed")
 
-		http.Error(w, "Payment processing failed", http.StatusInternalServerError)
+		observe.WriteError(w, r, http.StatusInternalServerError, "PAYMENT_FAILED", "Payment processing failed")
 		return
 	}
 
 	h.deps.Logger.Info().Str("version", "v1").Str("subscription_id", sub.ID).Msg("subscription created")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
 func (h *V1Handler) getSubscriptions(w http.ResponseWriter, r *http.Request) {
 	h.deps.Logger.Info().Str("version", "v1").Msg("getting subscriptions")
 
-	subs := h.deps.Repository.GetAll()
+	subs := h.deps.Repository.GetAll(r.Context())
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(subs)
+	observe.Respond(w, r, http.StatusOK, subs)
 }
 
 func (h *V1Handler) getSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	h.deps.Logger.Info().Str("version", "v1").Str("subscription_id", id).Msg("getting subscription")
 
-	sub, exists := h.deps.Repository.GetByID(id)
+	sub, exists := h.deps.Repository.GetByID(r.Context(), id)
 	if !exists {
 		h.deps.Logger.Warn().Str("version", "v1").Str("subscription_id", id).Msg("not found")
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
 	h.deps.Logger.Info().Str("version", "v1").Str("subscription_id", id).Msg("found subscription")
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
 func (h *V1Handler) updateSubscription(w http.ResponseWriter, r *http.Request, id string) {
@@ -133,38 +133,36 @@ func (h *V1Handler) updateSubscription(w http.ResponseWriter, r *http.Request, i
 		Plan   string `json:"plan"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+	if err := observe.DecodeJSON(w, r, &reqData, maxBodyBytes); err != nil {
 		h.deps.Logger.Error().Err(err).Str("version", "v1").Msg("decode error")
-		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	if !models.IsValidPlan(reqData.Plan) {
+	if !h.deps.Plans.IsValid(reqData.Plan) {
 		h.deps.Logger.Warn().Str("version", "v1").Str("plan", reqData.Plan).Msg("invalid plan")
-		http.Error(w, "Invalid plan", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_PLAN", "Invalid plan")
 		return
 	}
 
-	sub, exists := h.deps.Repository.Update(id, reqData.UserID, reqData.Plan)
+	sub, exists := h.deps.Repository.Update(r.Context(), id, reqData.UserID, reqData.Plan)
 	if !exists {
 		h.deps.Logger.Warn().Str("version", "v1").Str("subscription_id", id).Msg("not found")
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
 	h.deps.Logger.Info().Str("version", "v1").Str("subscription_id", id).Msg("updated")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
 func (h *V1Handler) deleteSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	h.deps.Logger.Info().Str("version", "v1").Str("subscription_id", id).Msg("deleting subscription")
 
-	_, exists := h.deps.Repository.Delete(id)
+	_, exists := h.deps.Repository.Delete(r.Context(), id)
 	if !exists {
 		h.deps.Logger.Warn().Str("version", "v1").Str("subscription_id", id).Msg("not found")
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
@@ -172,9 +170,23 @@ func (h *V1Handler) deleteSubscription(w http.ResponseWriter, r *http.Request, i
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func RegisterV1Routes(deps *Dependencies) {
+func RegisterV1Routes(mux *http.ServeMux, deps *Dependencies) {
 	handler := NewV1Handler(deps)
 
-	http.HandleFunc("/v1/subscriptions", deps.TracingV1.InstrumentHandler(observe.InstrumentHandlerV1(handler.HandleSubscriptions, deps.MetricsV1)))
-	http.HandleFunc("/v1/subscriptions/", deps.TracingV1.InstrumentHandler(observe.InstrumentHandlerV1(handler.HandleSubscriptionByID, deps.MetricsV1)))
+	chain := observe.Chain(
+		deps.Recover,
+		deps.TracingV1.InstrumentHandler,
+		observe.MetricsMiddlewareV1(deps.MetricsV1),
+		deps.Timeout,
+	)
+
+	if deps.Auth != nil {
+		disabled := chain(versionDisabled("/v1"))
+		mux.HandleFunc("/v1/subscriptions", disabled)
+		mux.HandleFunc("/v1/subscriptions/{id}", disabled)
+		return
+	}
+
+	mux.HandleFunc("/v1/subscriptions", chain(handler.HandleSubscriptions))
+	mux.HandleFunc("/v1/subscriptions/{id}", chain(handler.HandleSubscriptionByID))
 }
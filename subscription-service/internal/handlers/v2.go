@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
@@ -25,12 +24,12 @@ func (h *V2Handler) HandleSubscriptions(w http.ResponseWriter, r *http.Request)
 	case http.MethodGet:
 		h.getSubscriptions(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 }
 
 func (h *V2Handler) HandleSubscriptionByID(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[len("/v2/subscriptions/"):]
+	id := observe.PathValue(r, "id")
 
 	switch r.Method {
 	case http.MethodGet:
@@ -40,7 +39,7 @@ func (h *V2Handler) HandleSubscriptionByID(w http.ResponseWriter, r *http.Reques
 	case http.MethodDelete:
 		h.deleteSubscription(w, r, id)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 }
 
@@ -53,40 +52,44 @@ func (h *V2Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 		Plan   string `json:"plan"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+	if err := observe.DecodeJSON(w, r, &reqData, maxBodyBytes); err != nil {
 		h.deps.Logger.Error().Err(err).Str("version", "v2").Str("error_type", "decode_error").Msg("Failed to decode request")
-		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
 	if reqData.UserID == "" || reqData.Plan == "" {
 		h.deps.Logger.Warn().Str("version", "v2").Msg("Missing required fields")
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "MISSING_FIELDS", "user_id and plan are required")
 		return
 	}
 
-	if !models.IsValidPlan(reqData.Plan) {
+	if !h.deps.Plans.IsValid(reqData.Plan) {
 		h.deps.Logger.Warn().Str("version", "v2").Str("plan", reqData.Plan).Msg("Invalid plan")
-		http.Error(w, "Invalid plan", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_PLAN", "Invalid plan")
 		return
 	}
 
-	sub := h.deps.Repository.Create(reqData.UserID, reqData.Plan)
+	sub, err := h.deps.Repository.Create(r.Context(), reqData.UserID, reqData.Plan)
+	if err != nil {
+		h.deps.Logger.Warn().Err(err).Str("version", "v2").Msgf("Subscription rejected - user_id=%s", reqData.UserID)
+		writeCreateError(w, r, err)
+		return
+	}
 
-	h.deps.Logger.Debug().Str("version", "v2").Msgf("Processing payment - subscription_id=%s amount=%.2f plan=%s", sub.ID, models.GetPlanPrice(sub.Plan), sub.Plan)
+	h.deps.Logger.Debug().Str("version", "v2").Msgf("Processing payment - subscription_id=%s amount=%.2f plan=%s", sub.ID, h.deps.Plans.Price(sub.Plan), sub.Plan)
 
 	paymentReq := models.PaymentRequest{
 		SubscriptionID: sub.ID,
-		Amount:         models.GetPlanPrice(sub.Plan),
+		Amount:         h.deps.Plans.Price(sub.Plan),
 		Plan:           sub.Plan,
 	}
 
-	_, err := h.deps.PaymentService.ProcessPayment(r.Context(), paymentReq)
+	_, err = h.deps.PaymentService.ProcessPayment(r.Context(), paymentReq)
 	if err != nil {
 		h.deps.Logger.Error().Err(err).Str("version", "v2").Msgf("Payment request failed - subscription_id=%s error=%v", sub.ID, err)
 
-		h.deps.Repository.Delete(sub.ID)
-		http.Error(w, "Payment processing failed", http.StatusInternalServerError)
+		h.deps.Repository.Delete(r.Context(), sub.ID)
+		observe.WriteError(w, r, http.StatusInternalServerError, "PAYMENT_FAILED", "Payment processing failed")
 		return
 	}
 
@@ -94,33 +97,30 @@ func (h *V2Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 
 	h.deps.Logger.Info().Str("version", "v2").Msgf("Subscription created successfully - subscription_id=%s user_id=%s plan=%s duration_ms=%d", sub.ID, sub.UserID, sub.Plan, time.Since(startTime).Milliseconds())
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
 func (h *V2Handler) getSubscriptions(w http.ResponseWriter, r *http.Request) {
-	count := h.deps.Repository.Count()
+	count := h.deps.Repository.Count(r.Context())
 	h.deps.Logger.Info().Str("version", "v2").Msgf("Getting all subscriptions - count=%d", count)
 
-	subs := h.deps.Repository.GetAll()
+	subs := h.deps.Repository.GetAll(r.Context())
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(subs)
+	observe.Respond(w, r, http.StatusOK, subs)
 }
 
 func (h *V2Handler) getSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	h.deps.Logger.Info().Str("version", "v2").Msgf("Getting subscription - subscription_id=%s", id)
 
-	sub, exists := h.deps.Repository.GetByID(id)
+	sub, exists := h.deps.Repository.GetByID(r.Context(), id)
 	if !exists {
 		h.deps.Logger.Warn().Str("version", "v2").Msgf("Subscription not found - subscription_id=%s", id)
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
 	h.deps.Logger.Info().Str("version", "v2").Msgf("Found subscription - subscription_id=%s user_id=%s plan=%s", sub.ID, sub.UserID, sub.Plan)
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
 func (h *V2Handler) updateSubscription(w http.ResponseWriter, r *http.Request, id string) {
@@ -132,41 +132,39 @@ func (h *V2Handler) updateSubscription(w http.ResponseWriter, r *http.Request, i
 		Plan   string `json:"plan"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
+	if err := observe.DecodeJSON(w, r, &reqData, maxBodyBytes); err != nil {
 		h.deps.Logger.Error().Err(err).Str("version", "v2").Msgf("Failed to decode update request - subscription_id=%s", id)
-		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	if !models.IsValidPlan(reqData.Plan) {
+	if !h.deps.Plans.IsValid(reqData.Plan) {
 		h.deps.Logger.Warn().Str("version", "v2").Str("plan", reqData.Plan).Msgf("Invalid plan for update - subscription_id=%s", id)
-		http.Error(w, "Invalid plan", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_PLAN", "Invalid plan")
 		return
 	}
 
-	oldSub, exists := h.deps.Repository.GetByID(id)
+	oldSub, exists := h.deps.Repository.GetByID(r.Context(), id)
 	if !exists {
 		h.deps.Logger.Warn().Str("version", "v2").Msgf("Subscription not found for update - subscription_id=%s", id)
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
-	sub, _ := h.deps.Repository.Update(id, reqData.UserID, reqData.Plan)
+	sub, _ := h.deps.Repository.Update(r.Context(), id, reqData.UserID, reqData.Plan)
 
 	h.deps.Logger.Info().Str("version", "v2").Msgf("Subscription updated successfully - subscription_id=%s old_plan=%s new_plan=%s duration_ms=%d", id, oldSub.Plan, sub.Plan, time.Since(startTime).Milliseconds())
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
 func (h *V2Handler) deleteSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	startTime := time.Now()
 	h.deps.Logger.Info().Str("version", "v2").Msgf("Deleting subscription - subscription_id=%s", id)
 
-	sub, exists := h.deps.Repository.Delete(id)
+	sub, exists := h.deps.Repository.Delete(r.Context(), id)
 	if !exists {
 		h.deps.Logger.Warn().Str("version", "v2").Msgf("Subscription not found for deletion - subscription_id=%s", id)
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
@@ -175,9 +173,23 @@ func (h *V2Handler) deleteSubscription(w http.ResponseWriter, r *http.Request, i
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func RegisterV2Routes(deps *Dependencies) {
+func RegisterV2Routes(mux *http.ServeMux, deps *Dependencies) {
 	handler := NewV2Handler(deps)
 
-	http.HandleFunc("/v2/subscriptions", deps.TracingV2.InstrumentHandler(observe.InstrumentHandlerV2(handler.HandleSubscriptions, deps.MetricsV2)))
-	http.HandleFunc("/v2/subscriptions/", deps.TracingV2.InstrumentHandler(observe.InstrumentHandlerV2(handler.HandleSubscriptionByID, deps.MetricsV2)))
+	chain := observe.Chain(
+		deps.Recover,
+		deps.TracingV2.InstrumentHandler,
+		observe.MetricsMiddlewareV2(deps.MetricsV2),
+		deps.Timeout,
+	)
+
+	if deps.Auth != nil {
+		disabled := chain(versionDisabled("/v2"))
+		mux.HandleFunc("/v2/subscriptions", disabled)
+		mux.HandleFunc("/v2/subscriptions/{id}", disabled)
+		return
+	}
+
+	mux.HandleFunc("/v2/subscriptions", chain(handler.HandleSubscriptions))
+	mux.HandleFunc("/v2/subscriptions/{id}", chain(handler.HandleSubscriptionByID))
 }
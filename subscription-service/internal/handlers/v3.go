@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"subscription-service/internal/models"
+	"subscription-service/internal/services"
 
 	observe "observability"
 )
@@ -26,13 +31,13 @@ func (h *V3Handler) HandleSubscriptions(w http.ResponseWriter, r *http.Request)
 	case http.MethodGet:
 		h.getSubscriptions(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 }
 
 // HandleSubscriptionByID handles the /v3/subscriptions/{id} endpoint
 func (h *V3Handler) HandleSubscriptionByID(w http.ResponseWriter, r *http.Request) {
-	id := r.URL.Path[len("/v3/subscriptions/"):]
+	id := observe.PathValue(r, "id")
 
 	switch r.Method {
 	case http.MethodGet:
@@ -42,28 +47,22 @@ func (h *V3Handler) HandleSubscriptionByID(w http.ResponseWriter, r *http.Reques
 	case http.MethodDelete:
 		h.deleteSubscription(w, r, id)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 	}
 }
 
 func (h *V3Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	ctx := r.Context()
-
-	h.deps.Logger.Debug().
-		Str("version", "v3").
-		Str("method", "POST").
-		Str("path", "/v3/subscriptions").
-		Str("client_ip", r.RemoteAddr).
-		Msg("Processing create subscription request")
+	logger := observe.SampledLevel(ctx, observe.LogWithTrace(ctx, h.deps.Logger))
 
 	var reqData struct {
 		UserID string `json:"user_id"`
 		Plan   string `json:"plan"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
-		h.deps.Logger.Error().
+	if err := observe.DecodeJSON(w, r, &reqData, maxBodyBytes); err != nil {
+		logger.Error().
 			Err(err).
 			Str("version", "v3").
 			Str("method", "POST").
@@ -72,12 +71,30 @@ func (h *V3Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Failed to decode subscription request")
-		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
+	// With authentication on, subscriptions can only be created for the caller
+	if identity, ok := observe.IdentityFromContext(ctx); ok {
+		if reqData.UserID == "" {
+			reqData.UserID = identity.UserID
+		} else if reqData.UserID != identity.UserID {
+			logger.Warn().
+				Str("version", "v3").
+				Str("method", "POST").
+				Str("path", "/v3/subscriptions").
+				Str("error_type", "forbidden").
+				Str("user_id", identity.UserID).
+				Str("client_ip", r.RemoteAddr).
+				Dur("duration_ms", time.Since(startTime)).
+				Msg("Subscription requested for another user")
+			observe.WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "user_id must match the authenticated user")
+			return
+		}
+	}
+
 	if reqData.UserID == "" || reqData.Plan == "" {
-		h.deps.Logger.Warn().
+		logger.Warn().
 			Str("version", "v3").
 			Str("method", "POST").
 			Str("path", "/v3/subscriptions").
@@ -87,12 +104,12 @@ func (h *V3Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Missing required fields in subscription request")
-		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "MISSING_FIELDS", "user_id and plan are required")
 		return
 	}
 
-	if !models.IsValidPlan(reqData.Plan) {
-		h.deps.Logger.Warn().
+	if !h.deps.Plans.IsValid(reqData.Plan) {
+		logger.Warn().
 			Str("version", "v3").
 			Str("method", "POST").
 			Str("path", "/v3/subscriptions").
@@ -104,41 +121,102 @@ func (h *V3Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 
 		h.deps.MetricsV3.BusinessErrors.WithLabelValues("validation_error", "invalid_plan", "warning").Inc()
 
-		http.Error(w, "Invalid plan", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_PLAN", "Invalid plan")
 		return
 	}
 
-	sub := h.deps.Repository.Create(reqData.UserID, reqData.Plan)
+	// Pending until paid, so no other request can read a subscription whose
+	// payment may still fail
+	sub, err := h.deps.Repository.CreatePending(ctx, reqData.UserID, reqData.Plan)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("version", "v3").
+			Str("method", "POST").
+			Str("path", "/v3/subscriptions").
+			Str("user_id", reqData.UserID).
+			Str("error_type", "create_error").
+			Str("client_ip", r.RemoteAddr).
+			Dur("duration_ms", time.Since(startTime)).
+			Msg("Failed to create subscription")
 
-	h.deps.Logger.Debug().
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			h.deps.MetricsV3.BusinessErrors.WithLabelValues("quota_error", "subscription_limit", "warning").Inc()
+		}
+
+		writeCreateError(w, r, err)
+		return
+	}
+
+	// Charge and report revenue from the same plan even if the registry is
+	// reloaded mid-request
+	plan, _ := h.deps.Plans.Lookup(sub.Plan)
+
+	logger.Debug().
 		Str("version", "v3").
 		Str("method", "POST").
 		Str("path", "/v3/subscriptions").
 		Str("subscription_id", sub.ID).
 		Str("user_id", sub.UserID).
 		Str("plan", sub.Plan).
-		Float64("amount", models.GetPlanPrice(sub.Plan)).
+		Float64("amount", plan.Price()).
 		Str("client_ip", r.RemoteAddr).
 		Msg("Processing payment for subscription")
 
 	paymentReq := models.PaymentRequest{
 		SubscriptionID: sub.ID,
-		Amount:         models.GetPlanPrice(sub.Plan),
+		Amount:         plan.Price(),
 		Plan:           sub.Plan,
 	}
 
-	paymentErr := h.deps.TracingV3.TraceOperation(ctx, "process_payment", "business", map[string]interface{}{
+	region, paymentMethod := observe.BusinessLabelsFromRequest(r)
+	paymentStart := time.Now()
+
+	var payment *models.PaymentResponse
+
+	paymentErr := h.deps.TracingV3.TraceOperationSampled(ctx, "process_payment", "business", true, map[string]interface{}{
 		"subscription_id": sub.ID,
 		"plan":            sub.Plan,
 		"amount":          paymentReq.Amount,
 		"user_id":         sub.UserID,
 	}, func(ctx context.Context) error {
-		_, err := h.deps.PaymentService.ProcessPayment(ctx, paymentReq)
-		return err
+		resp, err := h.deps.PaymentService.ProcessPayment(ctx, paymentReq)
+		if err != nil {
+			return err
+		}
+		payment = resp
+		// A wrong charge fails the operation, so the span records the error
+		return services.VerifyPaymentAmount(resp, paymentReq.Amount)
 	})
 
+	h.deps.MetricsV3.PaymentProcessingTime.WithLabelValues(paymentMethod, sub.Plan).Observe(time.Since(paymentStart).Seconds())
+
+	if paymentErr != nil && h.deps.PaymentQueue != nil && services.IsPaymentUnavailable(paymentErr) {
+		_, failureType, _ := paymentFailureResponse(paymentErr)
+		h.deps.PaymentQueue.Enqueue(paymentReq)
+		h.deps.MetricsV3.PaymentFailures.WithLabelValues(failureType, paymentMethod, sub.Plan).Inc()
+
+		logger.Warn().
+			Err(paymentErr).
+			Str("version", "v3").
+			Str("method", "POST").
+			Str("path", "/v3/subscriptions").
+			Str("subscription_id", sub.ID).
+			Str("user_id", sub.UserID).
+			Str("plan", sub.Plan).
+			Str("failure_type", failureType).
+			Str("client_ip", r.RemoteAddr).
+			Dur("duration_ms", time.Since(startTime)).
+			Msg("Payment service unavailable, subscription accepted as pending")
+
+		// Reads keep hiding the subscription until the queued payment succeeds
+		observe.Respond(w, r, http.StatusAccepted, sub)
+		return
+	}
+
 	if paymentErr != nil {
-		h.deps.Logger.Error().
+		status, failureType, message := paymentFailureResponse(paymentErr)
+		logger.Error().
 			Err(paymentErr).
 			Str("version", "v3").
 			Str("method", "POST").
@@ -148,22 +226,43 @@ func (h *V3Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 			Str("plan", sub.Plan).
 			Float64("amount", paymentReq.Amount).
 			Str("error_type", "payment_error").
+			Str("failure_type", failureType).
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Payment processing failed")
 
-		h.deps.Repository.Delete(sub.ID)
+		h.deps.Repository.Abort(ctx, sub.ID)
 
-		h.deps.MetricsV3.PaymentFailures.WithLabelValues("payment_service_error", "unknown", "critical").Inc()
+		h.deps.MetricsV3.PaymentFailures.WithLabelValues(failureType, paymentMethod, sub.Plan).Inc()
+		var mismatch *services.AmountMismatchError
+		if errors.As(paymentErr, &mismatch) {
+			h.deps.MetricsV3.PaymentAmountMismatch.WithLabelValues(sub.Plan).Inc()
+		}
 
-		http.Error(w, "Payment processing failed", http.StatusInternalServerError)
+		observe.WriteErrorDetail(w, r, status, observe.ErrorDetail{Code: "PAYMENT_FAILED", Message: message, Type: failureType})
 		return
 	}
 
-	h.deps.MetricsV3.SubscriptionsActive.Inc()
-	h.deps.MetricsV3.SubscriptionsCreated.WithLabelValues(sub.Plan, "default", "credit_card").Inc()
+	confirmed, ok := h.deps.Repository.Confirm(ctx, sub.ID, *payment)
+	if !ok {
+		logger.Error().
+			Str("version", "v3").
+			Str("method", "POST").
+			Str("path", "/v3/subscriptions").
+			Str("subscription_id", sub.ID).
+			Str("error_type", "confirm_error").
+			Str("client_ip", r.RemoteAddr).
+			Dur("duration_ms", time.Since(startTime)).
+			Msg("Failed to confirm paid subscription")
+		observe.WriteError(w, r, http.StatusInternalServerError, "CONFIRM_FAILED", "Failed to confirm subscription")
+		return
+	}
+	sub = confirmed
 
-	h.deps.Logger.Info().
+	h.deps.MetricsV3.SubscriptionsCreated.WithLabelValues(sub.Plan, region, paymentMethod).Inc()
+	h.deps.MetricsV3.SubscriptionRevenue.WithLabelValues(sub.Plan, region, paymentMethod).Add(float64(plan.PriceCents))
+
+	logger.Info().
 		Str("version", "v3").
 		Str("method", "POST").
 		Str("path", "/v3/subscriptions").
@@ -175,51 +274,209 @@ func (h *V3Handler) createSubscription(w http.ResponseWriter, r *http.Request) {
 		Dur("duration_ms", time.Since(startTime)).
 		Msg("Subscription created successfully")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
-func (h *V3Handler) getSubscriptions(w http.ResponseWriter, r *http.Request) {
+// maxBatchSize bounds POST /v3/subscriptions:batch
+const maxBatchSize = 500
+
+// batchItemError reports why one batch item was rejected.
+type batchItemError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// HandleBatch creates many subscriptions at once for user migrations. The
+// subscriptions are assumed to be paid for already, so no payment is taken
+// and only authenticated callers with the admin role may use it; without
+// auth configured it is refused. One invalid item rejects the whole batch.
+func (h *V3Handler) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		observe.WriteError(w, r, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
 	startTime := time.Now()
-	count := h.deps.Repository.Count()
+	ctx := r.Context()
+	logger := observe.SampledLevel(ctx, observe.LogWithTrace(ctx, h.deps.Logger))
+
+	if identity, ok := observe.IdentityFromContext(ctx); !ok || !identity.HasRole(observe.RoleAdmin) {
+		logger.Warn().
+			Str("version", "v3").
+			Str("method", "POST").
+			Str("path", "/v3/subscriptions:batch").
+			Str("error_type", "forbidden").
+			Str("client_ip", r.RemoteAddr).
+			Msg("Batch rejected for a caller without the admin role")
+		observe.WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "Batch creation requires an authenticated admin")
+		return
+	}
+
+	var items []services.CreateInput
+	if err := observe.DecodeJSON(w, r, &items, maxBodyBytes); err != nil {
+		logger.Error().
+			Err(err).
+			Str("version", "v3").
+			Str("method", "POST").
+			Str("path", "/v3/subscriptions:batch").
+			Str("error_type", "decode_error").
+			Str("client_ip", r.RemoteAddr).
+			Dur("duration_ms", time.Since(startTime)).
+			Msg("Failed to decode batch request")
+		return
+	}
+
+	if len(items) == 0 || len(items) > maxBatchSize {
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_BATCH_SIZE", fmt.Sprintf("Batch must contain 1 to %d items", maxBatchSize))
+		return
+	}
+
+	var itemErrors []batchItemError
+	for i, item := range items {
+		switch {
+		case item.UserID == "" || item.Plan == "":
+			itemErrors = append(itemErrors, batchItemError{Index: i, Error: "missing required fields"})
+		case !h.deps.Plans.IsValid(item.Plan):
+			itemErrors = append(itemErrors, batchItemError{Index: i, Error: "invalid plan"})
+		}
+	}
+	if len(itemErrors) > 0 {
+		logger.Warn().
+			Str("version", "v3").
+			Str("method", "POST").
+			Str("path", "/v3/subscriptions:batch").
+			Str("error_type", "validation_error").
+			Int("batch_size", len(items)).
+			Int("invalid_items", len(itemErrors)).
+			Str("client_ip", r.RemoteAddr).
+			Dur("duration_ms", time.Since(startTime)).
+			Msg("Batch rejected due to invalid items")
+
+		h.deps.MetricsV3.BusinessErrors.WithLabelValues("validation_error", "invalid_batch", "warning").Inc()
+
+		observe.WriteErrorDetail(w, r, http.StatusBadRequest, observe.ErrorDetail{
+			Code:    "INVALID_BATCH_ITEMS",
+			Message: fmt.Sprintf("%d of %d items are invalid", len(itemErrors), len(items)),
+			Details: itemErrors,
+		})
+		return
+	}
 
-	h.deps.Logger.Debug().
+	var subs []models.Subscription
+	err := h.deps.TracingV3.TraceOperation(ctx, "create_subscription_batch", "business", map[string]interface{}{
+		"batch_size": len(items),
+	}, func(ctx context.Context) error {
+		var err error
+		subs, err = h.deps.Repository.CreateBatch(ctx, items)
+		return err
+	})
+	if err != nil {
+		logger.Error().
+			Err(err).
+			Str("version", "v3").
+			Str("method", "POST").
+			Str("path", "/v3/subscriptions:batch").
+			Str("error_type", "create_error").
+			Int("batch_size", len(items)).
+			Str("client_ip", r.RemoteAddr).
+			Dur("duration_ms", time.Since(startTime)).
+			Msg("Failed to create subscription batch")
+		writeCreateError(w, r, err)
+		return
+	}
+
+	region, paymentMethod := observe.BusinessLabelsFromRequest(r)
+	for _, sub := range subs {
+		h.deps.MetricsV3.SubscriptionsCreated.WithLabelValues(sub.Plan, region, paymentMethod).Inc()
+	}
+
+	logger.Info().
 		Str("version", "v3").
-		Str("method", "GET").
-		Str("path", "/v3/subscriptions").
-		Int("subscriptions_count", count).
+		Str("method", "POST").
+		Str("path", "/v3/subscriptions:batch").
+		Int("batch_size", len(subs)).
 		Str("client_ip", r.RemoteAddr).
-		Msg("Processing get all subscriptions request")
+		Dur("duration_ms", time.Since(startTime)).
+		Msg("Subscription batch created successfully")
 
-	subs := h.deps.Repository.GetAll()
+	observe.Respond(w, r, http.StatusCreated, subs)
+}
 
-	h.deps.Logger.Info().
+func (h *V3Handler) getSubscriptions(w http.ResponseWriter, r *http.Request) {
+	startTime := time.Now()
+	logger := observe.SampledLevel(r.Context(), observe.LogWithTrace(r.Context(), h.deps.Logger))
+
+	opts, err := parseListOptions(r)
+	if err != nil {
+		logger.Warn().
+			Err(err).
+			Str("version", "v3").
+			Str("query", r.URL.RawQuery).
+			Msg("Invalid list query parameters")
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+		return
+	}
+
+	// Callers only see their own subscriptions, as with ownedByCaller
+	if identity, ok := observe.IdentityFromContext(r.Context()); ok {
+		opts.UserID = identity.UserID
+	}
+	subs, total := h.deps.Repository.List(r.Context(), opts)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if notModified(w, r, listETag(r, subs, total)) {
+		return
+	}
+
+	logger.Info().
 		Str("version", "v3").
 		Str("method", "GET").
 		Str("path", "/v3/subscriptions").
 		Int("subscriptions_returned", len(subs)).
+		Int("subscriptions_total", total).
 		Str("client_ip", r.RemoteAddr).
 		Dur("duration_ms", time.Since(startTime)).
 		Msg("Subscriptions retrieved successfully")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(subs)
+	observe.Respond(w, r, http.StatusOK, subs)
+}
+
+// parseListOptions reads ?limit=&offset=&plan=&sort= from the query string.
+func parseListOptions(r *http.Request) (services.ListOptions, error) {
+	query := r.URL.Query()
+	opts := services.ListOptions{
+		Plan:   query.Get("plan"),
+		SortBy: query.Get("sort"),
+	}
+
+	for name, target := range map[string]*int{"limit": &opts.Limit, "offset": &opts.Offset} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return opts, fmt.Errorf("invalid %s: %q", name, raw)
+		}
+		*target = value
+	}
+
+	switch opts.SortBy {
+	case "", services.SortByStartDate, services.SortByID, services.SortByPlan:
+	default:
+		return opts, fmt.Errorf("invalid sort: %q", opts.SortBy)
+	}
+
+	return opts, nil
 }
 
 func (h *V3Handler) getSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	startTime := time.Now()
+	logger := observe.SampledLevel(r.Context(), observe.LogWithTrace(r.Context(), h.deps.Logger))
 
-	h.deps.Logger.Debug().
-		Str("version", "v3").
-		Str("method", "GET").
-		Str("path", "/v3/subscriptions/{id}").
-		Str("subscription_id", id).
-		Str("client_ip", r.RemoteAddr).
-		Msg("Processing get subscription request")
-
-	sub, exists := h.deps.Repository.GetByID(id)
-	if !exists {
-		h.deps.Logger.Warn().
+	sub, exists := h.deps.Repository.GetByID(r.Context(), id)
+	if !exists || !ownedByCaller(r.Context(), sub) {
+		logger.Warn().
 			Str("version", "v3").
 			Str("method", "GET").
 			Str("path", "/v3/subscriptions/{id}").
@@ -227,11 +484,15 @@ func (h *V3Handler) getSubscription(w http.ResponseWriter, r *http.Request, id s
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Subscription not found")
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
-	h.deps.Logger.Info().
+	if notModified(w, r, versionETag(r, sub.Version)) {
+		return
+	}
+
+	logger.Info().
 		Str("version", "v3").
 		Str("method", "GET").
 		Str("path", "/v3/subscriptions/{id}").
@@ -242,28 +503,20 @@ func (h *V3Handler) getSubscription(w http.ResponseWriter, r *http.Request, id s
 		Dur("duration_ms", time.Since(startTime)).
 		Msg("Subscription retrieved successfully")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	observe.Respond(w, r, http.StatusOK, sub)
 }
 
 func (h *V3Handler) updateSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	startTime := time.Now()
-
-	h.deps.Logger.Debug().
-		Str("version", "v3").
-		Str("method", "PUT").
-		Str("path", "/v3/subscriptions/{id}").
-		Str("subscription_id", id).
-		Str("client_ip", r.RemoteAddr).
-		Msg("Processing update subscription request")
+	logger := observe.SampledLevel(r.Context(), observe.LogWithTrace(r.Context(), h.deps.Logger))
 
 	var reqData struct {
 		UserID string `json:"user_id"`
 		Plan   string `json:"plan"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&reqData); err != nil {
-		h.deps.Logger.Error().
+	if err := observe.DecodeJSON(w, r, &reqData, maxBodyBytes); err != nil {
+		logger.Error().
 			Err(err).
 			Str("version", "v3").
 			Str("method", "PUT").
@@ -273,12 +526,11 @@ func (h *V3Handler) updateSubscription(w http.ResponseWriter, r *http.Request, i
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Failed to decode update request")
-		http.Error(w, "Bad request", http.StatusBadRequest)
 		return
 	}
 
-	if !models.IsValidPlan(reqData.Plan) {
-		h.deps.Logger.Warn().
+	if !h.deps.Plans.IsValid(reqData.Plan) {
+		logger.Warn().
 			Str("version", "v3").
 			Str("method", "PUT").
 			Str("path", "/v3/subscriptions/{id}").
@@ -288,13 +540,13 @@ func (h *V3Handler) updateSubscription(w http.ResponseWriter, r *http.Request, i
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Invalid plan for subscription update")
-		http.Error(w, "Invalid plan", http.StatusBadRequest)
+		observe.WriteError(w, r, http.StatusBadRequest, "INVALID_PLAN", "Invalid plan")
 		return
 	}
 
-	oldSub, exists := h.deps.Repository.GetByID(id)
-	if !exists {
-		h.deps.Logger.Warn().
+	oldSub, exists := h.deps.Repository.GetByID(r.Context(), id)
+	if !exists || !ownedByCaller(r.Context(), oldSub) {
+		logger.Warn().
 			Str("version", "v3").
 			Str("method", "PUT").
 			Str("path", "/v3/subscriptions/{id}").
@@ -302,13 +554,70 @@ func (h *V3Handler) updateSubscription(w http.ResponseWriter, r *http.Request, i
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Subscription not found for update")
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
-	sub, _ := h.deps.Repository.Update(id, reqData.UserID, reqData.Plan)
+	// With authentication on, subscriptions cannot be handed to another user
+	if identity, ok := observe.IdentityFromContext(r.Context()); ok {
+		if reqData.UserID == "" {
+			reqData.UserID = identity.UserID
+		} else if reqData.UserID != identity.UserID {
+			logger.Warn().
+				Str("version", "v3").
+				Str("method", "PUT").
+				Str("path", "/v3/subscriptions/{id}").
+				Str("subscription_id", id).
+				Str("error_type", "forbidden").
+				Str("user_id", identity.UserID).
+				Str("client_ip", r.RemoteAddr).
+				Dur("duration_ms", time.Since(startTime)).
+				Msg("Subscription update would move it to another user")
+			observe.WriteError(w, r, http.StatusForbidden, "FORBIDDEN", "user_id must match the authenticated user")
+			return
+		}
+	}
 
-	h.deps.Logger.Info().
+	var sub models.Subscription
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		expectedVersion, err := etagVersion(ifMatch)
+		if err != nil {
+			observe.WriteError(w, r, http.StatusBadRequest, "INVALID_IF_MATCH", "Invalid If-Match header")
+			return
+		}
+
+		sub, err = h.deps.Repository.UpdateIfVersion(r.Context(), id, expectedVersion, reqData.UserID, reqData.Plan)
+		if errors.Is(err, services.ErrVersionConflict) {
+			logger.Warn().
+				Str("version", "v3").
+				Str("method", "PUT").
+				Str("path", "/v3/subscriptions/{id}").
+				Str("subscription_id", id).
+				Int("expected_version", expectedVersion).
+				Int("current_version", sub.Version).
+				Str("error_type", "version_conflict").
+				Str("client_ip", r.RemoteAddr).
+				Dur("duration_ms", time.Since(startTime)).
+				Msg("Subscription was modified concurrently")
+			w.Header().Set("ETag", versionETag(r, sub.Version))
+			observe.WriteError(w, r, http.StatusPreconditionFailed, "VERSION_CONFLICT", "Subscription was modified since the If-Match version")
+			return
+		}
+		if err != nil {
+			observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
+			return
+		}
+	} else {
+		var updated bool
+		// A concurrent delete can remove it after the lookup above
+		sub, updated = h.deps.Repository.Update(r.Context(), id, reqData.UserID, reqData.Plan)
+		if !updated {
+			observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
+			return
+		}
+	}
+
+	logger.Info().
 		Str("version", "v3").
 		Str("method", "PUT").
 		Str("path", "/v3/subscriptions/{id}").
@@ -320,24 +629,103 @@ func (h *V3Handler) updateSubscription(w http.ResponseWriter, r *http.Request, i
 		Dur("duration_ms", time.Since(startTime)).
 		Msg("Subscription updated successfully")
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sub)
+	w.Header().Set("ETag", versionETag(r, sub.Version))
+	observe.Respond(w, r, http.StatusOK, sub)
+}
+
+// ownedByCaller reports whether the authenticated caller owns sub. Other
+// users' subscriptions are answered with 404 so their IDs cannot be probed.
+// Without authentication every subscription is accessible.
+func ownedByCaller(ctx context.Context, sub models.Subscription) bool {
+	identity, ok := observe.IdentityFromContext(ctx)
+	return !ok || sub.UserID == identity.UserID
+}
+
+// versionETag is the strong ETag of a subscription version in the
+// representation r negotiates, e.g. "3+json". Each representation needs its
+// own strong tag; If-Match only looks at the version.
+func versionETag(r *http.Request, version int) string {
+	return strconv.Quote(strconv.Itoa(version) + "+" + mediaSubtype(observe.NegotiatedContentType(r)))
 }
 
+// etagVersion parses the version out of an If-Match tag from versionETag.
+// Bare versions such as "3" are accepted too.
+func etagVersion(tag string) (int, error) {
+	tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+	version, _, _ := strings.Cut(tag, "+")
+	return strconv.Atoi(version)
+}
+
+// listETag is a weak ETag over the page's IDs and versions, the total and
+// the negotiated representation, so it changes whenever any listed
+// subscription does, the page shifts or the client asks for another format.
+func listETag(r *http.Request, subs []models.Subscription, total int) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s|%d", observe.NegotiatedContentType(r), total)
+	for _, sub := range subs {
+		fmt.Fprintf(hash, "|%s:%d", sub.ID, sub.Version)
+	}
+	return fmt.Sprintf(`W/"%x"`, hash.Sum64())
+}
+
+// mediaSubtype returns the part of contentType after the slash, e.g. "csv".
+func mediaSubtype(contentType string) string {
+	return contentType[strings.LastIndex(contentType, "/")+1:]
+}
+
+// notModified sets the ETag and caching headers for a GET and answers 304
+// when If-None-Match already names etag. Clients may cache but must
+// revalidate, since subscriptions change at any time.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	// Same Vary as the full response from observe.Respond
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches applies If-None-Match's weak comparison: "*" or any listed tag
+// equal to etag once W/ prefixes are ignored.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteSubscription cancels a subscription. With ?refund=true the payment
+// that confirmed it is refunded first, and a failed refund leaves the
+// subscription in place so the client can retry.
 func (h *V3Handler) deleteSubscription(w http.ResponseWriter, r *http.Request, id string) {
 	startTime := time.Now()
+	ctx := r.Context()
+	logger := observe.SampledLevel(ctx, observe.LogWithTrace(ctx, h.deps.Logger))
+
+	refund := false
+	if raw := r.URL.Query().Get("refund"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			observe.WriteError(w, r, http.StatusBadRequest, "INVALID_REFUND_PARAM", "refund must be true or false")
+			return
+		}
+		refund = parsed
+	}
 
-	h.deps.Logger.Debug().
-		Str("version", "v3").
-		Str("method", "DELETE").
-		Str("path", "/v3/subscriptions/{id}").
-		Str("subscription_id", id).
-		Str("client_ip", r.RemoteAddr).
-		Msg("Processing delete subscription request")
-
-	sub, exists := h.deps.Repository.Delete(id)
-	if !exists {
-		h.deps.Logger.Warn().
+	sub, exists := h.deps.Repository.GetByID(ctx, id)
+	if !exists || !ownedByCaller(ctx, sub) {
+		logger.Warn().
 			Str("version", "v3").
 			Str("method", "DELETE").
 			Str("path", "/v3/subscriptions/{id}").
@@ -345,20 +733,71 @@ func (h *V3Handler) deleteSubscription(w http.ResponseWriter, r *http.Request, i
 			Str("client_ip", r.RemoteAddr).
 			Dur("duration_ms", time.Since(startTime)).
 			Msg("Subscription not found for deletion")
-		http.Error(w, "Not found", http.StatusNotFound)
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
 		return
 	}
 
-	h.deps.MetricsV3.SubscriptionsActive.Dec()
+	var refunded *models.RefundResponse
+	deleted := false
+	cancelErr := h.deps.TracingV3.TraceOperation(ctx, "cancel_subscription", "business", map[string]interface{}{
+		"subscription_id": sub.ID,
+		"plan":            sub.Plan,
+		"refund":          refund,
+	}, func(ctx context.Context) error {
+		// Subscriptions created without a payment, such as batch imports,
+		// have nothing to refund
+		if refund && sub.PaymentID != "" {
+			resp, err := h.deps.PaymentService.Refund(ctx, models.RefundRequest{
+				PaymentID: sub.PaymentID,
+				Amount:    sub.AmountPaid,
+				Reason:    models.RefundReasonCancellation,
+			})
+			if err != nil {
+				return err
+			}
+			refunded = resp
+		}
+
+		sub, deleted = h.deps.Repository.Delete(ctx, id)
+		return nil
+	})
 
-	if h.deps.Repository.Count() < 10 {
-		h.deps.Logger.Warn().
+	if cancelErr != nil {
+		status, failureType, _ := paymentFailureResponse(cancelErr)
+		logger.Error().
+			Err(cancelErr).
 			Str("version", "v3").
-			Int("subscriptions_count", h.deps.Repository.Count()).
+			Str("method", "DELETE").
+			Str("path", "/v3/subscriptions/{id}").
+			Str("subscription_id", id).
+			Str("payment_id", sub.PaymentID).
+			Str("error_type", "refund_error").
+			Str("failure_type", failureType).
+			Str("client_ip", r.RemoteAddr).
+			Dur("duration_ms", time.Since(startTime)).
+			Msg("Refund failed, subscription kept")
+		observe.WriteErrorDetail(w, r, status, observe.ErrorDetail{Code: "REFUND_FAILED", Message: "Refund failed", Type: failureType})
+		return
+	}
+
+	if !deleted {
+		// Deleted by a concurrent request between the lookup and Delete
+		observe.WriteError(w, r, http.StatusNotFound, "NOT_FOUND", "Subscription not found")
+		return
+	}
+
+	if h.deps.Metrics != nil {
+		h.deps.Metrics.UnsubscribesByPlan.WithLabelValues(sub.Plan).Inc()
+	}
+
+	if h.deps.Repository.Count(ctx) < 10 {
+		logger.Warn().
+			Str("version", "v3").
+			Int("subscriptions_count", h.deps.Repository.Count(ctx)).
 			Msg("Subscription count is getting low")
 	}
 
-	h.deps.Logger.Info().
+	event := logger.Info().
 		Str("version", "v3").
 		Str("method", "DELETE").
 		Str("path", "/v3/subscriptions/{id}").
@@ -366,15 +805,72 @@ func (h *V3Handler) deleteSubscription(w http.ResponseWriter, r *http.Request, i
 		Str("user_id", sub.UserID).
 		Str("plan", sub.Plan).
 		Str("client_ip", r.RemoteAddr).
-		Dur("duration_ms", time.Since(startTime)).
-		Msg("Subscription deleted successfully")
+		Dur("duration_ms", time.Since(startTime))
+	if refunded != nil {
+		event = event.
+			Str("refund_id", refunded.ID).
+			Float64("refund_amount", refunded.Amount)
+	}
+	event.Msg("Subscription deleted successfully")
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func RegisterV3Routes(deps *Dependencies) {
+func RegisterV3Routes(mux *http.ServeMux, deps *Dependencies) {
 	handler := NewV3Handler(deps)
 
-	http.HandleFunc("/v3/subscriptions", deps.TracingV3.InstrumentHandler(observe.InstrumentHandlerV3(handler.HandleSubscriptions, deps.MetricsV3)))
-	http.HandleFunc("/v3/subscriptions/", deps.TracingV3.InstrumentHandler(observe.InstrumentHandlerV3(handler.HandleSubscriptionByID, deps.MetricsV3)))
+	// Auth and rate limiting sit inside tracing and metrics so rejected
+	// requests are still traced and counted
+	chain := observe.Chain(
+		deps.Recover,
+		deps.TracingV3.InstrumentHandler,
+		observe.RequestIDMiddleware(),
+		deps.AccessLog,
+		observe.MetricsMiddlewareV3(deps.MetricsV3),
+		deps.Auth,
+		deps.RateLimit,
+		deps.Timeout,
+	)
+
+	mux.HandleFunc("/v3/subscriptions", chain(handler.HandleSubscriptions))
+	mux.HandleFunc("/v3/subscriptions/{id}", chain(handler.HandleSubscriptionByID))
+	mux.HandleFunc("/v3/subscriptions:batch", chain(handler.HandleBatch))
+}
+
+// paymentFailureResponse maps a payment error to the status, failure_type
+// label and message returned to the client: declines are the caller's
+// problem (402), while transient failures and an open circuit mean the
+// payment service is unavailable (503). A wrong charge, a rejected request or
+// an error without a type (a 404 from a proxy, say) is the payment
+// service's fault (502), never a decline.
+func paymentFailureResponse(err error) (status int, failureType, message string) {
+	if errors.Is(err, services.ErrCircuitOpen) {
+		return http.StatusServiceUnavailable, "circuit_open", "Payment service unavailable"
+	}
+
+	var mismatch *services.AmountMismatchError
+	if errors.As(err, &mismatch) {
+		return http.StatusBadGateway, "amount_mismatch", "Payment processing failed"
+	}
+
+	var paymentErr *services.PaymentError
+	if !errors.As(err, &paymentErr) {
+		return http.StatusInternalServerError, "payment_service_error", "Payment processing failed"
+	}
+
+	failureType = paymentErr.Type
+	if failureType == "" {
+		failureType = "payment_service_error"
+	}
+
+	switch {
+	case paymentErr.Retryable():
+		return http.StatusServiceUnavailable, failureType, "Payment service unavailable"
+	case paymentErr.Type == "", paymentErr.Type == services.PaymentErrorValidation:
+		return http.StatusBadGateway, failureType, "Payment processing failed"
+	case paymentErr.Message != "":
+		return http.StatusPaymentRequired, failureType, "Payment declined: " + paymentErr.Message
+	default:
+		return http.StatusPaymentRequired, failureType, "Payment declined"
+	}
 }
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"subscription-service/internal/models"
+	"subscription-service/internal/services"
+
+	observe "observability"
+	"observability/billing"
+	"observability/paymentapi"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+func TestEtagMatches(t *testing.T) {
+	jsonReq := httptest.NewRequest(http.MethodGet, "/v3/subscriptions/sub_1", nil)
+	etag := versionETag(jsonReq, 3)
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"3+json"`, true},
+		{`W/"3+json"`, true},
+		{`"2+json", "3+json"`, true},
+		{"*", true},
+		{`"2+json"`, false},
+		{`"33+json"`, false},
+		{`"3+csv"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+
+	// Weak list tags match only the same page in the same format
+	page := []models.Subscription{{ID: "sub_1", Version: 1}}
+	if !etagMatches(listETag(jsonReq, page, 1), listETag(jsonReq, page, 1)) {
+		t.Error("list ETag does not match itself")
+	}
+	if etagMatches(listETag(jsonReq, page, 1), listETag(jsonReq, page, 2)) {
+		t.Error("list ETag matches after the total changed")
+	}
+	csvReq := httptest.NewRequest(http.MethodGet, "/v3/subscriptions", nil)
+	csvReq.Header.Set("Accept", "text/csv")
+	if etagMatches(listETag(jsonReq, page, 1), listETag(csvReq, page, 1)) {
+		t.Error("list ETag matches across representations")
+	}
+}
+
+func TestVersionETagPerRepresentation(t *testing.T) {
+	tags := make(map[string]bool)
+	for _, accept := range []string{"", "application/xml", "text/csv"} {
+		req := httptest.NewRequest(http.MethodGet, "/v3/subscriptions/sub_1", nil)
+		req.Header.Set("Accept", accept)
+		etag := versionETag(req, 3)
+		if tags[etag] {
+			t.Errorf("Accept %q: ETag %s is shared with another representation", accept, etag)
+		}
+		tags[etag] = true
+
+		// Any representation's tag works for If-Match
+		if version, err := etagVersion(etag); err != nil || version != 3 {
+			t.Errorf("etagVersion(%s) = %d, %v; want 3", etag, version, err)
+		}
+	}
+
+	if version, err := etagVersion(`"7"`); err != nil || version != 7 {
+		t.Errorf("bare version: etagVersion = %d, %v; want 7", version, err)
+	}
+	if _, err := etagVersion(`"abc+json"`); err == nil {
+		t.Error("etagVersion accepted a tag without a version")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	etag := versionETag(httptest.NewRequest(http.MethodGet, "/v3/subscriptions/sub_1", nil), 3)
+
+	t.Run("matching", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v3/subscriptions/sub_1", nil)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+
+		if !notModified(rec, req, etag) {
+			t.Fatal("notModified() = false, want true")
+		}
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusNotModified)
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("body = %q, want empty", rec.Body.String())
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("ETag = %q, want %q", got, etag)
+		}
+	})
+
+	t.Run("not matching", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v3/subscriptions/sub_1", nil)
+		req.Header.Set("If-None-Match", `"2+json"`)
+		rec := httptest.NewRecorder()
+
+		if notModified(rec, req, etag) {
+			t.Fatal("notModified() = true, want false")
+		}
+		// The caller still writes the full response, carrying the new ETag
+		if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+			t.Errorf("response written: %d %q", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("ETag = %q, want %q", got, etag)
+		}
+	})
+}
+
+func TestPaymentFailureResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"decline", &services.PaymentError{StatusCode: http.StatusPaymentRequired, Type: "card_declined"}, http.StatusPaymentRequired},
+		{"untyped not found", &services.PaymentError{StatusCode: http.StatusNotFound}, http.StatusBadGateway},
+		{"untyped server error", &services.PaymentError{StatusCode: http.StatusBadGateway}, http.StatusServiceUnavailable},
+		{"validation", &services.PaymentError{StatusCode: http.StatusBadRequest, Type: services.PaymentErrorValidation}, http.StatusBadGateway},
+		{"circuit open", services.ErrCircuitOpen, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		if status, _, _ := paymentFailureResponse(tt.err); status != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, status, tt.want)
+		}
+	}
+}
+
+func TestCreateRecordsPlanRevenueInCents(t *testing.T) {
+	// 19.99 * 100 is not 1999 in floating point
+	plans, err := billing.NewPlanRegistry([]billing.Plan{{Name: "odd", PriceCents: 1999}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != paymentapi.ProcessPath {
+			http.NotFound(w, r)
+			return
+		}
+		var req models.PaymentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(models.PaymentResponse{ID: "pay_1", Status: "completed", Amount: req.Amount})
+	}))
+	defer payments.Close()
+
+	registry := prometheus.NewRegistry()
+	h := NewV3Handler(&Dependencies{
+		Logger:         zerolog.Nop(),
+		Repository:     services.NewInMemoryRepository(),
+		Plans:          plans,
+		PaymentService: services.NewPaymentService(payments.URL, services.WithHTTPClient(payments.Client())),
+		MetricsV3:      observe.NewMetricsV3("revenue_test", registry),
+		TracingV3:      observe.NewTracingV3Noop(),
+	})
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v3/subscriptions", strings.NewReader(`{"user_id":"alice","plan":"odd"}`))
+		h.HandleSubscriptions(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create: status = %d, body %s", rec.Code, rec.Body)
+		}
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revenue float64
+	for _, family := range families {
+		if family.GetName() == "revenue_test_v3_subscription_revenue_total" {
+			for _, metric := range family.GetMetric() {
+				revenue += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	if revenue != 3*1999 {
+		t.Errorf("revenue = %v cents, want %d", revenue, 3*1999)
+	}
+}
@@ -2,12 +2,25 @@ package models
 
 import "time"
 
+// Subscription statuses. Pending subscriptions await payment and are hidden
+// from reads until confirmed.
+const (
+	StatusPending = "pending"
+	StatusActive  = "active"
+)
+
 type Subscription struct {
-	ID        string    `json:"id"`
-	UserID    string    `json:"user_id"`
-	Plan      string    `json:"plan"`
-	StartDate time.Time `json:"start_date"`
-	EndDate   time.Time `json:"end_date"`
+	ID        string    `json:"id" xml:"id"`
+	UserID    string    `json:"user_id" xml:"user_id"`
+	Plan      string    `json:"plan" xml:"plan"`
+	StartDate time.Time `json:"start_date" xml:"start_date"`
+	EndDate   time.Time `json:"end_date" xml:"end_date"`
+	Status    string    `json:"status" xml:"status"`
+	// Version increases on every update, for optimistic concurrency
+	Version int `json:"version" xml:"version"`
+	// The payment that confirmed the subscription, if one was taken
+	PaymentID  string  `json:"payment_id,omitempty" xml:"payment_id,omitempty"`
+	AmountPaid float64 `json:"amount_paid,omitempty" xml:"amount_paid,omitempty"`
 }
 
 type PaymentRequest struct {
@@ -16,23 +29,34 @@ type PaymentRequest struct {
 	Plan           string  `json:"plan"`
 }
 
-type PaymentResponse struct {
-	ID      string `json:"id"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
+// RefundReasonCancellation is the payment service's refund reason for a
+// cancelled subscription.
+const RefundReasonCancellation = "cancellation"
+
+type RefundRequest struct {
+	PaymentID string  `json:"payment_id"`
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason,omitempty"`
 }
 
-func GetPlanPrice(plan string) float64 {
-	switch plan {
-	case "basic":
-		return 10.0
-	case "premium":
-		return 20.0
-	default:
-		return 0.0
-	}
+// RefundResponse mirrors the payment service's refund response body.
+type RefundResponse struct {
+	ID            string    `json:"id"`
+	PaymentID     string    `json:"payment_id"`
+	Status        string    `json:"status"`
+	Amount        float64   `json:"amount"`
+	TotalRefunded float64   `json:"total_refunded"`
+	Reason        string    `json:"reason"`
+	ProcessedAt   time.Time `json:"processed_at"`
 }
 
-func IsValidPlan(plan string) bool {
-	return plan == "basic" || plan == "premium"
+// PaymentResponse mirrors the payment service's response body; keep the two
+// in step so decoding does not drop fields.
+type PaymentResponse struct {
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	Amount      float64   `json:"amount"`
+	Currency    string    `json:"currency"`
+	ProcessedAt time.Time `json:"processed_at"`
+	Fees        float64   `json:"fees,omitempty"`
 }
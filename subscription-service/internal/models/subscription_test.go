@@ -0,0 +1,59 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// paymentServiceResponse is a /process response body as the payment service
+// encodes its PaymentResponse.
+const paymentServiceResponse = `{
+	"id": "pmt_1760617440000000000_42",
+	"status": "completed",
+	"amount": 20,
+	"currency": "USD",
+	"processed_at": "2026-10-16T12:24:00.123456789Z",
+	"fees": 0.5
+}`
+
+func TestPaymentResponseMatchesPaymentService(t *testing.T) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(paymentServiceResponse)))
+	// An unknown field means the mirror has fallen behind
+	decoder.DisallowUnknownFields()
+
+	var resp PaymentResponse
+	if err := decoder.Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	want := PaymentResponse{
+		ID:          "pmt_1760617440000000000_42",
+		Status:      "completed",
+		Amount:      20,
+		Currency:    "USD",
+		ProcessedAt: time.Date(2026, 10, 16, 12, 24, 0, 123456789, time.UTC),
+		Fees:        0.5,
+	}
+	if !resp.ProcessedAt.Equal(want.ProcessedAt) {
+		t.Errorf("ProcessedAt = %v, want %v", resp.ProcessedAt, want.ProcessedAt)
+	}
+	resp.ProcessedAt = want.ProcessedAt
+	if resp != want {
+		t.Errorf("decoded %+v, want %+v", resp, want)
+	}
+
+	// Re-encoding gives back the same document
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var original, roundTrip map[string]interface{}
+	json.Unmarshal([]byte(paymentServiceResponse), &original)
+	json.Unmarshal(encoded, &roundTrip)
+	if !reflect.DeepEqual(original, roundTrip) {
+		t.Errorf("round trip = %v, want %v", roundTrip, original)
+	}
+}
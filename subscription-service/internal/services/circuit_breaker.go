@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrCircuitOpen is returned without calling the payment service while the
+// breaker is open.
+var ErrCircuitOpen = errors.New("payment service circuit breaker is open")
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitHalfOpen
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half_open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultFailureThreshold = 5
+	defaultCoolDown         = 30 * time.Second
+)
+
+type CircuitBreakerConfig struct {
+	// FailureThreshold consecutive failures open the breaker. Defaults to 5.
+	FailureThreshold int
+	// CoolDown is how long the breaker stays open before letting a single
+	// probe request through. Defaults to 30s.
+	CoolDown time.Duration
+	// StateGauge, when set, tracks the current CircuitState.
+	StateGauge prometheus.Gauge
+}
+
+// CircuitBreaker fails fast once the payment service keeps failing. Closed,
+// every call goes through; after FailureThreshold consecutive failures it
+// opens and rejects calls for CoolDown; then it is half-open and admits one
+// probe, closing again if the probe succeeds and reopening if it fails.
+type CircuitBreaker struct {
+	threshold int
+	coolDown  time.Duration
+	gauge     prometheus.Gauge
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewCircuitBreaker(cfg CircuitBreakerConfig) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		threshold: cfg.FailureThreshold,
+		coolDown:  cfg.CoolDown,
+		gauge:     cfg.StateGauge,
+	}
+	if cb.threshold <= 0 {
+		cb.threshold = defaultFailureThreshold
+	}
+	if cb.coolDown <= 0 {
+		cb.coolDown = defaultCoolDown
+	}
+	if cb.gauge != nil {
+		cb.gauge.Set(float64(CircuitClosed))
+	}
+
+	return cb
+}
+
+// State returns the current state, moving from open to half-open once the
+// cool-down has passed.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.coolDown {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// Allow reports whether a call may proceed, returning ErrCircuitOpen if not.
+// Every allowed call must be followed by Record or Release.
+func (cb *CircuitBreaker) Allow(ctx context.Context) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.coolDown {
+			return ErrCircuitOpen
+		}
+		cb.transition(ctx, CircuitHalfOpen)
+		cb.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the outcome of a call admitted by Allow.
+func (cb *CircuitBreaker) Record(ctx context.Context, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.probing = false
+		if success {
+			cb.failures = 0
+			cb.transition(ctx, CircuitClosed)
+		} else {
+			cb.open(ctx)
+		}
+		return
+	}
+
+	if success {
+		cb.failures = 0
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitClosed && cb.failures >= cb.threshold {
+		cb.open(ctx)
+	}
+}
+
+// Release ends a call admitted by Allow without an outcome, such as one the
+// caller cancelled. A half-open breaker then admits the next probe.
+func (cb *CircuitBreaker) Release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.probing = false
+	}
+}
+
+func (cb *CircuitBreaker) open(ctx context.Context) {
+	cb.openedAt = time.Now()
+	cb.transition(ctx, CircuitOpen)
+}
+
+// transition must be called with mu held.
+func (cb *CircuitBreaker) transition(ctx context.Context, to CircuitState) {
+	from := cb.state
+	if from == to {
+		return
+	}
+	cb.state = to
+
+	if cb.gauge != nil {
+		cb.gauge.Set(float64(to))
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("circuit_breaker.state_change", trace.WithAttributes(
+		attribute.String("circuit_breaker.from", from.String()),
+		attribute.String("circuit_breaker.to", to.String()),
+		attribute.Int("circuit_breaker.failures", cb.failures),
+	))
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+
+	defaultPaymentProbeTTL     = 10 * time.Second
+	defaultPaymentProbeTimeout = 2 * time.Second
+)
+
+// DependencyCheck is the outcome of probing one dependency.
+type DependencyCheck struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+}
+
+// CheckResult is healthy only when every check is, and unhealthy when any
+// check is.
+type CheckResult struct {
+	Status string            `json:"status"`
+	Checks []DependencyCheck `json:"checks"`
+}
+
+func (r CheckResult) Healthy() bool {
+	return r.Status == HealthStatusHealthy
+}
+
+// HealthChecker reports whether the service is ready for traffic. The
+// payment probe result is cached for probeTTL so frequent readiness
+// polls do not turn into a stream of calls to the payment service.
+type HealthChecker struct {
+	repository   Repository
+	payment      *PaymentService
+	queue        *PaymentQueue
+	probeTTL     time.Duration
+	probeTimeout time.Duration
+
+	mu            sync.Mutex
+	paymentCheck  DependencyCheck
+	paymentProbed time.Time
+}
+
+// NewHealthChecker returns a checker for repository and payment. With a
+// queue, an unreachable payment service only degrades readiness, since
+// creates are still accepted and queued. probeTTL defaults to 10s.
+func NewHealthChecker(repository Repository, payment *PaymentService, queue *PaymentQueue, probeTTL time.Duration) *HealthChecker {
+	if probeTTL <= 0 {
+		probeTTL = defaultPaymentProbeTTL
+	}
+	return &HealthChecker{
+		repository:   repository,
+		payment:      payment,
+		queue:        queue,
+		probeTTL:     probeTTL,
+		probeTimeout: defaultPaymentProbeTimeout,
+	}
+}
+
+// Readiness checks that the repository is initialized and the payment
+// service is reachable.
+func (h *HealthChecker) Readiness(ctx context.Context) CheckResult {
+	result := CheckResult{
+		Status: HealthStatusHealthy,
+		Checks: []DependencyCheck{
+			runCheck("repository", func() error { return h.checkRepository(ctx) }),
+			h.checkPayment(ctx),
+		},
+	}
+
+	for _, check := range result.Checks {
+		switch check.Status {
+		case HealthStatusUnhealthy:
+			result.Status = HealthStatusUnhealthy
+		case HealthStatusDegraded:
+			if result.Status == HealthStatusHealthy {
+				result.Status = HealthStatusDegraded
+			}
+		}
+	}
+
+	return result
+}
+
+func (h *HealthChecker) checkRepository(ctx context.Context) error {
+	if h.repository == nil {
+		return errors.New("repository not initialized")
+	}
+	h.repository.Count(ctx)
+	return nil
+}
+
+func (h *HealthChecker) checkPayment(ctx context.Context) DependencyCheck {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.paymentProbed.IsZero() || time.Since(h.paymentProbed) >= h.probeTTL {
+		// The ping gets its own deadline: a prober hanging up must not fail
+		// it, and a hung payment service must not hold h.mu for long
+		pingCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), h.probeTimeout)
+		var pingErr error
+		h.paymentCheck = runCheck("payment_service", func() error {
+			pingErr = h.payment.Ping(pingCtx)
+			return pingErr
+		})
+		cancel()
+
+		// A ping that ran out of time is reported but not cached, so the
+		// next probe tries again
+		if errors.Is(pingErr, context.DeadlineExceeded) || errors.Is(pingErr, context.Canceled) {
+			h.paymentProbed = time.Time{}
+		} else {
+			h.paymentProbed = time.Now()
+		}
+	}
+
+	check := h.paymentCheck
+	if check.Status == HealthStatusUnhealthy && h.queue != nil {
+		check.Status = HealthStatusDegraded
+		check.Detail = fmt.Sprintf("%s; %d payments queued", check.Detail, h.queue.Len())
+	}
+	return check
+}
+
+func runCheck(name string, check func() error) DependencyCheck {
+	start := time.Now()
+	err := check()
+
+	result := DependencyCheck{
+		Name:      name,
+		Status:    HealthStatusHealthy,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = HealthStatusUnhealthy
+		result.Detail = err.Error()
+	}
+	return result
+}
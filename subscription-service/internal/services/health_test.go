@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newPingServer(t *testing.T, delay time.Duration) (*PaymentService, *atomic.Int32) {
+	var pings atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return NewPaymentService(server.URL, WithHTTPClient(server.Client())), &pings
+}
+
+func TestReadinessIgnoresCallerCancellation(t *testing.T) {
+	payment, pings := newPingServer(t, 0)
+	health := NewHealthChecker(NewInMemoryRepository(), payment, nil, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := health.Readiness(ctx); !result.Healthy() {
+		t.Fatalf("readiness with a cancelled caller = %+v, want healthy", result)
+	}
+
+	if result := health.Readiness(context.Background()); !result.Healthy() {
+		t.Errorf("cached readiness = %+v, want healthy", result)
+	}
+	if got := pings.Load(); got != 1 {
+		t.Errorf("payment service pinged %d times, want 1 within the probe TTL", got)
+	}
+}
+
+func TestReadinessDoesNotCachePingTimeout(t *testing.T) {
+	payment, pings := newPingServer(t, time.Second)
+	health := NewHealthChecker(NewInMemoryRepository(), payment, nil, time.Minute)
+	health.probeTimeout = 20 * time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		if result := health.Readiness(context.Background()); result.Status != HealthStatusUnhealthy {
+			t.Errorf("readiness = %+v, want unhealthy after a ping timeout", result)
+		}
+	}
+	if got := pings.Load(); got != 2 {
+		t.Errorf("payment service pinged %d times, want 2 since timeouts are not cached", got)
+	}
+}
@@ -4,53 +4,291 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand"
 	"net/http"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"subscription-service/internal/models"
 
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	observe "observability"
+	"observability/paymentapi"
+)
+
+const (
+	defaultMaxRetries     = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 2 * time.Second
 )
 
 type PaymentService struct {
-	baseURL string
-	client  *http.Client
+	baseURL        string
+	client         *http.Client
+	maxRetries     int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	breaker        *CircuitBreaker
+	tracing        *observe.TracingV3
+}
+
+// Option configures a PaymentService.
+type Option func(*PaymentService)
+
+// WithMaxRetries sets how many times a failed request is retried. Zero
+// disables retries.
+func WithMaxRetries(n int) Option {
+	return func(p *PaymentService) {
+		p.maxRetries = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the cap the
+// doubling delay is clamped to.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(p *PaymentService) {
+		p.initialBackoff = initial
+		p.maxBackoff = max
+	}
+}
+
+// WithCircuitBreaker guards every request with cb.
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return func(p *PaymentService) {
+		p.breaker = cb
+	}
+}
+
+// WithTracing traces the default client's requests with tracing's provider
+// and propagator instead of the global ones. WithHTTPClient overrides it.
+func WithTracing(tracing *observe.TracingV3) Option {
+	return func(p *PaymentService) {
+		p.tracing = tracing
+	}
+}
+
+// WithHTTPClient replaces the default traced client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *PaymentService) {
+		p.client = client
+	}
+}
+
+func NewPaymentService(baseURL string, opts ...Option) *PaymentService {
+	p := &PaymentService{
+		baseURL:        baseURL,
+		maxRetries:     defaultMaxRetries,
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.client == nil {
+		var transportOpts []observe.TransportOption
+		if p.tracing != nil {
+			transportOpts = append(transportOpts, observe.WithTracingV3(p.tracing))
+		}
+		p.client = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: observe.NewTracedTransport(nil, transportOpts...),
+		}
+	}
+
+	return p
+}
+
+// Error types reported by the payment service that a retry may resolve
+const (
+	PaymentErrorProcessing = "processing_error"
+	PaymentErrorNetwork    = "network_error"
+	PaymentErrorTimeout    = "timeout"
+)
+
+// PaymentErrorValidation is the error type of a request the payment service
+// rejected as malformed; retrying it cannot help.
+const PaymentErrorValidation = "validation_error"
+
+// PaymentError is a non-200 answer from the payment service, decoded from its
+// {"error":{"code","message","type"}} body when present.
+type PaymentError struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Type       string `json:"type"`
+}
+
+func (e *PaymentError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("payment failed with status: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("payment failed with status %d [%s]: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Retryable reports whether the failure is transient, as opposed to a
+// decline such as insufficient_funds that will fail the same way again.
+func (e *PaymentError) Retryable() bool {
+	switch e.Type {
+	case PaymentErrorProcessing, PaymentErrorNetwork, PaymentErrorTimeout:
+		return true
+	case "":
+		return e.StatusCode >= http.StatusInternalServerError
+	default:
+		return false
+	}
+}
+
+// AmountMismatchError means the payment service charged a different amount
+// than was requested, which points at a fee or currency bug on either side.
+type AmountMismatchError struct {
+	Requested float64
+	Charged   float64
+}
+
+func (e *AmountMismatchError) Error() string {
+	return fmt.Sprintf("payment charged %.2f, expected %.2f", e.Charged, e.Requested)
 }
 
-func NewPaymentService(baseURL string) *PaymentService {
-	return &PaymentService{
-		baseURL: baseURL,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+// VerifyPaymentAmount checks that resp charged requested. Amounts within half
+// a cent match, since the payment service rounds to the currency's minor unit.
+func VerifyPaymentAmount(resp *models.PaymentResponse, requested float64) error {
+	if math.Abs(resp.Amount-requested) >= 0.005 {
+		return &AmountMismatchError{Requested: requested, Charged: resp.Amount}
 	}
+	return nil
 }
 
+func decodePaymentError(resp *http.Response) *PaymentError {
+	var body struct {
+		Error PaymentError `json:"error"`
+	}
+	paymentErr := &PaymentError{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		paymentErr = &body.Error
+	}
+	paymentErr.StatusCode = resp.StatusCode
+	return paymentErr
+}
+
+// retryableError marks failures worth another attempt: 5xx responses,
+// timeouts and connection errors.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// IsPaymentUnavailable reports whether err means the payment service could
+// not be reached or kept failing, rather than that it declined the payment.
+// Such payments can be queued and tried again later.
+func IsPaymentUnavailable(err error) bool {
+	var retryable *retryableError
+	return errors.Is(err, ErrCircuitOpen) || errors.As(err, &retryable)
+}
+
+// ProcessPayment charges a subscription, retrying transient failures with
+// exponential backoff and jitter. Every attempt carries the same
+// Idempotency-Key so the processor can return the original result instead of
+// charging twice.
 func (p *PaymentService) ProcessPayment(ctx context.Context, req models.PaymentRequest) (*models.PaymentResponse, error) {
 	paymentData, err := json.Marshal(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal payment request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/payments", bytes.NewBuffer(paymentData))
+	span := trace.SpanFromContext(ctx)
+	idempotencyKey := "sub-" + req.SubscriptionID
+
+	for attempt := 0; ; attempt++ {
+		resp, err := p.send(ctx, paymentData, idempotencyKey)
+		if err == nil {
+			return resp, nil
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || attempt >= p.maxRetries {
+			return nil, err
+		}
+
+		delay := p.backoff(attempt)
+		span.AddEvent("payment.retry", trace.WithAttributes(
+			attribute.Int("retry.attempt", attempt+1),
+			attribute.Int64("retry.delay_ms", delay.Milliseconds()),
+			attribute.String("error", err.Error()),
+		))
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("payment retry aborted: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send makes a single attempt, through the circuit breaker when one is set.
+func (p *PaymentService) send(ctx context.Context, paymentData []byte, idempotencyKey string) (*models.PaymentResponse, error) {
+	if p.breaker == nil {
+		return p.do(ctx, paymentData, idempotencyKey)
+	}
+
+	if err := p.breaker.Allow(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := p.do(ctx, paymentData, idempotencyKey)
+	p.recordOutcome(ctx, err)
+
+	return resp, err
+}
+
+// recordOutcome reports a call admitted by the breaker. Only transient
+// failures and deadlines count against it. A call the caller cancelled says
+// nothing about the payment service, so it just releases its slot.
+func (p *PaymentService) recordOutcome(ctx context.Context, err error) {
+	if errors.Is(err, context.Canceled) {
+		p.breaker.Release()
+		return
+	}
+
+	var retryable *retryableError
+	failed := errors.As(err, &retryable) || errors.Is(err, context.DeadlineExceeded)
+	p.breaker.Record(ctx, !failed)
+}
+
+func (p *PaymentService) do(ctx context.Context, paymentData []byte, idempotencyKey string) (*models.PaymentResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+paymentapi.ProcessPath, bytes.NewReader(paymentData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create payment request: %w", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpReq.Header))
+	httpReq.Header.Set("Idempotency-Key", idempotencyKey)
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send payment request: %w", err)
+		err = fmt.Errorf("failed to send payment request: %w", err)
+		// Transport failures are connection errors or client timeouts unless
+		// the caller gave up.
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &retryableError{err: err}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("payment failed with status: %d", resp.StatusCode)
+		paymentErr := decodePaymentError(resp)
+		if paymentErr.Retryable() {
+			return nil, &retryableError{err: paymentErr}
+		}
+		return nil, paymentErr
 	}
 
 	var paymentResp models.PaymentResponse
@@ -60,3 +298,94 @@ func (p *PaymentService) ProcessPayment(ctx context.Context, req models.PaymentR
 
 	return &paymentResp, nil
 }
+
+// Refund returns money from a completed payment. The payment service does not
+// deduplicate refunds, so unlike ProcessPayment it makes a single attempt;
+// it still goes through the circuit breaker when one is set.
+func (p *PaymentService) Refund(ctx context.Context, req models.RefundRequest) (*models.RefundResponse, error) {
+	refundData, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal refund request: %w", err)
+	}
+
+	if p.breaker != nil {
+		if err := p.breaker.Allow(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := p.doRefund(ctx, refundData)
+
+	if p.breaker != nil {
+		p.recordOutcome(ctx, err)
+	}
+
+	return resp, err
+}
+
+func (p *PaymentService) doRefund(ctx context.Context, refundData []byte) (*models.RefundResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+paymentapi.RefundPath, bytes.NewReader(refundData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		err = fmt.Errorf("failed to send refund request: %w", err)
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, &retryableError{err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		paymentErr := decodePaymentError(resp)
+		if paymentErr.Retryable() {
+			return nil, &retryableError{err: paymentErr}
+		}
+		return nil, paymentErr
+	}
+
+	var refundResp models.RefundResponse
+	if err := json.NewDecoder(resp.Body).Decode(&refundResp); err != nil {
+		return nil, fmt.Errorf("failed to decode refund response: %w", err)
+	}
+
+	return &refundResp, nil
+}
+
+// Ping checks that the payment service is up by calling its liveness
+// endpoint. It bypasses the circuit breaker and is never retried, so probes
+// neither trip the breaker nor wait out its cool-down.
+func (p *PaymentService) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/healthz", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create ping request: %w", err)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("payment service unreachable: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// backoff returns the full-jitter delay before retry number attempt+1.
+func (p *PaymentService) backoff(attempt int) time.Duration {
+	delay := p.initialBackoff << attempt
+	if delay <= 0 || delay > p.maxBackoff {
+		delay = p.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
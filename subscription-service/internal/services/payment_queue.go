@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"subscription-service/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultPaymentRetryInterval = 15 * time.Second
+	queuedPaymentTimeout        = 30 * time.Second
+)
+
+type PaymentQueueConfig struct {
+	Payment    *PaymentService
+	Repository Repository
+	Logger     zerolog.Logger
+	// DepthGauge, when set, tracks how many payments are waiting.
+	DepthGauge prometheus.Gauge
+}
+
+// PaymentQueue holds payments for subscriptions that were accepted as
+// pending while the payment service was unavailable. A background worker
+// charges them once it is back, then confirms or aborts each subscription.
+// The queue lives in memory, so queued payments are lost on restart and
+// their subscriptions stay pending.
+type PaymentQueue struct {
+	payment    *PaymentService
+	repository Repository
+	logger     zerolog.Logger
+	depth      prometheus.Gauge
+
+	mu      sync.Mutex
+	pending []models.PaymentRequest
+}
+
+func NewPaymentQueue(cfg PaymentQueueConfig) *PaymentQueue {
+	return &PaymentQueue{
+		payment:    cfg.Payment,
+		repository: cfg.Repository,
+		logger:     cfg.Logger,
+		depth:      cfg.DepthGauge,
+	}
+}
+
+func (q *PaymentQueue) Enqueue(req models.PaymentRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(q.pending, req)
+	q.setDepth()
+}
+
+func (q *PaymentQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Start retries queued payments every interval in a background goroutine
+// until ctx is cancelled. Each round pings the payment service first, so
+// while it is still down a round costs one request rather than one per
+// queued payment. interval defaults to 15s.
+func (q *PaymentQueue) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPaymentRetryInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if q.Len() == 0 {
+					continue
+				}
+				if err := q.payment.Ping(ctx); err != nil {
+					q.logger.Debug().Err(err).Int("queued", q.Len()).Msg("Payment service still unavailable")
+					continue
+				}
+				q.drain(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// drain charges the queued payments in order, putting them back as soon as
+// the payment service becomes unavailable again.
+func (q *PaymentQueue) drain(ctx context.Context) {
+	q.mu.Lock()
+	batch := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	for i, req := range batch {
+		payCtx, cancel := context.WithTimeout(ctx, queuedPaymentTimeout)
+		resp, err := q.payment.ProcessPayment(payCtx, req)
+		cancel()
+		if err == nil {
+			err = VerifyPaymentAmount(resp, req.Amount)
+		}
+
+		if err != nil && (IsPaymentUnavailable(err) || ctx.Err() != nil) {
+			q.requeue(batch[i:])
+			q.logger.Warn().Err(err).Int("queued", len(batch)-i).Msg("Payment service unavailable again, keeping payments queued")
+			return
+		}
+
+		if err != nil {
+			q.repository.Abort(ctx, req.SubscriptionID)
+			q.logger.Warn().
+				Err(err).
+				Str("subscription_id", req.SubscriptionID).
+				Str("plan", req.Plan).
+				Msg("Queued payment failed, subscription discarded")
+			continue
+		}
+
+		if _, ok := q.repository.Confirm(ctx, req.SubscriptionID, *resp); !ok {
+			q.logger.Error().
+				Str("subscription_id", req.SubscriptionID).
+				Msg("Failed to confirm subscription after queued payment")
+			continue
+		}
+		q.logger.Info().
+			Str("subscription_id", req.SubscriptionID).
+			Str("plan", req.Plan).
+			Msg("Queued payment processed, subscription confirmed")
+	}
+
+	q.mu.Lock()
+	q.setDepth()
+	q.mu.Unlock()
+}
+
+func (q *PaymentQueue) requeue(reqs []models.PaymentRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending = append(append([]models.PaymentRequest{}, reqs...), q.pending...)
+	q.setDepth()
+}
+
+// setDepth must be called with q.mu held.
+func (q *PaymentQueue) setDepth() {
+	if q.depth != nil {
+		q.depth.Set(float64(len(q.pending)))
+	}
+}
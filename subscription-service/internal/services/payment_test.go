@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"subscription-service/internal/models"
+
+	"observability/paymentapi"
+)
+
+func TestProcessPaymentDecodesErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        PaymentError
+		unavailable bool
+	}{
+		{
+			name:        "json decline",
+			status:      http.StatusPaymentRequired,
+			contentType: "application/json",
+			body:        `{"error":{"code":"INSUFFICIENT_FUNDS","message":"insufficient funds in account","type":"insufficient_funds"}}`,
+			want: PaymentError{
+				StatusCode: http.StatusPaymentRequired,
+				Code:       "INSUFFICIENT_FUNDS",
+				Message:    "insufficient funds in account",
+				Type:       "insufficient_funds",
+			},
+		},
+		{
+			name:        "json transient",
+			status:      http.StatusServiceUnavailable,
+			contentType: "application/json",
+			body:        `{"error":{"code":"PROCESSING_ERROR","message":"payment processor temporarily unavailable","type":"processing_error"}}`,
+			want: PaymentError{
+				StatusCode: http.StatusServiceUnavailable,
+				Code:       "PROCESSING_ERROR",
+				Message:    "payment processor temporarily unavailable",
+				Type:       PaymentErrorProcessing,
+			},
+			unavailable: true,
+		},
+		{
+			name:        "plain text",
+			status:      http.StatusBadGateway,
+			contentType: "text/plain",
+			body:        "upstream connect error",
+			want:        PaymentError{StatusCode: http.StatusBadGateway},
+			unavailable: true,
+		},
+		{
+			name:   "empty body",
+			status: http.StatusBadRequest,
+			want:   PaymentError{StatusCode: http.StatusBadRequest},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			payments := NewPaymentService(server.URL, WithMaxRetries(0), WithHTTPClient(server.Client()))
+			_, err := payments.ProcessPayment(context.Background(), models.PaymentRequest{
+				SubscriptionID: "sub_1",
+				Amount:         10,
+				Plan:           "basic",
+			})
+
+			var paymentErr *PaymentError
+			if !errors.As(err, &paymentErr) {
+				t.Fatalf("error = %v, want a *PaymentError", err)
+			}
+			if *paymentErr != tt.want {
+				t.Errorf("error = %+v, want %+v", *paymentErr, tt.want)
+			}
+			if got := IsPaymentUnavailable(err); got != tt.unavailable {
+				t.Errorf("IsPaymentUnavailable = %v, want %v", got, tt.unavailable)
+			}
+		})
+	}
+}
+
+func TestPaymentServiceRoutes(t *testing.T) {
+	// Serve only the routes the payment service registers; anything else
+	// gets the mux's plain-text 404
+	mux := http.NewServeMux()
+	mux.HandleFunc(paymentapi.ProcessPath, func(w http.ResponseWriter, r *http.Request) {
+		var req models.PaymentRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(models.PaymentResponse{ID: "pay_1", Status: "completed", Amount: req.Amount})
+	})
+	mux.HandleFunc(paymentapi.RefundPath, func(w http.ResponseWriter, r *http.Request) {
+		var req models.RefundRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(models.RefundResponse{ID: "ref_1", PaymentID: req.PaymentID, Amount: req.Amount})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	payments := NewPaymentService(server.URL, WithMaxRetries(0), WithHTTPClient(server.Client()))
+	resp, err := payments.ProcessPayment(context.Background(), models.PaymentRequest{SubscriptionID: "sub_1", Amount: 10, Plan: "basic"})
+	if err != nil {
+		t.Fatalf("ProcessPayment: %v", err)
+	}
+	if resp.ID != "pay_1" {
+		t.Errorf("payment ID = %q, want pay_1", resp.ID)
+	}
+	if _, err := payments.Refund(context.Background(), models.RefundRequest{PaymentID: "pay_1", Amount: 5}); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+}
+
+func TestCancelledPaymentsDoNotTripBreaker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices the client going away once the body is read
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	breaker := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, CoolDown: 10 * time.Millisecond})
+	payments := NewPaymentService(server.URL,
+		WithMaxRetries(0),
+		WithHTTPClient(server.Client()),
+		WithCircuitBreaker(breaker),
+	)
+	req := models.PaymentRequest{SubscriptionID: "sub_1", Amount: 10, Plan: "basic"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := payments.ProcessPayment(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	if state := breaker.State(); state != CircuitClosed {
+		t.Errorf("state after a cancelled payment = %s, want closed", state)
+	}
+
+	// A deadline is the payment service being slow, so it counts
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := payments.ProcessPayment(ctx, req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if state := breaker.State(); state != CircuitOpen {
+		t.Fatalf("state after a timed-out payment = %s, want open", state)
+	}
+
+	// A cancelled half-open probe must not keep the breaker from probing again
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := payments.ProcessPayment(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("probe error = %v, want context.Canceled", err)
+	}
+	if err := breaker.Allow(context.Background()); err != nil {
+		t.Errorf("Allow after a cancelled probe = %v, want the next probe admitted", err)
+	}
+}
@@ -1,42 +1,279 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"subscription-service/internal/models"
 )
 
-type SubscriptionRepository struct {
+var (
+	ErrNotFound        = errors.New("subscription not found")
+	ErrVersionConflict = errors.New("subscription version conflict")
+	ErrQuotaExceeded   = errors.New("subscription limit per user reached")
+)
+
+// Sort keys accepted by ListOptions.SortBy
+const (
+	SortByStartDate = "start_date"
+	SortByID        = "id"
+	SortByPlan      = "plan"
+)
+
+// CreateInput is one item of a CreateBatch call.
+type CreateInput struct {
+	UserID string `json:"user_id"`
+	Plan   string `json:"plan"`
+}
+
+// ListOptions filters and pages List results. A zero Limit returns every
+// match after Offset; an empty SortBy sorts by start date. An empty Plan or
+// UserID matches every subscription.
+type ListOptions struct {
+	Limit  int
+	Offset int
+	Plan   string
+	UserID string
+	SortBy string
+}
+
+// Repository stores subscriptions. InMemoryRepository keeps them in a map
+// for the demo; BoltRepository persists them across restarts.
+type Repository interface {
+	// Create and CreatePending return ErrQuotaExceeded when the user already
+	// holds MaxPerUser subscriptions, pending ones included.
+	Create(ctx context.Context, userID, plan string) (models.Subscription, error)
+	// CreatePending stores a subscription that stays invisible to every
+	// read until Confirm; Abort discards it.
+	CreatePending(ctx context.Context, userID, plan string) (models.Subscription, error)
+	// CreateBatch stores all items or none, returning ErrQuotaExceeded if
+	// any user would exceed MaxPerUser.
+	CreateBatch(ctx context.Context, items []CreateInput) ([]models.Subscription, error)
+	// Confirm records payment on the subscription; an empty payment ID
+	// confirms it without one.
+	Confirm(ctx context.Context, id string, payment models.PaymentResponse) (models.Subscription, bool)
+	Abort(ctx context.Context, id string) bool
+	GetAll(ctx context.Context) []models.Subscription
+	List(ctx context.Context, opts ListOptions) ([]models.Subscription, int)
+	GetByID(ctx context.Context, id string) (models.Subscription, bool)
+	GetByUserID(ctx context.Context, userID string) []models.Subscription
+	Update(ctx context.Context, id string, userID, plan string) (models.Subscription, bool)
+	UpdateIfVersion(ctx context.Context, id string, expectedVersion int, userID, plan string) (models.Subscription, error)
+	Delete(ctx context.Context, id string) (models.Subscription, bool)
+	Count(ctx context.Context) int
+	// CountByPlan serves metric scrapes, so it takes no request context
+	CountByPlan() map[string]int
+	ExpireSweep(ctx context.Context, now time.Time) []models.Subscription
+	// OnChange registers a listener for created, updated, deleted and
+	// expired subscriptions, called after the change is stored.
+	OnChange(fn func(RepoEvent))
+}
+
+// Snapshotter is implemented by repositories whose state can be saved and
+// reloaded across restarts.
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+type InMemoryRepository struct {
+	// MaxPerUser caps subscriptions per user; zero means unlimited
+	MaxPerUser int
+
+	changeNotifier
+
 	mu            sync.RWMutex
 	subscriptions map[string]models.Subscription
+	pending       map[string]models.Subscription
+	byUser        map[string]map[string]struct{} // user ID -> visible subscription IDs
+	idSeq         uint64
 }
 
-func NewSubscriptionRepository() *SubscriptionRepository {
-	return &SubscriptionRepository{
+func NewInMemoryRepository() *InMemoryRepository {
+	return &InMemoryRepository{
 		subscriptions: make(map[string]models.Subscription),
+		pending:       make(map[string]models.Subscription),
+		byUser:        make(map[string]map[string]struct{}),
 	}
 }
 
-func (r *SubscriptionRepository) Create(userID, plan string) models.Subscription {
+func (r *InMemoryRepository) Create(ctx context.Context, userID, plan string) (models.Subscription, error) {
+	var changed []models.Subscription
+	defer func() { r.emit(EventCreated, changed...) }() // runs after Unlock
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	sub := models.Subscription{
-		ID:        fmt.Sprintf("sub_%d", rand.Int()),
+	if r.quotaReached(userID) {
+		return models.Subscription{}, ErrQuotaExceeded
+	}
+
+	sub := r.newSubscription(userID, plan, models.StatusActive)
+	r.subscriptions[sub.ID] = sub
+	r.indexAdd(sub)
+	changed = append(changed, sub)
+	return sub, nil
+}
+
+// CreateBatch inserts every item under a single write lock.
+func (r *InMemoryRepository) CreateBatch(ctx context.Context, items []CreateInput) ([]models.Subscription, error) {
+	var changed []models.Subscription
+	defer func() { r.emit(EventCreated, changed...) }() // runs after Unlock
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.MaxPerUser > 0 {
+		added := make(map[string]int)
+		for _, item := range items {
+			added[item.UserID]++
+		}
+		for userID, count := range added {
+			if r.userCount(userID)+count > r.MaxPerUser {
+				return nil, ErrQuotaExceeded
+			}
+		}
+	}
+
+	subs := make([]models.Subscription, 0, len(items))
+	for _, item := range items {
+		sub := r.newSubscription(item.UserID, item.Plan, models.StatusActive)
+		r.subscriptions[sub.ID] = sub
+		r.indexAdd(sub)
+		subs = append(subs, sub)
+	}
+
+	changed = subs
+	return subs, nil
+}
+
+func (r *InMemoryRepository) CreatePending(ctx context.Context, userID, plan string) (models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.quotaReached(userID) {
+		return models.Subscription{}, ErrQuotaExceeded
+	}
+
+	sub := r.newSubscription(userID, plan, models.StatusPending)
+	r.pending[sub.ID] = sub
+	return sub, nil
+}
+
+// quotaReached reports whether userID already holds MaxPerUser visible or
+// pending subscriptions. Callers must hold r.mu.
+func (r *InMemoryRepository) quotaReached(userID string) bool {
+	return r.MaxPerUser > 0 && r.userCount(userID) >= r.MaxPerUser
+}
+
+// userCount counts userID's visible and pending subscriptions. Callers must
+// hold r.mu.
+func (r *InMemoryRepository) userCount(userID string) int {
+	count := len(r.byUser[userID])
+	for _, sub := range r.pending {
+		if sub.UserID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// indexAdd and indexRemove keep byUser in step with subscriptions. Callers
+// must hold r.mu.
+func (r *InMemoryRepository) indexAdd(sub models.Subscription) {
+	ids, exists := r.byUser[sub.UserID]
+	if !exists {
+		ids = make(map[string]struct{})
+		r.byUser[sub.UserID] = ids
+	}
+	ids[sub.ID] = struct{}{}
+}
+
+func (r *InMemoryRepository) indexRemove(sub models.Subscription) {
+	ids := r.byUser[sub.UserID]
+	delete(ids, sub.ID)
+	if len(ids) == 0 {
+		delete(r.byUser, sub.UserID)
+	}
+}
+
+// Confirm makes a pending subscription visible.
+func (r *InMemoryRepository) Confirm(ctx context.Context, id string, payment models.PaymentResponse) (models.Subscription, bool) {
+	var changed []models.Subscription
+	defer func() { r.emit(EventCreated, changed...) }() // runs after Unlock
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, exists := r.pending[id]
+	if !exists {
+		return models.Subscription{}, false
+	}
+
+	delete(r.pending, id)
+	sub.Status = models.StatusActive
+	sub.PaymentID = payment.ID
+	sub.AmountPaid = payment.Amount
+	r.subscriptions[id] = sub
+	r.indexAdd(sub)
+	changed = append(changed, sub)
+	return sub, true
+}
+
+// Abort discards a pending subscription.
+func (r *InMemoryRepository) Abort(ctx context.Context, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.pending[id]
+	delete(r.pending, id)
+	return exists
+}
+
+// newSubscription builds a subscription with an ID unused by both visible
+// and pending entries. Callers must hold r.mu.
+func (r *InMemoryRepository) newSubscription(userID, plan, status string) models.Subscription {
+	now := time.Now()
+	id := r.nextID(now)
+	for {
+		_, taken := r.subscriptions[id]
+		_, pending := r.pending[id]
+		if !taken && !pending {
+			break
+		}
+		id = r.nextID(now)
+	}
+
+	return models.Subscription{
+		ID:        id,
 		UserID:    userID,
 		Plan:      plan,
-		StartDate: time.Now(),
-		EndDate:   time.Now().AddDate(1, 0, 0),
+		StartDate: now,
+		EndDate:   now.AddDate(1, 0, 0),
+		Status:    status,
+		Version:   1,
 	}
+}
 
-	r.subscriptions[sub.ID] = sub
-	return sub
+// nextID returns a fresh subscription ID. Callers must hold r.mu.
+func (r *InMemoryRepository) nextID(now time.Time) string {
+	r.idSeq++
+	return subscriptionID(now, r.idSeq)
+}
+
+// subscriptionID returns sub_<unixnano>_<seq>. The sequence makes IDs unique
+// even within one clock tick, and the zero padding keeps them sorting in
+// creation order.
+func subscriptionID(now time.Time, seq uint64) string {
+	return fmt.Sprintf("sub_%019d_%06d", now.UnixNano(), seq%1000000)
 }
 
-func (r *SubscriptionRepository) GetAll() []models.Subscription {
+func (r *InMemoryRepository) GetAll(ctx context.Context) []models.Subscription {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -47,7 +284,61 @@ func (r *SubscriptionRepository) GetAll() []models.Subscription {
 	return subs
 }
 
-func (r *SubscriptionRepository) GetByID(id string) (models.Subscription, bool) {
+// List returns one page of subscriptions matching opts, sorted
+// deterministically (ties broken by ID), along with the total number of
+// matches before paging.
+func (r *InMemoryRepository) List(ctx context.Context, opts ListOptions) ([]models.Subscription, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subs := make([]models.Subscription, 0, len(r.subscriptions))
+	for _, sub := range r.subscriptions {
+		subs = append(subs, sub)
+	}
+	return listSubscriptions(subs, opts)
+}
+
+// listSubscriptions filters, sorts and pages subs in place per opts.
+func listSubscriptions(subs []models.Subscription, opts ListOptions) ([]models.Subscription, int) {
+	if opts.Plan != "" || opts.UserID != "" {
+		filtered := subs[:0]
+		for _, sub := range subs {
+			if (opts.Plan == "" || sub.Plan == opts.Plan) && (opts.UserID == "" || sub.UserID == opts.UserID) {
+				filtered = append(filtered, sub)
+			}
+		}
+		subs = filtered
+	}
+
+	sort.Slice(subs, func(i, j int) bool {
+		a, b := subs[i], subs[j]
+		switch opts.SortBy {
+		case SortByID:
+			return a.ID < b.ID
+		case SortByPlan:
+			if a.Plan != b.Plan {
+				return a.Plan < b.Plan
+			}
+		default:
+			if !a.StartDate.Equal(b.StartDate) {
+				return a.StartDate.Before(b.StartDate)
+			}
+		}
+		return a.ID < b.ID
+	})
+
+	total := len(subs)
+	if opts.Offset >= total {
+		return []models.Subscription{}, total
+	}
+	subs = subs[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(subs) {
+		subs = subs[:opts.Limit]
+	}
+	return subs, total
+}
+
+func (r *InMemoryRepository) GetByID(ctx context.Context, id string) (models.Subscription, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
@@ -55,7 +346,23 @@ func (r *SubscriptionRepository) GetByID(id string) (models.Subscription, bool)
 	return sub, exists
 }
 
-func (r *SubscriptionRepository) Update(id string, userID, plan string) (models.Subscription, bool) {
+// GetByUserID returns the user's visible subscriptions via the byUser index.
+func (r *InMemoryRepository) GetByUserID(ctx context.Context, userID string) []models.Subscription {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subs := make([]models.Subscription, 0, len(r.byUser[userID]))
+	for id := range r.byUser[userID] {
+		subs = append(subs, r.subscriptions[id])
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return subs
+}
+
+func (r *InMemoryRepository) Update(ctx context.Context, id string, userID, plan string) (models.Subscription, bool) {
+	var changed []models.Subscription
+	defer func() { r.emit(EventUpdated, changed...) }() // runs after Unlock
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -64,13 +371,48 @@ func (r *SubscriptionRepository) Update(id string, userID, plan string) (models.
 		return models.Subscription{}, false
 	}
 
+	r.indexRemove(sub)
 	sub.UserID = userID
 	sub.Plan = plan
+	sub.Version++
 	r.subscriptions[id] = sub
+	r.indexAdd(sub)
+	changed = append(changed, sub)
 	return sub, true
 }
 
-func (r *SubscriptionRepository) Delete(id string) (models.Subscription, bool) {
+// UpdateIfVersion applies the update only when the stored version equals
+// expectedVersion, returning ErrVersionConflict otherwise so concurrent
+// writers cannot silently overwrite each other.
+func (r *InMemoryRepository) UpdateIfVersion(ctx context.Context, id string, expectedVersion int, userID, plan string) (models.Subscription, error) {
+	var changed []models.Subscription
+	defer func() { r.emit(EventUpdated, changed...) }() // runs after Unlock
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, exists := r.subscriptions[id]
+	if !exists {
+		return models.Subscription{}, ErrNotFound
+	}
+	if sub.Version != expectedVersion {
+		return sub, ErrVersionConflict
+	}
+
+	r.indexRemove(sub)
+	sub.UserID = userID
+	sub.Plan = plan
+	sub.Version++
+	r.subscriptions[id] = sub
+	r.indexAdd(sub)
+	changed = append(changed, sub)
+	return sub, nil
+}
+
+func (r *InMemoryRepository) Delete(ctx context.Context, id string) (models.Subscription, bool) {
+	var changed []models.Subscription
+	defer func() { r.emit(EventDeleted, changed...) }() // runs after Unlock
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -80,11 +422,100 @@ func (r *SubscriptionRepository) Delete(id string) (models.Subscription, bool) {
 	}
 
 	delete(r.subscriptions, id)
+	r.indexRemove(sub)
+	changed = append(changed, sub)
 	return sub, true
 }
 
-func (r *SubscriptionRepository) Count() int {
+// ExpireSweep removes every subscription whose EndDate is before now and
+// returns the removed entries.
+func (r *InMemoryRepository) ExpireSweep(ctx context.Context, now time.Time) []models.Subscription {
+	var changed []models.Subscription
+	defer func() { r.emit(EventExpired, changed...) }() // runs after Unlock
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, sub := range r.subscriptions {
+		if sub.EndDate.Before(now) {
+			changed = append(changed, sub)
+			delete(r.subscriptions, id)
+			r.indexRemove(sub)
+		}
+	}
+	return changed
+}
+
+// Snapshot serializes the visible subscriptions to JSON. Pending entries are
+// left out: their payment outcome is lost with the process anyway.
+func (r *InMemoryRepository) Snapshot() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subs := make([]models.Subscription, 0, len(r.subscriptions))
+	for _, sub := range r.subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].ID < subs[j].ID })
+	return json.Marshal(subs)
+}
+
+// Restore replaces the repository contents with a Snapshot.
+func (r *InMemoryRepository) Restore(data []byte) error {
+	var subs []models.Subscription
+	if err := json.Unmarshal(data, &subs); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.subscriptions = make(map[string]models.Subscription, len(subs))
+	r.pending = make(map[string]models.Subscription)
+	r.byUser = make(map[string]map[string]struct{})
+	for _, sub := range subs {
+		r.subscriptions[sub.ID] = sub
+		r.indexAdd(sub)
+	}
+	return nil
+}
+
+// StartExpiryLoop runs repo.ExpireSweep every interval in a background
+// goroutine until ctx is cancelled, passing each expired subscription to
+// onExpire.
+func StartExpiryLoop(ctx context.Context, repo Repository, interval time.Duration, onExpire func(models.Subscription)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case now := <-ticker.C:
+				for _, sub := range repo.ExpireSweep(ctx, now) {
+					if onExpire != nil {
+						onExpire(sub)
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (r *InMemoryRepository) Count(ctx context.Context) int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return len(r.subscriptions)
 }
+
+func (r *InMemoryRepository) CountByPlan() map[string]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, sub := range r.subscriptions {
+		counts[sub.Plan]++
+	}
+	return counts
+}
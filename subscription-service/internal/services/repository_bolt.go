@@ -0,0 +1,492 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"subscription-service/internal/models"
+
+	observe "observability"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	subscriptionsBucket = []byte("subscriptions")
+	pendingBucket       = []byte("pending_subscriptions")
+)
+
+// BoltRepository persists subscriptions as JSON in a BoltDB file so they
+// survive restarts. Every query runs inside a TracingV3 database span, which
+// makes the DB tracing helpers visible against a real store. Spans start
+// from the caller's context, so queries join the request's trace.
+type BoltRepository struct {
+	// MaxPerUser caps subscriptions per user; zero means unlimited
+	MaxPerUser int
+
+	changeNotifier
+
+	db     *bolt.DB
+	name   string
+	tracer *observe.TracingV3
+	logger zerolog.Logger
+}
+
+// NewBoltRepository opens (or creates) the database at path. tracer may be
+// nil to disable query spans.
+func NewBoltRepository(path string, tracer *observe.TracingV3, logger zerolog.Logger) (*BoltRepository, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{subscriptionsBucket, pendingBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return &BoltRepository{
+		db:     db,
+		name:   filepath.Base(path),
+		tracer: tracer,
+		logger: logger,
+	}, nil
+}
+
+func (r *BoltRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *BoltRepository) Create(ctx context.Context, userID, plan string) (models.Subscription, error) {
+	sub, err := r.insert(ctx, userID, plan, models.StatusActive)
+	if err == nil {
+		r.emit(EventCreated, sub)
+	}
+	return sub, err
+}
+
+// CreateBatch inserts every item in a single transaction.
+func (r *BoltRepository) CreateBatch(ctx context.Context, items []CreateInput) ([]models.Subscription, error) {
+	now := time.Now()
+	subs := make([]models.Subscription, 0, len(items))
+
+	err := r.updateTx(ctx, "INSERT", func(tx *bolt.Tx) (int, error) {
+		visible, pending := tx.Bucket(subscriptionsBucket), tx.Bucket(pendingBucket)
+
+		if r.MaxPerUser > 0 {
+			counts := make(map[string]int)
+			for _, item := range items {
+				counts[item.UserID]++
+			}
+			for userID, added := range counts {
+				existing, err := userCount(tx, userID)
+				if err != nil {
+					return 0, err
+				}
+				if existing+added > r.MaxPerUser {
+					return 0, ErrQuotaExceeded
+				}
+			}
+		}
+
+		for _, item := range items {
+			sub := models.Subscription{
+				UserID:    item.UserID,
+				Plan:      item.Plan,
+				StartDate: now,
+				EndDate:   now.AddDate(1, 0, 0),
+				Status:    models.StatusActive,
+				Version:   1,
+			}
+			for sub.ID == "" || visible.Get([]byte(sub.ID)) != nil || pending.Get([]byte(sub.ID)) != nil {
+				seq, err := visible.NextSequence()
+				if err != nil {
+					return 0, err
+				}
+				sub.ID = subscriptionID(now, seq)
+			}
+			if err := putSubscription(visible, sub); err != nil {
+				return 0, err
+			}
+			subs = append(subs, sub)
+		}
+		return len(subs), nil
+	})
+	if err != nil {
+		if err != ErrQuotaExceeded {
+			r.logger.Error().Err(err).Int("items", len(items)).Msg("Failed to store subscription batch")
+		}
+		return nil, err
+	}
+
+	r.emit(EventCreated, subs...)
+	return subs, nil
+}
+
+func (r *BoltRepository) CreatePending(ctx context.Context, userID, plan string) (models.Subscription, error) {
+	return r.insert(ctx, userID, plan, models.StatusPending)
+}
+
+// Confirm moves a pending subscription into the visible bucket.
+func (r *BoltRepository) Confirm(ctx context.Context, id string, payment models.PaymentResponse) (models.Subscription, bool) {
+	var sub models.Subscription
+	var exists bool
+	err := r.updateTx(ctx, "UPDATE", func(tx *bolt.Tx) (int, error) {
+		pending := tx.Bucket(pendingBucket)
+		var err error
+		sub, exists, err = getSubscription(pending, id)
+		if err != nil || !exists {
+			return 0, err
+		}
+		if err := pending.Delete([]byte(id)); err != nil {
+			return 0, err
+		}
+		sub.Status = models.StatusActive
+		sub.PaymentID = payment.ID
+		sub.AmountPaid = payment.Amount
+		return 1, putSubscription(tx.Bucket(subscriptionsBucket), sub)
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Str("subscription_id", id).Msg("Failed to confirm subscription")
+		return models.Subscription{}, false
+	}
+	if exists {
+		r.emit(EventCreated, sub)
+	}
+	return sub, exists
+}
+
+// Abort discards a pending subscription.
+func (r *BoltRepository) Abort(ctx context.Context, id string) bool {
+	var exists bool
+	err := r.updateTx(ctx, "DELETE", func(tx *bolt.Tx) (int, error) {
+		pending := tx.Bucket(pendingBucket)
+		exists = pending.Get([]byte(id)) != nil
+		if !exists {
+			return 0, nil
+		}
+		return 1, pending.Delete([]byte(id))
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Str("subscription_id", id).Msg("Failed to abort subscription")
+		return false
+	}
+	return exists
+}
+
+func (r *BoltRepository) insert(ctx context.Context, userID, plan, status string) (models.Subscription, error) {
+	now := time.Now()
+	sub := models.Subscription{
+		UserID:    userID,
+		Plan:      plan,
+		StartDate: now,
+		EndDate:   now.AddDate(1, 0, 0),
+		Status:    status,
+		Version:   1,
+	}
+
+	err := r.updateTx(ctx, "INSERT", func(tx *bolt.Tx) (int, error) {
+		visible, pending := tx.Bucket(subscriptionsBucket), tx.Bucket(pendingBucket)
+
+		if r.MaxPerUser > 0 {
+			count, err := userCount(tx, userID)
+			if err != nil {
+				return 0, err
+			}
+			if count >= r.MaxPerUser {
+				return 0, ErrQuotaExceeded
+			}
+		}
+
+		for sub.ID == "" || visible.Get([]byte(sub.ID)) != nil || pending.Get([]byte(sub.ID)) != nil {
+			seq, err := visible.NextSequence()
+			if err != nil {
+				return 0, err
+			}
+			sub.ID = subscriptionID(now, seq)
+		}
+
+		target := visible
+		if status == models.StatusPending {
+			target = pending
+		}
+		return 1, putSubscription(target, sub)
+	})
+	if err != nil {
+		if err != ErrQuotaExceeded {
+			r.logger.Error().Err(err).Str("user_id", userID).Msg("Failed to store subscription")
+		}
+		return models.Subscription{}, err
+	}
+	return sub, nil
+}
+
+func (r *BoltRepository) GetAll(ctx context.Context) []models.Subscription {
+	var subs []models.Subscription
+	err := r.view(ctx, "SELECT", func(b *bolt.Bucket) (int, error) {
+		var err error
+		subs, err = allSubscriptions(b)
+		return len(subs), err
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Failed to read subscriptions")
+	}
+	if subs == nil {
+		subs = []models.Subscription{}
+	}
+	return subs
+}
+
+func (r *BoltRepository) List(ctx context.Context, opts ListOptions) ([]models.Subscription, int) {
+	return listSubscriptions(r.GetAll(ctx), opts)
+}
+
+func (r *BoltRepository) GetByID(ctx context.Context, id string) (models.Subscription, bool) {
+	var sub models.Subscription
+	var exists bool
+	err := r.view(ctx, "SELECT", func(b *bolt.Bucket) (int, error) {
+		var err error
+		sub, exists, err = getSubscription(b, id)
+		if !exists {
+			return 0, err
+		}
+		return 1, err
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Str("subscription_id", id).Msg("Failed to read subscription")
+		return models.Subscription{}, false
+	}
+	return sub, exists
+}
+
+// GetByUserID scans the bucket; Bolt has no secondary index here.
+func (r *BoltRepository) GetByUserID(ctx context.Context, userID string) []models.Subscription {
+	subs := []models.Subscription{}
+	for _, sub := range r.GetAll(ctx) {
+		if sub.UserID == userID {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+func (r *BoltRepository) Update(ctx context.Context, id string, userID, plan string) (models.Subscription, bool) {
+	sub, err := r.updateSubscription(ctx, id, -1, userID, plan)
+	if err != nil {
+		if err != ErrNotFound {
+			r.logger.Error().Err(err).Str("subscription_id", id).Msg("Failed to update subscription")
+		}
+		return models.Subscription{}, false
+	}
+	return sub, true
+}
+
+func (r *BoltRepository) UpdateIfVersion(ctx context.Context, id string, expectedVersion int, userID, plan string) (models.Subscription, error) {
+	return r.updateSubscription(ctx, id, expectedVersion, userID, plan)
+}
+
+// updateSubscription updates id, checking the version unless expectedVersion
+// is negative.
+func (r *BoltRepository) updateSubscription(ctx context.Context, id string, expectedVersion int, userID, plan string) (models.Subscription, error) {
+	var sub models.Subscription
+	err := r.update(ctx, "UPDATE", func(b *bolt.Bucket) (int, error) {
+		current, exists, err := getSubscription(b, id)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, ErrNotFound
+		}
+		if expectedVersion >= 0 && current.Version != expectedVersion {
+			sub = current
+			return 0, ErrVersionConflict
+		}
+
+		current.UserID = userID
+		current.Plan = plan
+		current.Version++
+		sub = current
+		return 1, putSubscription(b, current)
+	})
+	if err == nil {
+		r.emit(EventUpdated, sub)
+	}
+	return sub, err
+}
+
+func (r *BoltRepository) Delete(ctx context.Context, id string) (models.Subscription, bool) {
+	var sub models.Subscription
+	var exists bool
+	err := r.update(ctx, "DELETE", func(b *bolt.Bucket) (int, error) {
+		var err error
+		sub, exists, err = getSubscription(b, id)
+		if err != nil || !exists {
+			return 0, err
+		}
+		return 1, b.Delete([]byte(id))
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Str("subscription_id", id).Msg("Failed to delete subscription")
+		return models.Subscription{}, false
+	}
+	if exists {
+		r.emit(EventDeleted, sub)
+	}
+	return sub, exists
+}
+
+func (r *BoltRepository) Count(ctx context.Context) int {
+	var count int
+	err := r.view(ctx, "COUNT", func(b *bolt.Bucket) (int, error) {
+		count = b.Stats().KeyN
+		return count, nil
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Failed to count subscriptions")
+	}
+	return count
+}
+
+// CountByPlan serves metric scrapes, which have no request to trace, so its
+// query span is a root.
+func (r *BoltRepository) CountByPlan() map[string]int {
+	counts := make(map[string]int)
+	for _, sub := range r.GetAll(context.Background()) {
+		counts[sub.Plan]++
+	}
+	return counts
+}
+
+func (r *BoltRepository) ExpireSweep(ctx context.Context, now time.Time) []models.Subscription {
+	var expired []models.Subscription
+	err := r.update(ctx, "DELETE", func(b *bolt.Bucket) (int, error) {
+		subs, err := allSubscriptions(b)
+		if err != nil {
+			return 0, err
+		}
+		for _, sub := range subs {
+			if sub.EndDate.Before(now) {
+				if err := b.Delete([]byte(sub.ID)); err != nil {
+					return len(expired), err
+				}
+				expired = append(expired, sub)
+			}
+		}
+		return len(expired), nil
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("Failed to sweep expired subscriptions")
+		return nil
+	}
+	r.emit(EventExpired, expired...)
+	return expired
+}
+
+func (r *BoltRepository) view(ctx context.Context, operation string, fn func(b *bolt.Bucket) (int, error)) error {
+	return r.trace(ctx, operation, func() (int, error) {
+		var rows int
+		err := r.db.View(func(tx *bolt.Tx) error {
+			var err error
+			rows, err = fn(tx.Bucket(subscriptionsBucket))
+			return err
+		})
+		return rows, err
+	})
+}
+
+func (r *BoltRepository) update(ctx context.Context, operation string, fn func(b *bolt.Bucket) (int, error)) error {
+	return r.updateTx(ctx, operation, func(tx *bolt.Tx) (int, error) {
+		return fn(tx.Bucket(subscriptionsBucket))
+	})
+}
+
+// updateTx is update for operations that span both buckets.
+func (r *BoltRepository) updateTx(ctx context.Context, operation string, fn func(tx *bolt.Tx) (int, error)) error {
+	return r.trace(ctx, operation, func() (int, error) {
+		var rows int
+		err := r.db.Update(func(tx *bolt.Tx) error {
+			var err error
+			rows, err = fn(tx)
+			return err
+		})
+		return rows, err
+	})
+}
+
+func (r *BoltRepository) trace(ctx context.Context, operation string, query func() (int, error)) error {
+	if r.tracer == nil {
+		_, err := query()
+		return err
+	}
+
+	return r.tracer.TraceDBOperationV2(ctx, observe.DBSpanConfig{
+		System:    "boltdb",
+		Name:      r.name,
+		Table:     string(subscriptionsBucket),
+		Operation: operation,
+	}, func(context.Context) (int, error) {
+		return query()
+	})
+}
+
+func getSubscription(b *bolt.Bucket, id string) (models.Subscription, bool, error) {
+	var sub models.Subscription
+	data := b.Get([]byte(id))
+	if data == nil {
+		return sub, false, nil
+	}
+	if err := json.Unmarshal(data, &sub); err != nil {
+		return sub, false, err
+	}
+	return sub, true, nil
+}
+
+func putSubscription(b *bolt.Bucket, sub models.Subscription) error {
+	data, err := json.Marshal(sub)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(sub.ID), data)
+}
+
+// userCount counts userID's visible and pending subscriptions.
+func userCount(tx *bolt.Tx, userID string) (int, error) {
+	count := 0
+	for _, name := range [][]byte{subscriptionsBucket, pendingBucket} {
+		subs, err := allSubscriptions(tx.Bucket(name))
+		if err != nil {
+			return 0, err
+		}
+		for _, sub := range subs {
+			if sub.UserID == userID {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func allSubscriptions(b *bolt.Bucket) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := b.ForEach(func(_, data []byte) error {
+		var sub models.Subscription
+		if err := json.Unmarshal(data, &sub); err != nil {
+			return err
+		}
+		subs = append(subs, sub)
+		return nil
+	})
+	return subs, err
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	observe "observability"
+
+	"github.com/rs/zerolog"
+)
+
+// TestBoltQueriesJoinCallerTrace checks that query spans are children of the
+// span in the caller's context rather than roots of their own traces.
+func TestBoltQueriesJoinCallerTrace(t *testing.T) {
+	tracing := observe.NewTracingV3Noop()
+	repo, err := NewBoltRepository(filepath.Join(t.TempDir(), "subs.db"), tracing, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx, parent := tracing.StartSpan(context.Background(), "request")
+	sub, err := repo.Create(ctx, "user_1", "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := repo.GetByID(ctx, sub.ID); !ok {
+		t.Fatal("created subscription not found")
+	}
+	parent.End()
+
+	spans := tracing.RecordedSpans()
+	if len(spans) != 3 {
+		t.Fatalf("recorded %d spans, want 2 queries and the parent", len(spans))
+	}
+	want := parent.SpanContext()
+	for _, span := range spans {
+		if span.Name == "request" {
+			continue
+		}
+		if span.SpanContext.TraceID() != want.TraceID() || span.Parent.SpanID() != want.SpanID() {
+			t.Errorf("span %q is not a child of the request span", span.Name)
+		}
+	}
+}
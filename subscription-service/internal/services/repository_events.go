@@ -0,0 +1,53 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"subscription-service/internal/models"
+)
+
+// Repository event types. Pending subscriptions only produce an event once
+// confirmed, as EventCreated.
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+	EventExpired = "expired"
+)
+
+// RepoEvent describes one change to the visible subscriptions.
+type RepoEvent struct {
+	Type         string
+	Subscription models.Subscription
+	Timestamp    time.Time
+}
+
+// changeNotifier fans repository events out to OnChange listeners. Events
+// are emitted after the repository lock is released, so listeners may read
+// the repository.
+type changeNotifier struct {
+	mu        sync.RWMutex
+	listeners []func(RepoEvent)
+}
+
+// OnChange registers fn to be called after every visible change.
+func (n *changeNotifier) OnChange(fn func(RepoEvent)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.listeners = append(n.listeners, fn)
+}
+
+func (n *changeNotifier) emit(eventType string, subs ...models.Subscription) {
+	n.mu.RLock()
+	listeners := n.listeners
+	n.mu.RUnlock()
+
+	now := time.Now()
+	for _, sub := range subs {
+		evt := RepoEvent{Type: eventType, Subscription: sub, Timestamp: now}
+		for _, fn := range listeners {
+			fn(evt)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestCreateConcurrentIDsUnique(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	const creators, perCreator = 50, 40
+	ids := make(chan string, creators*perCreator)
+	var wg sync.WaitGroup
+	for i := 0; i < creators; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perCreator; j++ {
+				sub, err := repo.Create(ctx, "user_1", "basic")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ids <- sub.ID
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	seen := make(map[string]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate subscription ID %s", id)
+		}
+		seen[id] = true
+	}
+	if got := repo.Count(ctx); got != creators*perCreator {
+		t.Errorf("Count() = %d, want %d", got, creators*perCreator)
+	}
+}
+
+func TestCreateIDsSortInCreationOrder(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+
+	var created []string
+	for i := 0; i < 100; i++ {
+		sub, err := repo.Create(ctx, "user_1", "basic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, sub.ID)
+	}
+
+	if !sort.StringsAreSorted(created) {
+		t.Errorf("IDs do not sort in creation order: %v", created)
+	}
+}
+
+func TestCreateEnforcesMaxPerUser(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+	repo.MaxPerUser = 2
+
+	if _, err := repo.Create(ctx, "user_1", "basic"); err != nil {
+		t.Fatal(err)
+	}
+	// Pending subscriptions count towards the quota
+	if _, err := repo.CreatePending(ctx, "user_1", "premium"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Create(ctx, "user_1", "basic"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("third Create error = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := repo.Create(ctx, "user_2", "basic"); err != nil {
+		t.Errorf("another user's Create error = %v, want nil", err)
+	}
+}
+
+func TestGetByUserIDFollowsUpdateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	repo := NewInMemoryRepository()
+	repo.MaxPerUser = 1
+
+	first, err := repo.Create(ctx, "user_1", "basic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.GetByUserID(ctx, "user_1"); len(got) != 1 || got[0].ID != first.ID {
+		t.Fatalf("GetByUserID(user_1) = %v, want [%s]", got, first.ID)
+	}
+
+	// Moving the subscription to another user frees user_1's quota
+	if _, ok := repo.Update(ctx, first.ID, "user_2", "premium"); !ok {
+		t.Fatal("Update reported a missing subscription")
+	}
+	if got := repo.GetByUserID(ctx, "user_1"); len(got) != 0 {
+		t.Errorf("GetByUserID(user_1) after update = %v, want none", got)
+	}
+	if got := repo.GetByUserID(ctx, "user_2"); len(got) != 1 || got[0].Plan != "premium" {
+		t.Errorf("GetByUserID(user_2) after update = %v, want the premium subscription", got)
+	}
+	if _, err := repo.Create(ctx, "user_1", "basic"); err != nil {
+		t.Errorf("Create after update error = %v, want nil", err)
+	}
+
+	if _, ok := repo.Delete(ctx, first.ID); !ok {
+		t.Fatal("Delete reported a missing subscription")
+	}
+	if got := repo.GetByUserID(ctx, "user_2"); len(got) != 0 {
+		t.Errorf("GetByUserID(user_2) after delete = %v, want none", got)
+	}
+	if _, err := repo.Create(ctx, "user_2", "basic"); err != nil {
+		t.Errorf("Create after delete error = %v, want nil", err)
+	}
+}
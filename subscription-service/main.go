@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -14,49 +15,268 @@ import (
 
 	observe "observability"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
-	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func main() {
-	cfg := config.NewConfig()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	plans, err := cfg.PlanRegistry()
+	if err != nil {
+		log.Fatalf("Invalid plans: %v", err)
+	}
+
+	logger, closeLogs := initLogger(cfg)
+
+	shutdownTracing := initTracing(cfg, logger)
+
+	metricsSet, metricsRegistry := initMetrics(logger)
+
+	var shutdownMetrics func(context.Context) error
+	if cfg.OTLPMetricsEnabled {
+		shutdownMetrics = initOTLPMetrics(cfg, logger)
+	}
+
+	tracingV1, tracingV2, tracingV3 := initTracingVersions(cfg, logger, metricsRegistry)
 
-	logger := initLogger(cfg)
+	repository, closeRepository := initRepository(cfg, logger, tracingV3)
+	defer closeRepository()
+	restoreSnapshot(cfg, repository, logger)
+	metricsRegistry.MustRegister(observe.NewActiveSubscriptionsCollector("subscription_service", repository))
 
-	tp := initTracing(cfg, logger)
-	defer shutdownTracing(tp, logger)
+	// Seed from stored state, then keep in step through repository events
+	metricsSet.V3.SubscriptionsActive.Set(float64(repository.Count(context.Background())))
+	repository.OnChange(repositoryObserver(metricsSet.V3, logger))
 
-	metricsV1, metricsV2, metricsV3 := initMetrics(logger)
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	services.StartExpiryLoop(workersCtx, repository, time.Minute, nil)
 
-	tracingV1, tracingV2, tracingV3 := initTracingVersions(logger)
+	paymentService := services.NewPaymentService(cfg.PaymentServiceURL,
+		services.WithTracing(tracingV3),
+		services.WithCircuitBreaker(services.NewCircuitBreaker(services.CircuitBreakerConfig{
+			FailureThreshold: cfg.PaymentBreakerThreshold,
+			CoolDown:         cfg.PaymentBreakerCoolDown,
+			StateGauge:       metricsSet.V3.PaymentCircuitState,
+		})),
+	)
+
+	if cfg.PaymentStartupProbe {
+		probePaymentService(paymentService, logger)
+	}
 
-	repository := services.NewSubscriptionRepository()
-	paymentService := services.NewPaymentService(cfg.PaymentServiceURL)
+	var paymentQueue *services.PaymentQueue
+	if cfg.PaymentDegradedMode {
+		paymentQueue = services.NewPaymentQueue(services.PaymentQueueConfig{
+			Payment:    paymentService,
+			Repository: repository,
+			Logger:     logger,
+			DepthGauge: metricsSet.V3.PaymentQueueDepth,
+		})
+		paymentQueue.Start(workersCtx, cfg.PaymentRetryInterval)
+	}
 
 	deps := handlers.NewDependencies(
 		cfg,
 		logger,
 		repository,
 		paymentService,
-		metricsV1,
-		metricsV2,
-		metricsV3,
+		metricsSet.V1,
+		metricsSet.V2,
+		metricsSet.V3,
 		tracingV1,
 		tracingV2,
 		tracingV3,
 	)
 
-	registerRoutes(deps)
+	deps.Metrics = observe.NewMetrics(observe.MetricsConfig{
+		ServiceName: "subscription_service",
+		Registry:    metricsRegistry,
+	})
+	deps.Plans = plans
+	deps.Health = services.NewHealthChecker(repository, paymentService, paymentQueue, 0)
+	deps.PaymentQueue = paymentQueue
+	observe.NewErrorResponseCounter("subscription_service", metricsRegistry)
+	deps.Recover = observe.RecoverMiddleware(logger, observe.NewPanicCounter("subscription_service", metricsRegistry))
+	deps.AccessLog = observe.AccessLogMiddleware(logger, nil)
+	deps.Timeout = observe.TimeoutMiddleware(cfg.RequestTimeout)
+	// X-User-ID is only trustworthy once Auth has overwritten it; without
+	// auth, clients could dodge the limit by sending a new ID per request
+	rateLimitKey := observe.ClientIPKey
+	if cfg.AuthJWTSecret != "" {
+		rateLimitKey = observe.UserIDKey
+	}
+	deps.RateLimit = observe.RateLimitMiddleware(observe.RateLimitConfig{
+		ServiceName:       "subscription_service",
+		RequestsPerSecond: cfg.RateLimitRPS,
+		Burst:             cfg.RateLimitBurst,
+		KeyFunc:           rateLimitKey,
+		Registry:          metricsRegistry,
+	})
+
+	if cfg.AuthJWTSecret != "" {
+		// Verify before rate limiting so limits apply per trusted user
+		deps.Auth = observe.AuthMiddleware(observe.AuthConfig{
+			Verifier: observe.NewHMACVerifier([]byte(cfg.AuthJWTSecret)),
+			Tracing:  tracingV3,
+		})
+	}
+
+	cfg.Watch(workersCtx, configReloadHandler(logger, observe.NewConfigReloadCounter("subscription_service", metricsRegistry), cfg))
+
+	mux := http.NewServeMux()
+	handler := registerRoutes(mux, deps, metricsRegistry)
 
 	logger.Info().
 		Str("port", cfg.Port).
 		Msg("Starting subscription service server")
 
-	log.Fatal(http.ListenAndServe(cfg.Port, nil))
+	server := &http.Server{Addr: cfg.Port, Handler: handler}
+
+	// Snapshot after the server has drained, so writes from in-flight
+	// requests are included; flush telemetry last.
+	err = observe.RunServer(server,
+		func(context.Context) error {
+			stopWorkers()
+			saveSnapshot(cfg, repository, logger)
+			return nil
+		},
+		tracingV1.Shutdown,
+		tracingV2.Shutdown,
+		tracingV3.Shutdown,
+		shutdownTracing,
+		shutdownMetrics,
+		closeLogs,
+	)
+	if err != nil {
+		logger.Error().Err(err).Msg("Subscription service stopped with errors")
+		return
+	}
+
+	logger.Info().Msg("Subscription service stopped")
+}
+
+// configReloadHandler logs and counts each SIGHUP config reload.
+func configReloadHandler(logger zerolog.Logger, reloads *prometheus.CounterVec, cfg *config.Config) func(error) {
+	return func(err error) {
+		if err != nil {
+			reloads.WithLabelValues("failure").Inc()
+			logger.Error().Err(err).Msg("Config reload failed, keeping current values")
+			return
+		}
+
+		reloads.WithLabelValues("success").Inc()
+		logger.Info().
+			Float64("sample_ratio", cfg.CurrentSampleRatio()).
+			Msg("Config reloaded")
+	}
+}
+
+// repositoryObserver centralizes the metrics and logs for repository changes
+// made through any API version.
+func repositoryObserver(metrics *observe.MetricsV3, logger zerolog.Logger) func(services.RepoEvent) {
+	return func(evt services.RepoEvent) {
+		sub := evt.Subscription
+
+		switch evt.Type {
+		case services.EventCreated:
+			metrics.SubscriptionsActive.Inc()
+		case services.EventDeleted:
+			metrics.SubscriptionsActive.Dec()
+		case services.EventExpired:
+			metrics.SubscriptionsActive.Dec()
+			metrics.SubscriptionsExpired.WithLabelValues(sub.Plan).Inc()
+			logger.Info().
+				Str("subscription_id", sub.ID).
+				Str("plan", sub.Plan).
+				Time("end_date", sub.EndDate).
+				Msg("Subscription expired")
+			return
+		}
+
+		logger.Debug().
+			Str("event", evt.Type).
+			Str("subscription_id", sub.ID).
+			Str("user_id", sub.UserID).
+			Str("plan", sub.Plan).
+			Int("subscription_version", sub.Version).
+			Msg("Subscription changed")
+	}
+}
+
+// probePaymentService logs whether the payment service is reachable. It
+// never blocks startup: without degraded mode creates fail until the
+// payment service is up, with it they are queued.
+func probePaymentService(paymentService *services.PaymentService, logger zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := paymentService.Ping(ctx); err != nil {
+		logger.Warn().Err(err).Msg("Payment service unavailable at startup")
+		return
+	}
+	logger.Info().Msg("Payment service reachable")
 }
 
-func initLogger(cfg *config.Config) zerolog.Logger {
+// restoreSnapshot loads SnapshotPath into the repository when both are
+// configured. A missing file is normal on first boot.
+func restoreSnapshot(cfg *config.Config, repository services.Repository, logger zerolog.Logger) {
+	snapshotter, ok := repository.(services.Snapshotter)
+	if !ok || cfg.SnapshotPath == "" {
+		return
+	}
+
+	data, err := os.ReadFile(cfg.SnapshotPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = snapshotter.Restore(data)
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("path", cfg.SnapshotPath).Msg("Failed to restore repository snapshot")
+		return
+	}
+
+	logger.Info().
+		Str("path", cfg.SnapshotPath).
+		Int("subscriptions", repository.Count(context.Background())).
+		Msg("Repository restored from snapshot")
+}
+
+// saveSnapshot writes the repository to SnapshotPath via a temporary file, so
+// a crash mid-write cannot leave a truncated snapshot behind.
+func saveSnapshot(cfg *config.Config, repository services.Repository, logger zerolog.Logger) {
+	snapshotter, ok := repository.(services.Snapshotter)
+	if !ok || cfg.SnapshotPath == "" {
+		return
+	}
+
+	data, err := snapshotter.Snapshot()
+	if err == nil {
+		tmpPath := cfg.SnapshotPath + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0600); err == nil {
+			err = os.Rename(tmpPath, cfg.SnapshotPath)
+		}
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("path", cfg.SnapshotPath).Msg("Failed to write repository snapshot")
+		return
+	}
+
+	logger.Info().Str("path", cfg.SnapshotPath).Msg("Repository snapshot written")
+}
+
+// initLogger returns the logger and a function that flushes and closes its
+// remote writers.
+func initLogger(cfg *config.Config) (zerolog.Logger, func(context.Context) error) {
 	consoleWriter := zerolog.ConsoleWriter{
 		Out:        os.Stdout,
 		TimeFormat: time.RFC3339,
@@ -67,33 +287,70 @@ func initLogger(cfg *config.Config) zerolog.Logger {
 	writers = append(writers, consoleWriter)
 
 	logstashWriter, err := observe.NewLogWriter(observe.LogConfig{
-		Host: cfg.LogstashHost,
+		Host:           cfg.LogstashHost,
+		ServiceName:    "subscription_service",
+		FallbackPath:   cfg.LogFallbackPath,
+		ReplayFallback: true,
+		RedactKeys:     cfg.LogRedactKeys,
 	}, func(err error) {
 		log.Printf("Logstash error: %v", err)
 	})
+	var closers []func(context.Context) error
 	if err == nil {
+		logstashWriter.RegisterMetrics(nil)
 		writers = append(writers, logstashWriter)
+		closers = append(closers, func(context.Context) error { return logstashWriter.Close() })
+	} else {
+		log.Printf("Logstash writer disabled: %v", err)
+	}
+
+	if cfg.OTLPLogsEnabled {
+		otlpWriter, otlpErr := observe.NewOTLPLogWriter(observe.OTLPLogConfig{
+			ServiceName: "subscription-service",
+			Endpoint:    cfg.OTLPEndpoint,
+		})
+		if otlpErr == nil {
+			writers = append(writers, otlpWriter)
+			closers = append(closers, otlpWriter.Shutdown)
+		} else {
+			log.Printf("OTLP log writer disabled: %v", otlpErr)
+		}
 	}
 
+	// TraceHook adds trace_id and span_id to events from loggers derived
+	// with observe.Ctx(logger, r.Context()), so request code can log without
+	// LogWithTrace. Loggers without a context are unaffected.
 	logger := zerolog.New(zerolog.MultiLevelWriter(writers...)).
 		With().
 		Timestamp().
 		Caller().
 		Str("service", "subscription-service").
 		Logger().
-		Level(zerolog.DebugLevel)
+		Hook(observe.TraceHook{})
+	// The level is global so /debug/loglevel can change it at runtime
+	zerolog.SetGlobalLevel(zerolog.DebugLevel)
 
 	logger.Info().
 		Bool("logstash_enabled", err == nil).
 		Msg("Logger initialized")
 
-	return logger
+	closeLogs := func(ctx context.Context) error {
+		var err error
+		for _, closeFn := range closers {
+			err = errors.Join(err, closeFn(ctx))
+		}
+		return err
+	}
+
+	return logger, closeLogs
 }
 
-func initTracing(cfg *config.Config, logger zerolog.Logger) *tracesdk.TracerProvider {
-	tp, err := observe.InitTracer(observe.TracerConfig{
+func initTracing(cfg *config.Config, logger zerolog.Logger) func(context.Context) error {
+	_, shutdown, err := observe.InitTracer(observe.TracerConfig{
 		ServiceName:    "subscription-service",
 		JaegerEndpoint: cfg.JaegerEndpoint,
+		Exporter:       cfg.TraceExporter,
+		OTLPEndpoint:   cfg.OTLPEndpoint,
 		SampleRatio:    0.2,
 	})
 	if err != nil {
@@ -101,27 +358,82 @@ func initTracing(cfg *config.Config, logger zerolog.Logger) *tracesdk.TracerProv
 	}
 
 	logger.Info().Msg("Tracer initialized")
-	return tp
+	return shutdown
 }
 
-func shutdownTracing(tp *tracesdk.TracerProvider, logger zerolog.Logger) {
-	if err := tp.Shutdown(context.Background()); err != nil {
-		logger.Error().Err(err).Msg("Error shutting down tracer provider")
-	}
+func initMetrics(logger zerolog.Logger) (*observe.MetricsSet, *prometheus.Registry) {
+	metricsSet, registry := observe.NewMetricsSet("subscription_service")
+
+	// Runtime metrics go on the service registry with the rest. /metrics
+	// also serves the default registry, so drop its copies or every scrape
+	// would fail on duplicate series
+	observe.RegisterRuntimeMetrics(registry)
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.Unregister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	// Keep endpoint labels bounded so random IDs can't explode series count
+	endpoints := observe.NewLabelSanitizer(observe.LabelSanitizerConfig{
+		ServiceName: "subscription_service",
+		Patterns: []string{
+			"/v1/subscriptions", "/v1/subscriptions/{id}",
+			"/v2/subscriptions", "/v2/subscriptions/{id}",
+			"/v3/subscriptions", "/v3/subscriptions/{id}", "/v3/subscriptions:batch",
+		},
+		Registry: registry,
+	})
+	metricsSet.V2.Endpoints = endpoints
+	metricsSet.V3.Endpoints = endpoints
+
+	metricsSet.V3.SLO = observe.NewSLORecorder(registry, observe.SLOConfig{
+		ServiceName:      "subscription_service",
+		Target:           0.99,
+		Window:           30 * 24 * time.Hour,
+		LatencyObjective: 500 * time.Millisecond,
+	})
+
+	logger.Info().Msg("Metrics initialized for all versions")
+	return metricsSet, registry
 }
 
-func initMetrics(logger zerolog.Logger) (*observe.MetricsV1, *observe.MetricsV2, *observe.MetricsV3) {
-	metricsV1 := observe.NewMetricsV1("subscription_service")
+// initOTLPMetrics pushes OTel instruments to the collector in addition to the
+// Prometheus scrape endpoint.
+func initOTLPMetrics(cfg *config.Config, logger zerolog.Logger) func(context.Context) error {
+	_, shutdown, err := observe.InitOTLPMetrics(observe.OTLPMetricsConfig{
+		ServiceName: "subscription-service",
+		Endpoint:    cfg.OTLPEndpoint,
+	})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to initialize OTLP metrics")
+	}
 
-	metricsV2 := observe.NewMetricsV2("subscription_service", nil) // nil = use default registry
+	logger.Info().Msg("OTLP metrics export enabled")
+	return shutdown
+}
 
-	metricsV3 := observe.NewMetricsV3("subscription_service", nil) // nil = use default registry
+// initRepository returns the configured store and a function that closes it.
+func initRepository(cfg *config.Config, logger zerolog.Logger, tracingV3 *observe.TracingV3) (services.Repository, func()) {
+	if cfg.RepositoryBackend != "bolt" {
+		logger.Info().Msg("Using in-memory repository")
+		repository := services.NewInMemoryRepository()
+		repository.MaxPerUser = cfg.MaxPerUser
+		return repository, func() {}
+	}
 
-	logger.Info().Msg("Metrics initialized for all versions")
-	return metricsV1, metricsV2, metricsV3
+	repository, err := services.NewBoltRepository(cfg.BoltPath, tracingV3, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to open bolt repository")
+	}
+	repository.MaxPerUser = cfg.MaxPerUser
+
+	logger.Info().Str("path", cfg.BoltPath).Msg("Using bolt repository")
+	return repository, func() {
+		if err := repository.Close(); err != nil {
+			logger.Error().Err(err).Msg("Error closing bolt repository")
+		}
+	}
 }
 
-func initTracingVersions(logger zerolog.Logger) (*observe.TracingV1, *observe.TracingV2, *observe.TracingV3) {
+func initTracingVersions(cfg *config.Config, logger zerolog.Logger, metricsRegistry *prometheus.Registry) (*observe.TracingV1, *observe.TracingV2, *observe.TracingV3) {
 	tracingV1 := observe.NewTracingV1("subscription_service")
 
 	tracingV2 := observe.NewTracingV2("subscription_service")
@@ -131,22 +443,82 @@ func initTracingVersions(logger zerolog.Logger) (*observe.TracingV1, *observe.Tr
 		ServiceVersion: "1.0.0",
 		Environment:    "demo",
 		DeploymentMode: "container",
-		SampleRatio:    0.1,
+		SampleRatio:    cfg.SampleRatio,
 		JaegerEndpoint: "http://jaeger:14268/api/traces",
 		EnableMetrics:  true,
 		EnableBaggage:  true,
+
+		// Read on every decision so a SIGHUP reload applies immediately
+		SampleRatioFunc: cfg.CurrentSampleRatio,
+		MetricsRegistry: metricsRegistry,
+
+		// Left to RecoverMiddleware, which counts and logs panics; recovering
+		// here would hide them from it
+		RoutePatternFunc: handlers.RoutePattern,
 	})
 
 	logger.Info().Msg("Tracing initialized for all versions")
 	return tracingV1, tracingV2, tracingV3
 }
 
-func registerRoutes(deps *handlers.Dependencies) {
-	http.Handle("/metrics", promhttp.Handler())
+// registerRoutes registers every route on mux and returns the handler to
+// serve: mux itself, or mux behind CORS when origins are configured.
+func registerRoutes(mux *http.ServeMux, deps *handlers.Dependencies, metricsRegistry *prometheus.Registry) http.Handler {
+	// The default registry still carries the Logstash writer metrics, so
+	// serve it alongside the service registry.
+	// OpenMetrics is required for the V3 latency exemplars to be scraped
+	gatherer := prometheus.Gatherers{metricsRegistry, prometheus.DefaultGatherer}
+	metricsAuth := observe.MetricsAuthConfig{
+		BearerToken:  deps.Config.MetricsBearerToken,
+		AllowedCIDRs: deps.Config.MetricsAllowedCIDRs,
+	}
+	metricsHandler, err := observe.SecureMetricsHandler(
+		promhttp.InstrumentMetricHandler(
+			metricsRegistry,
+			promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+		),
+		metricsAuth,
+	)
+	if err != nil {
+		deps.Logger.Fatal().Err(err).Msg("Invalid metrics auth configuration")
+	}
+	mux.Handle("/metrics", metricsHandler)
+
+	// Operator endpoints share the /metrics credentials and are only served
+	// when some are configured, since anyone could use them otherwise
+	if metricsAuth.Enabled() {
+		logLevelHandler, err := observe.SecureMetricsHandler(observe.LogLevelHandler(deps.Logger), metricsAuth)
+		if err != nil {
+			deps.Logger.Fatal().Err(err).Msg("Invalid metrics auth configuration")
+		}
+		mux.Handle("/debug/loglevel", logLevelHandler)
+	}
+	if err := observe.RegisterPprof(mux, deps.Config.PprofEnabled, metricsAuth); err != nil {
+		deps.Logger.Fatal().Err(err).Msg("Invalid pprof configuration")
+	}
+	if deps.Config.LoadgenEnabled && metricsAuth.Enabled() {
+		loadgenHandler, err := observe.SecureMetricsHandler(
+			observe.LoadgenHandler(deps.Logger, "http://localhost"+deps.Config.Port, deps.TracingV3), metricsAuth)
+		if err != nil {
+			deps.Logger.Fatal().Err(err).Msg("Invalid metrics auth configuration")
+		}
+		mux.Handle("/debug/loadgen", loadgenHandler)
+	}
 
-	handlers.RegisterV1Routes(deps)
-	handlers.RegisterV2Routes(deps)
-	handlers.RegisterV3Routes(deps)
+	handlers.RegisterV1Routes(mux, deps)
+	handlers.RegisterV2Routes(mux, deps)
+	handlers.RegisterV3Routes(mux, deps)
+	handlers.RegisterHealthRoutes(mux, deps)
+	handlers.RegisterOpenAPIRoutes(mux, deps)
 
 	deps.Logger.Info().Msg("Routes registered for all API versions (/v1, /v2, /v3)")
+
+	if len(deps.Config.CORSAllowedOrigins) == 0 {
+		return mux
+	}
+	return observe.CORSMiddleware(observe.CORSConfig{
+		AllowedOrigins: deps.Config.CORSAllowedOrigins,
+		ExposedHeaders: []string{"ETag", "X-Total-Count", "Retry-After"},
+		MaxAge:         600,
+	})(mux.ServeHTTP)
 }